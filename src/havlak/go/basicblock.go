@@ -22,135 +22,514 @@ package cfg
 
 import "container/list"
 import "fmt"
+import "sort"
 
-type BasicBlock struct {
-	name     int
-	inEdges  list.List
-	outEdges list.List
+// BasicBlock is generic in the type of its name. The original
+// benchmark numbers its blocks, and the int-named API is simply the
+// K = int instantiation, but blocks can equally well be named by
+// addresses (uint64) or labels (string).
+//
+type BasicBlock[K comparable] struct {
+	name     K
+	seq      int       // creation order, for stable output
+	count    int64     // execution count, from a profile
+	inEdges  list.List // of *BasicBlockEdge[K]
+	outEdges list.List // of *BasicBlockEdge[K]
 }
 
-func NewBasicBlock(name int) *BasicBlock {
-	return &BasicBlock{name: name}
+func NewBasicBlock[K comparable](name K) *BasicBlock[K] {
+	return &BasicBlock[K]{name: name}
 }
 
-func (bb *BasicBlock) Dump() {
-	fmt.Printf("BB#%03d: ", bb.Name())
+// String returns the block's name in the "BB#" form used by Dump.
+//
+func (bb *BasicBlock[K]) String() string {
+	return "BB#" + displayName(bb.name)
+}
+
+func (bb *BasicBlock[K]) Dump() {
+	fmt.Printf("%v: ", bb)
 	if bb.NumPred() > 0 {
 		fmt.Printf("in : ")
 		for iter := bb.InEdges().Front(); iter != nil; iter = iter.Next() {
-			fmt.Printf("BB#%03d ", iter.Value.(*BasicBlock).Name())
+			edge := iter.Value.(*BasicBlockEdge[K])
+			fmt.Printf("%v%s ", edge.Src(), edge.annotation())
 		}
 	}
 	if bb.NumSucc() > 0 {
 		fmt.Print("out: ")
 		for iter := bb.OutEdges().Front(); iter != nil; iter = iter.Next() {
-			fmt.Printf("BB#%03d ", iter.Value.(*BasicBlock).Name())
+			edge := iter.Value.(*BasicBlockEdge[K])
+			fmt.Printf("%v%s ", edge.Dst(), edge.annotation())
 		}
 	}
 	fmt.Printf("\n")
 }
 
-func (bb *BasicBlock) Name() int {
+func (bb *BasicBlock[K]) Name() K {
 	return bb.name
 }
 
-func (bb *BasicBlock) InEdges() *list.List {
+// InEdges and OutEdges hold *BasicBlockEdge values, so that the kind
+// and label of every edge can be reached from either endpoint.
+//
+func (bb *BasicBlock[K]) InEdges() *list.List {
 	return &bb.inEdges
 }
 
-func (bb *BasicBlock) OutEdges() *list.List {
+func (bb *BasicBlock[K]) OutEdges() *list.List {
 	return &bb.outEdges
 }
 
-func (bb *BasicBlock) NumPred() int {
+func (bb *BasicBlock[K]) Count() int64 {
+	return bb.count
+}
+
+func (bb *BasicBlock[K]) SetCount(count int64) {
+	bb.count = count
+}
+
+func (bb *BasicBlock[K]) NumPred() int {
 	return bb.inEdges.Len()
 }
 
-func (bb *BasicBlock) NumSucc() int {
+func (bb *BasicBlock[K]) NumSucc() int {
 	return bb.outEdges.Len()
 }
 
-func (bb *BasicBlock) AddInEdge(from *BasicBlock) {
-	bb.inEdges.PushBack(from)
+func (bb *BasicBlock[K]) AddInEdge(edge *BasicBlockEdge[K]) {
+	bb.inEdges.PushBack(edge)
 }
 
-func (bb *BasicBlock) AddOutEdge(to *BasicBlock) {
-	bb.outEdges.PushBack(to)
+func (bb *BasicBlock[K]) AddOutEdge(edge *BasicBlockEdge[K]) {
+	bb.outEdges.PushBack(edge)
+}
+
+// RemoveInEdge removes 'edge' from the incoming edges, if it is there.
+//
+func (bb *BasicBlock[K]) RemoveInEdge(edge *BasicBlockEdge[K]) bool {
+	return removeFromList(&bb.inEdges, edge)
+}
+
+// RemoveOutEdge removes 'edge' from the outgoing edges, if it is there.
+//
+func (bb *BasicBlock[K]) RemoveOutEdge(edge *BasicBlockEdge[K]) bool {
+	return removeFromList(&bb.outEdges, edge)
+}
+
+// FindOutEdge returns the first edge from this block to 'to', or nil.
+//
+func (bb *BasicBlock[K]) FindOutEdge(to *BasicBlock[K]) *BasicBlockEdge[K] {
+	for iter := bb.outEdges.Front(); iter != nil; iter = iter.Next() {
+		if edge := iter.Value.(*BasicBlockEdge[K]); edge.Dst() == to {
+			return edge
+		}
+	}
+	return nil
+}
+
+func removeFromList[K comparable](l *list.List, edge *BasicBlockEdge[K]) bool {
+	for iter := l.Front(); iter != nil; iter = iter.Next() {
+		if iter.Value.(*BasicBlockEdge[K]) == edge {
+			l.Remove(iter)
+			return true
+		}
+	}
+	return false
 }
 
 //-----------------------------------------------------------
 
-type CFG struct {
-	bb        map[int]*BasicBlock
-	startNode *BasicBlock
+type CFG[K comparable] struct {
+	bb           map[K]*BasicBlock[K]
+	startNode    *BasicBlock[K]
+	virtualEntry *BasicBlock[K]
+	nextSeq      int
+}
+
+// NewCFG creates an int-named CFG, as used by the benchmark.
+//
+func NewCFG() *CFG[int] {
+	return NewCFGOf[int]()
 }
 
-func NewCFG() *CFG {
-	return &CFG{bb: make(map[int]*BasicBlock)}
+// NewCFGOf creates a CFG whose blocks are named by values of type K.
+//
+func NewCFGOf[K comparable]() *CFG[K] {
+	return &CFG[K]{bb: make(map[K]*BasicBlock[K])}
 }
 
-func (cfg *CFG) BasicBlocks() map[int]*BasicBlock {
+func (cfg *CFG[K]) BasicBlocks() map[K]*BasicBlock[K] {
 	return cfg.bb
 }
 
-func (cfg *CFG) NumNodes() int {
+// Blocks returns all blocks in a deterministic order: by name when
+// names are integers, floats or strings, and in creation order
+// otherwise.
+//
+func (cfg *CFG[K]) Blocks() []*BasicBlock[K] {
+	blocks := make([]*BasicBlock[K], 0, len(cfg.bb))
+	for _, bb := range cfg.bb {
+		blocks = append(blocks, bb)
+	}
+	SortBlocks(blocks)
+	return blocks
+}
+
+// SortBlocks sorts blocks of one CFG into the order used by Blocks.
+//
+func SortBlocks[K comparable](blocks []*BasicBlock[K]) {
+	ordered := isOrderedName(*new(K))
+	sort.Slice(blocks, func(i, j int) bool {
+		if ordered {
+			return nameLess(blocks[i].name, blocks[j].name)
+		}
+		return blocks[i].seq < blocks[j].seq
+	})
+}
+
+func (cfg *CFG[K]) NumNodes() int {
 	return len(cfg.bb)
 }
 
-func (cfg *CFG) CreateNode(node int) *BasicBlock {
+func (cfg *CFG[K]) CreateNode(node K) *BasicBlock[K] {
 	if bblock := cfg.bb[node]; bblock != nil {
 		return bblock
 	}
 	bblock := NewBasicBlock(node)
+	bblock.seq = cfg.nextSeq
+	cfg.nextSeq++
 	cfg.bb[node] = bblock
 
-	if cfg.NumNodes() == 1 {
+	// Until SetStart or SetEntries is called, the first block
+	// created serves as the start node.
+	if cfg.startNode == nil {
 		cfg.startNode = bblock
 	}
 
 	return bblock
 }
 
-func (cfg *CFG) Dump() {
+// SetStart makes 'node' the single entry of the graph, creating it
+// if necessary. A virtual entry left over from SetEntries is removed.
+//
+func (cfg *CFG[K]) SetStart(node K) *BasicBlock[K] {
+	cfg.dropVirtualEntry()
+	cfg.startNode = cfg.CreateNode(node)
+	return cfg.startNode
+}
+
+// SetEntries declares the entry blocks of the graph. Repeated
+// entries count once.
+//
+// With a single entry this is the same as SetStart. With several,
+// a synthetic block is added that has an edge to every entry, and
+// that block becomes the start node. Analyses starting from
+// StartBasicBlock then reach everything reachable from any entry.
+// The virtual entry gets a name not used by any block (see
+// freshName), which only works for names of the basic kinds:
+// integers, floats, strings and types defined on them. Graphs named
+// by other types must use SetEntriesNamed, or this panics.
+//
+func (cfg *CFG[K]) SetEntries(nodes ...K) *BasicBlock[K] {
+	nodes = distinct(nodes)
+	if len(nodes) == 0 {
+		return nil
+	}
+	if len(nodes) == 1 {
+		return cfg.SetStart(nodes[0])
+	}
+	cfg.dropVirtualEntry()
+	return cfg.SetEntriesNamed(cfg.freshName(nodes), nodes...)
+}
+
+// SetEntriesNamed is SetEntries with a caller-chosen name for the
+// virtual entry block. The name must not be that of a block, other
+// than the virtual entry it replaces, or of an entry; this panics if
+// it is.
+//
+func (cfg *CFG[K]) SetEntriesNamed(virtualName K, nodes ...K) *BasicBlock[K] {
+	nodes = distinct(nodes)
+	if len(nodes) < 2 {
+		return cfg.SetEntries(nodes...)
+	}
+	if bb := cfg.bb[virtualName]; bb != nil && bb != cfg.virtualEntry {
+		panic(fmt.Sprintf("cfg: virtual entry name %s is already a block", FormatName(virtualName)))
+	}
+	for _, n := range nodes {
+		if n == virtualName {
+			panic(fmt.Sprintf("cfg: virtual entry name %s is also an entry", FormatName(virtualName)))
+		}
+	}
+	cfg.dropVirtualEntry()
+
+	virtual := cfg.CreateNode(virtualName)
+	for _, n := range nodes {
+		NewBasicBlockEdge(cfg, virtualName, n)
+	}
+	cfg.virtualEntry = virtual
+	cfg.startNode = virtual
+	return virtual
+}
+
+// distinct returns 'nodes' without repetitions, in order of first
+// occurrence.
+//
+func distinct[K comparable](nodes []K) []K {
+	seen := make(map[K]bool)
+	var out []K
+	for _, n := range nodes {
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// Entries returns the entry blocks of the graph: the successors of
+// the virtual entry if there is one, otherwise just the start node.
+//
+func (cfg *CFG[K]) Entries() []*BasicBlock[K] {
+	if cfg.virtualEntry == nil {
+		if cfg.startNode == nil {
+			return nil
+		}
+		return []*BasicBlock[K]{cfg.startNode}
+	}
+	var entries []*BasicBlock[K]
+	for iter := cfg.virtualEntry.OutEdges().Front(); iter != nil; iter = iter.Next() {
+		entries = append(entries, iter.Value.(*BasicBlockEdge[K]).Dst())
+	}
+	return entries
+}
+
+// VirtualEntry returns the synthetic entry created by SetEntries,
+// or nil if the graph has a single entry.
+//
+func (cfg *CFG[K]) VirtualEntry() *BasicBlock[K] {
+	return cfg.virtualEntry
+}
+
+func (cfg *CFG[K]) dropVirtualEntry() {
+	if cfg.virtualEntry != nil {
+		cfg.RemoveBlock(cfg.virtualEntry.Name())
+	}
+}
+
+// RemoveEdge removes one edge from -> to and updates both endpoints.
+// It returns false if there is no such edge.
+//
+func (cfg *CFG[K]) RemoveEdge(from K, to K) bool {
+	src, dst := cfg.bb[from], cfg.bb[to]
+	if src == nil || dst == nil {
+		return false
+	}
+	return cfg.RemoveBasicBlockEdge(src.FindOutEdge(dst))
+}
+
+// RemoveBasicBlockEdge unlinks a specific edge from both endpoints.
+//
+func (cfg *CFG[K]) RemoveBasicBlockEdge(edge *BasicBlockEdge[K]) bool {
+	if edge == nil || !edge.Src().RemoveOutEdge(edge) {
+		return false
+	}
+	edge.Dst().RemoveInEdge(edge)
+	return true
+}
+
+// RemoveBlock removes a block and every edge into or out of it.
+//
+// If the block was the start node, the start moves to its first
+// remaining successor, or else to the first block in Blocks order,
+// so that StartBasicBlock never refers to a block outside the graph.
+//
+func (cfg *CFG[K]) RemoveBlock(node K) bool {
+	bblock := cfg.bb[node]
+	if bblock == nil {
+		return false
+	}
+
+	for iter := bblock.InEdges().Front(); iter != nil; iter = iter.Next() {
+		edge := iter.Value.(*BasicBlockEdge[K])
+		if edge.Src() != bblock {
+			edge.Src().RemoveOutEdge(edge)
+		}
+	}
+	for iter := bblock.OutEdges().Front(); iter != nil; iter = iter.Next() {
+		edge := iter.Value.(*BasicBlockEdge[K])
+		if edge.Dst() != bblock {
+			edge.Dst().RemoveInEdge(edge)
+		}
+	}
+	delete(cfg.bb, node)
+
+	if cfg.virtualEntry == bblock {
+		cfg.virtualEntry = nil
+	}
+	if cfg.startNode == bblock {
+		cfg.startNode = nil
+		for iter := bblock.OutEdges().Front(); iter != nil; iter = iter.Next() {
+			if succ := iter.Value.(*BasicBlockEdge[K]).Dst(); succ != bblock {
+				cfg.startNode = succ
+				break
+			}
+		}
+		if blocks := cfg.Blocks(); cfg.startNode == nil && len(blocks) > 0 {
+			cfg.startNode = blocks[0]
+		}
+	}
+	bblock.inEdges.Init()
+	bblock.outEdges.Init()
+
+	return true
+}
+
+// ReplaceSuccessor redirects one edge node -> oldSucc to node -> newSucc,
+// keeping its position in the successor list, its kind and its label.
+// The new successor is created if necessary. It returns false if there
+// is no such edge.
+//
+func (cfg *CFG[K]) ReplaceSuccessor(node K, oldSucc K, newSucc K) bool {
+	src, oldDst := cfg.bb[node], cfg.bb[oldSucc]
+	if src == nil || oldDst == nil {
+		return false
+	}
+	edge := src.FindOutEdge(oldDst)
+	if edge == nil {
+		return false
+	}
+	oldDst.RemoveInEdge(edge)
+	edge.to = cfg.CreateNode(newSucc)
+	edge.to.AddInEdge(edge)
+	return true
+}
+
+func (cfg *CFG[K]) Dump() {
 	for _, n := range cfg.bb {
 		n.Dump()
 	}
 }
 
-func (cfg *CFG) StartBasicBlock() *BasicBlock {
+func (cfg *CFG[K]) StartBasicBlock() *BasicBlock[K] {
 	return cfg.startNode
 }
 
-func (cfg *CFG) Dst(edge *BasicBlockEdge) *BasicBlock {
+func (cfg *CFG[K]) Dst(edge *BasicBlockEdge[K]) *BasicBlock[K] {
 	return edge.Dst()
 }
 
-func (cfg *CFG) Src(edge *BasicBlockEdge) *BasicBlock {
+func (cfg *CFG[K]) Src(edge *BasicBlockEdge[K]) *BasicBlock[K] {
 	return edge.Src()
 }
 
 //-----------------------------------------------------------
 
-type BasicBlockEdge struct {
-	to   *BasicBlock
-	from *BasicBlock
+// EdgeKind tells how control gets from the source of an edge to its
+// destination. The zero value, EdgeFallthrough, is what plain
+// NewBasicBlockEdge creates.
+//
+type EdgeKind int
+
+const (
+	EdgeFallthrough EdgeKind = iota // falls through / only successor
+	EdgeTaken                       // taken branch of a conditional
+	EdgeSwitchCase                  // one case of a multi-way branch
+	EdgeExceptional                 // to an exception handler
+	EdgeCallReturn                  // from a call site to its return point
+	numEdgeKinds
+)
+
+var edgeKindNames = [numEdgeKinds]string{
+	"fallthrough", "taken", "case", "exceptional", "call-return",
+}
+
+func (kind EdgeKind) String() string {
+	if kind < 0 || kind >= numEdgeKinds {
+		return fmt.Sprintf("EdgeKind(%d)", int(kind))
+	}
+	return edgeKindNames[kind]
+}
+
+// ParseEdgeKind maps the String form of an edge kind back to its value.
+//
+func ParseEdgeKind(s string) (EdgeKind, bool) {
+	for kind, name := range edgeKindNames {
+		if name == s {
+			return EdgeKind(kind), true
+		}
+	}
+	return EdgeFallthrough, false
+}
+
+type BasicBlockEdge[K comparable] struct {
+	to     *BasicBlock[K]
+	from   *BasicBlock[K]
+	kind   EdgeKind
+	label  string
+	weight int64 // times taken, from a profile
 }
 
-func (edge *BasicBlockEdge) Dst() *BasicBlock {
+func (edge *BasicBlockEdge[K]) Dst() *BasicBlock[K] {
 	return edge.to
 }
 
-func (edge *BasicBlockEdge) Src() *BasicBlock {
+func (edge *BasicBlockEdge[K]) Src() *BasicBlock[K] {
 	return edge.from
 }
 
-func NewBasicBlockEdge(cfg *CFG, from int, to int) *BasicBlockEdge {
-	self := new(BasicBlockEdge)
+func (edge *BasicBlockEdge[K]) Kind() EdgeKind {
+	return edge.kind
+}
+
+func (edge *BasicBlockEdge[K]) Label() string {
+	return edge.label
+}
+
+func (edge *BasicBlockEdge[K]) SetKind(kind EdgeKind) {
+	edge.kind = kind
+}
+
+func (edge *BasicBlockEdge[K]) Weight() int64 {
+	return edge.weight
+}
+
+func (edge *BasicBlockEdge[K]) SetWeight(weight int64) {
+	edge.weight = weight
+}
+
+// SetLabel attaches a free-form label, e.g. a case value or the
+// name of the branch target in the original program.
+//
+func (edge *BasicBlockEdge[K]) SetLabel(label string) {
+	edge.label = label
+}
+
+// annotation renders kind and label for dumps; plain edges print
+// exactly as they always have.
+//
+func (edge *BasicBlockEdge[K]) annotation() string {
+	switch {
+	case edge.label != "":
+		return fmt.Sprintf("[%v:%s]", edge.kind, edge.label)
+	case edge.kind != EdgeFallthrough:
+		return fmt.Sprintf("[%v]", edge.kind)
+	}
+	return ""
+}
+
+func NewBasicBlockEdge[K comparable](cfg *CFG[K], from K, to K) *BasicBlockEdge[K] {
+	return NewBasicBlockEdgeOfKind(cfg, from, to, EdgeFallthrough)
+}
+
+func NewBasicBlockEdgeOfKind[K comparable](cfg *CFG[K], from K, to K, kind EdgeKind) *BasicBlockEdge[K] {
+	self := new(BasicBlockEdge[K])
 	self.to = cfg.CreateNode(to)
 	self.from = cfg.CreateNode(from)
+	self.kind = kind
 
-	self.from.AddOutEdge(self.to)
-	self.to.AddInEdge(self.from)
+	self.from.AddOutEdge(self)
+	self.to.AddInEdge(self)
 
 	return self
 }
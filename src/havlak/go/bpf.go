@@ -0,0 +1,496 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Control flow graphs of eBPF programs in ELF object files.
+//
+// Read takes an object file as clang or llc -march=bpf write it.
+// Every function symbol in an executable section other than .text
+// is a program (a section without symbols is one program named
+// after the section); functions in .text are subprograms. If the
+// object has no program sections, the global functions in .text
+// are the programs.
+//
+// A program is linked the way the loader does it: the program's
+// code comes first, followed by every subprogram it reaches through
+// BPF-to-BPF calls, so blocks are named by the instruction index
+// the verifier reports. A 16-byte lddw counts as two instructions.
+// The program's CFG has the program and each subprogram as entries
+// (see cfg.SetEntries); a call is an ordinary instruction, so the
+// loops of a subprogram are found once however often it is called.
+// The edges are:
+//
+//    ja                       target fallthrough
+//    jeq, jgt, ..., jsle      target taken, next fallthrough
+//    exit                     no successors
+//
+package bpf
+
+import "bytes"
+import "debug/elf"
+import "encoding/binary"
+import "fmt"
+import "io"
+import "sort"
+import "./basicblock"
+import "./lsg"
+import "./havlakloopfinder"
+
+// Program is the linked CFG of one program.
+//
+type Program struct {
+	Name        string
+	Section     string
+	CFG         *cfg.CFG[int] // by instruction index
+	Subprograms []Subprogram  // in link order
+}
+
+// Subprogram is a function appended to a program by the linker.
+//
+type Subprogram struct {
+	Name  string
+	Start int // index of its first instruction
+	End   int // index after its last instruction
+}
+
+// FormatError is an error in the code of a section.
+//
+type FormatError struct {
+	Section string
+	Insn    int // instruction index within the section
+	Msg     string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("section %s, insn %d: %s", e.Section, e.Insn, e.Msg)
+}
+
+// Read parses an object file with cfg.DefaultLimits, applying
+// MaxBlocks and MaxEdges to each program.
+//
+func Read(r io.Reader) ([]*Program, error) {
+	return ReadLimits(r, cfg.DefaultLimits)
+}
+
+// ReadLimits parses an object file, failing if it is larger than
+// limits.MaxBytes or a program exceeds the other limits.
+//
+func ReadLimits(r io.Reader, limits cfg.Limits) ([]*Program, error) {
+	if limits.MaxBytes > 0 {
+		r = io.LimitReader(r, limits.MaxBytes+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxBytes > 0 && int64(len(data)) > limits.MaxBytes {
+		return nil, fmt.Errorf("input larger than %d bytes", limits.MaxBytes)
+	}
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f, limits)
+}
+
+// FindLoops runs Havlak's algorithm on the program and computes
+// the nesting levels.
+//
+func (p *Program) FindLoops() *lsg.LSG[int] {
+	lsgraph := lsg.NewLSG()
+	havlakloopfinder.FindHavlakLoops(p.CFG, lsgraph)
+	lsgraph.CalculateNestingLevel()
+	return lsgraph
+}
+
+// WriteReport prints the loops of a program, one per line, indented
+// by depth and ordered by header:
+//
+//    xdp/xdp_table: 9 blocks, 3 loops
+//      loop at insn 24, depth 1, nesting 1
+//        loop at insn 5, depth 2, nesting 0
+//      loop at insn 32 in checksum, depth 1, nesting 0
+//
+// Any loop keeps a program from loading on kernels before 5.3, and
+// an irreducible one is rejected by the verifier of any kernel.
+//
+func WriteReport(w io.Writer, p *Program) error {
+	lsgraph := p.FindLoops()
+	numBlocks := p.CFG.NumNodes()
+	if p.CFG.VirtualEntry() != nil {
+		numBlocks--
+	}
+	if _, err := fmt.Fprintf(w, "%s/%s: %d blocks, %d loops\n",
+		p.Section, p.Name, numBlocks, lsgraph.NumLoops()); err != nil {
+		return err
+	}
+
+	var write func(loop *lsg.SimpleLoop[int], indent string) error
+	write = func(loop *lsg.SimpleLoop[int], indent string) error {
+		var children []*lsg.SimpleLoop[int]
+		for child, _ := range loop.Children() {
+			children = append(children, child)
+		}
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].Header().Name() < children[j].Header().Name()
+		})
+		for _, child := range children {
+			header := child.Header().Name()
+			where := ""
+			for _, sub := range p.Subprograms {
+				if header >= sub.Start && header < sub.End {
+					where = " in " + sub.Name
+				}
+			}
+			irreducible := ""
+			if !child.IsReducible() {
+				irreducible = " (irreducible)"
+			}
+			if _, err := fmt.Fprintf(w, "%sloop at insn %d%s, depth %d, nesting %d%s\n",
+				indent, header, where, child.DepthLevel(), child.NestingLevel(), irreducible); err != nil {
+				return err
+			}
+			if err := write(child, indent+"  "); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return write(lsgraph.Root(), "  ")
+}
+
+//-----------------------------------------------------------
+
+// function is the code of one function symbol, in instructions
+// of its section.
+//
+type function struct {
+	name       string
+	section    *section
+	start, end int
+}
+
+type section struct {
+	name   string
+	code   []byte
+	funcs  []*function // by start
+	relocs map[int]elf.Symbol
+}
+
+// insn returns the fields of instruction 'i' that matter here.
+//
+func (s *section) insn(order binary.ByteOrder, i int) (op byte, src byte, off int, imm int) {
+	b := s.code[8*i : 8*i+8]
+	src = b[1] >> 4
+	if order == binary.BigEndian {
+		src = b[1] & 0xf
+	}
+	return b[0], src, int(int16(order.Uint16(b[2:]))), int(int32(order.Uint32(b[4:])))
+}
+
+func (s *section) errorf(insn int, format string, args ...interface{}) error {
+	return &FormatError{Section: s.name, Insn: insn, Msg: fmt.Sprintf(format, args...)}
+}
+
+// function returns the function containing instruction 'i'.
+//
+func (s *section) function(i int) *function {
+	n := sort.Search(len(s.funcs), func(k int) bool { return s.funcs[k].end > i })
+	if n < len(s.funcs) && s.funcs[n].start <= i {
+		return s.funcs[n]
+	}
+	return nil
+}
+
+const (
+	classJmp   = 0x05
+	classJmp32 = 0x06
+	opJa       = 0x00
+	opCall     = 0x80
+	opExit     = 0x90
+	opLddw     = 0x18
+	pseudoCall = 1
+)
+
+// Load finds the programs of an opened object file.
+//
+func Load(f *elf.File, limits cfg.Limits) ([]*Program, error) {
+	if f.Machine != elf.EM_BPF {
+		return nil, fmt.Errorf("not a BPF object: machine %v", f.Machine)
+	}
+	syms, err := f.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+
+	sections := make(map[int]*section)
+	var order []int
+	for i, sec := range f.Sections {
+		if sec.Type != elf.SHT_PROGBITS || sec.Flags&elf.SHF_EXECINSTR == 0 || sec.Size == 0 {
+			continue
+		}
+		code, err := sec.Data()
+		if err != nil {
+			return nil, err
+		}
+		s := &section{name: sec.Name, code: code, relocs: make(map[int]elf.Symbol)}
+		if len(code)%8 != 0 {
+			return nil, s.errorf(len(code)/8, "size %d is not a multiple of 8", len(code))
+		}
+		sections[i] = s
+		order = append(order, i)
+	}
+
+	for _, sym := range syms {
+		s := sections[int(sym.Section)]
+		if s == nil || elf.ST_TYPE(sym.Info) != elf.STT_FUNC {
+			continue
+		}
+		fn := &function{name: sym.Name, section: s, start: int(sym.Value / 8), end: int((sym.Value + sym.Size) / 8)}
+		if sym.Value%8 != 0 || fn.end > len(s.code)/8 {
+			return nil, s.errorf(fn.start, "bad symbol %s", sym.Name)
+		}
+		s.funcs = append(s.funcs, fn)
+	}
+	for _, i := range order {
+		s := sections[i]
+		if len(s.funcs) == 0 {
+			s.funcs = []*function{{name: s.name, section: s, start: 0, end: len(s.code) / 8}}
+		}
+		sort.Slice(s.funcs, func(a, b int) bool { return s.funcs[a].start < s.funcs[b].start })
+		for k, fn := range s.funcs {
+			// Symbols of size 0 extend to the next one.
+			if fn.end <= fn.start {
+				fn.end = len(s.code) / 8
+				if k+1 < len(s.funcs) {
+					fn.end = s.funcs[k+1].start
+				}
+			}
+		}
+	}
+
+	for _, sec := range f.Sections {
+		s := sections[int(sec.Info)]
+		if sec.Type != elf.SHT_REL || s == nil {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return nil, err
+		}
+		for k := 0; k+16 <= len(data); k += 16 {
+			off := f.ByteOrder.Uint64(data[k:])
+			index := int(f.ByteOrder.Uint64(data[k+8:]) >> 32)
+			if index == 0 || index > len(syms) {
+				return nil, s.errorf(int(off/8), "relocation against bad symbol %d", index)
+			}
+			s.relocs[int(off/8)] = syms[index-1]
+		}
+	}
+
+	var mains []*function
+	text := -1
+	for _, i := range order {
+		if sections[i].name == ".text" {
+			text = i
+			continue
+		}
+		mains = append(mains, sections[i].funcs...)
+	}
+	if len(mains) == 0 && text >= 0 {
+		for _, sym := range syms {
+			if int(sym.Section) == text && elf.ST_TYPE(sym.Info) == elf.STT_FUNC && elf.ST_BIND(sym.Info) == elf.STB_GLOBAL {
+				mains = append(mains, sections[text].function(int(sym.Value/8)))
+			}
+		}
+	}
+
+	var progs []*Program
+	for _, fn := range mains {
+		l := &linker{order: f.ByteOrder, sections: sections, limits: limits, base: make(map[*function]int)}
+		p, err := l.link(fn)
+		if err != nil {
+			return nil, err
+		}
+		progs = append(progs, p)
+	}
+	return progs, nil
+}
+
+//-----------------------------------------------------------
+
+type linker struct {
+	order    binary.ByteOrder
+	sections map[int]*section
+	limits   cfg.Limits
+
+	funcs   []*function       // in link order
+	base    map[*function]int // index of a function's first instruction
+	size    int
+	entries []int // of subprograms
+	isEntry map[int]bool
+}
+
+func (l *linker) add(fn *function) int {
+	if base, ok := l.base[fn]; ok {
+		return base
+	}
+	l.base[fn] = l.size
+	l.funcs = append(l.funcs, fn)
+	l.size += fn.end - fn.start
+	return l.base[fn]
+}
+
+// callee resolves the BPF-to-BPF call at instruction 'i' of 's' to
+// a function and the instruction within its section.
+//
+func (l *linker) callee(s *section, i int, imm int) (*function, int, error) {
+	target, ts := i+imm+1, s
+	if sym, ok := s.relocs[i]; ok {
+		ts = l.sections[int(sym.Section)]
+		if ts == nil {
+			return nil, 0, s.errorf(i, "call to %s, which is not code", sym.Name)
+		}
+		target = int(sym.Value / 8)
+		if elf.ST_TYPE(sym.Info) != elf.STT_FUNC {
+			// Against the section: the immediate is relative.
+			target += imm + 1
+		}
+	}
+	fn := ts.function(target)
+	if fn == nil {
+		return nil, 0, s.errorf(i, "call to insn %d of %s, outside any function", target, ts.name)
+	}
+	return fn, target, nil
+}
+
+// link lays out a program and its subprograms and builds the CFG.
+//
+func (l *linker) link(main *function) (*Program, error) {
+	p := &Program{Name: main.name, Section: main.section.name}
+	l.add(main)
+	l.isEntry = map[int]bool{0: true}
+
+	// The instructions that start blocks, and their successors.
+	leader := make(map[int]bool)
+	type succ struct {
+		to   int
+		kind cfg.EdgeKind
+	}
+	succs := make(map[int][]succ) // by last instruction
+	last := make(map[int]bool)
+
+	for k := 0; k < len(l.funcs); k++ {
+		fn := l.funcs[k]
+		s, base := fn.section, l.base[fn]
+		leader[base] = true
+		if k > 0 {
+			p.Subprograms = append(p.Subprograms, Subprogram{fn.name, base, base + fn.end - fn.start})
+		}
+
+		second := make(map[int]bool) // second halves of lddw
+		for i := fn.start; i < fn.end; i++ {
+			op, src, off, imm := s.insn(l.order, i)
+			at := base + i - fn.start
+			if op == opLddw {
+				if i+1 >= fn.end {
+					return nil, s.errorf(i, "truncated lddw")
+				}
+				second[i+1] = true
+				i++
+				continue
+			}
+			class := op & 0x07
+			if class != classJmp && class != classJmp32 {
+				continue
+			}
+			switch op & 0xf0 {
+			case opCall:
+				if src != pseudoCall || class != classJmp {
+					continue
+				}
+				callee, target, err := l.callee(s, i, imm)
+				if err != nil {
+					return nil, err
+				}
+				entry := l.add(callee) + target - callee.start
+				if !l.isEntry[entry] {
+					l.isEntry[entry] = true
+					l.entries = append(l.entries, entry)
+				}
+				leader[entry] = true
+				continue
+			case opExit:
+				last[at] = true
+			case opJa:
+				if class == classJmp32 {
+					off = imm // gotol
+				}
+				succs[at] = []succ{{at + off + 1, cfg.EdgeFallthrough}}
+				last[at] = true
+			default:
+				succs[at] = []succ{{at + off + 1, cfg.EdgeTaken}, {at + 1, cfg.EdgeFallthrough}}
+				last[at] = true
+			}
+			if i+1 < fn.end {
+				leader[at+1] = true
+			}
+			for _, t := range succs[at] {
+				j := t.to - base + fn.start
+				if j < fn.start || j >= fn.end {
+					return nil, s.errorf(i, "jump to insn %d, outside %s", j, fn.name)
+				}
+				leader[t.to] = true
+			}
+		}
+		for i := range second {
+			if leader[base+i-fn.start] {
+				return nil, s.errorf(i-1, "jump into the middle of lddw")
+			}
+		}
+		if !last[base+fn.end-fn.start-1] {
+			return nil, s.errorf(fn.end-1, "%s falls off its end", fn.name)
+		}
+	}
+
+	g := cfg.NewCFGOf[int]()
+	numEdges := 0
+	var block int
+	for at := 0; at < l.size; at++ {
+		if leader[at] {
+			if l.limits.MaxBlocks > 0 && g.NumNodes() >= l.limits.MaxBlocks {
+				return nil, fmt.Errorf("more than %d blocks in %s", l.limits.MaxBlocks, p.Name)
+			}
+			block = at
+			g.CreateNode(block)
+		}
+		if !last[at] && leader[at+1] {
+			succs[at] = []succ{{at + 1, cfg.EdgeFallthrough}}
+		}
+		for _, t := range succs[at] {
+			numEdges++
+			if l.limits.MaxEdges > 0 && numEdges > l.limits.MaxEdges {
+				return nil, fmt.Errorf("more than %d edges in %s", l.limits.MaxEdges, p.Name)
+			}
+			cfg.NewBasicBlockEdgeOfKind(g, block, t.to, t.kind)
+		}
+	}
+	if len(l.entries) > 0 {
+		g.SetEntries(append([]int{0}, l.entries...)...)
+	} else {
+		g.SetStart(0)
+	}
+	p.CFG = g
+	return p, nil
+}
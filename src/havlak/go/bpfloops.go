@@ -0,0 +1,73 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Loops of eBPF programs.
+//
+// Usage: bpfloops [-cfg] file.o ...
+//
+// Reports every loop of every program in the given BPF object files,
+// with the instruction index of its header and whether it is
+// irreducible, before the program is handed to the verifier. With
+// -cfg, the linked CFG of each program is printed first, in the
+// edge-list format.
+//
+// The fixtures in testdata/bpf are checked with 'make check-bpf'.
+//
+package main
+
+import "flag"
+import "fmt"
+import "os"
+import "./bpf"
+
+var printCFG = flag.Bool("cfg", false, "print the CFG of every program")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: bpfloops [-cfg] file.o ...\n")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bpfloops: %v\n", err)
+			status = 1
+			continue
+		}
+		progs, err := bpf.Read(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bpfloops: %s: %v\n", path, err)
+			status = 1
+			continue
+		}
+
+		for _, p := range progs {
+			if *printCFG {
+				if err := p.CFG.WriteEdgeList(os.Stdout); err != nil {
+					fmt.Fprintf(os.Stderr, "bpfloops: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if err := bpf.WriteReport(os.Stdout, p); err != nil {
+				fmt.Fprintf(os.Stderr, "bpfloops: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+	os.Exit(status)
+}
@@ -0,0 +1,246 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Conversion of CFGs between the formats they are stored in.
+//
+// Usage: cfgconv [-names int|uint|string] [-from fmt] [-to fmt] [-loops file.json] [-remove b|a->b ...] file
+//
+// Reads a CFG (or standard input, for "-") and writes it to standard
+// output. The formats are
+//
+//    edges     the edge-list format of package cfg
+//    json      the JSON encoding of package cfg
+//    dot       Graphviz, with the loops found by the Havlak loop
+//              finder drawn as clusters
+//    graphml   GraphML, as yEd and other graph editors read it
+//    loops     output only: the loops found by the Havlak loop
+//              finder, in the JSON encoding of package lsg
+//
+// The input format is taken from the file extension (.dot or .gv,
+// .graphml, .json, and edges for anything else) unless -from gives
+// it; the output is an edge list unless -to says otherwise. -names
+// is the type block names are read as. Any graph written in one
+// format reads back the same in another, provided its names and
+// labels are valid UTF-8 for JSON and GraphML; GraphML also refuses
+// empty names and control characters other than tab, newline and
+// carriage return. So
+//
+//    cfgconv -to graphml f.edges > f.graphml
+//
+// gives a graph to edit in yEd and 'cfgconv f.graphml' the edge list
+// of the edited one.
+//
+// Each -remove takes a block, with its edges, or one edge a->b out
+// of the graph before it is written, in the order given; removing the
+// virtual entry leaves the first entry as the only one.
+//
+// With -loops, the loops drawn by dot and written by loops are read
+// from a file of the loops format (or standard input, for "-")
+// instead of being found, so 'cfgconv -to loops' output converts back
+// to itself.
+//
+// The fixtures in testdata/graphs are checked with 'make
+// check-graphs'.
+//
+package main
+
+import "flag"
+import "fmt"
+import "io"
+import "os"
+import "path/filepath"
+import "strings"
+import "./basicblock"
+import "./lsg"
+import "./havlakloopfinder"
+import "./dot"
+import "./graphml"
+
+var names = flag.String("names", "int", "type of the block names: int, uint or string")
+var from = flag.String("from", "", "input format: edges, json, dot or graphml")
+var to = flag.String("to", "edges", "output format: edges, json, dot, graphml or loops")
+var loops = flag.String("loops", "", "read the loops from `file` instead of finding them")
+var removals []string
+
+func main() {
+	flag.Func("remove", "remove the block `b`, or one edge a->b; may be repeated", func(s string) error {
+		removals = append(removals, s)
+		return nil
+	})
+	flag.Parse()
+	if flag.NArg() != 1 || *loops == "-" && flag.Arg(0) == "-" {
+		fmt.Fprintf(os.Stderr, "usage: cfgconv [-names int|uint|string] [-from fmt] [-to fmt] [-loops file.json] [-remove b|a->b ...] file\n")
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+	format := *from
+	if format == "" {
+		switch filepath.Ext(path) {
+		case ".dot", ".gv":
+			format = "dot"
+		case ".graphml":
+			format = "graphml"
+		case ".json":
+			format = "json"
+		default:
+			format = "edges"
+		}
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cfgconv: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var err error
+	switch *names {
+	case "int":
+		err = convert[int](r, format, *to)
+	case "uint":
+		err = convert[uint64](r, format, *to)
+	case "string":
+		err = convert[string](r, format, *to)
+	default:
+		err = fmt.Errorf("unknown name type %q", *names)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cfgconv: %s: %v\n", path, err)
+		os.Exit(1)
+	}
+}
+
+func convert[K comparable](r io.Reader, from, to string) error {
+	var g *cfg.CFG[K]
+	var err error
+	switch from {
+	case "edges":
+		g, err = cfg.ReadEdgeList[K](r)
+	case "json":
+		var data []byte
+		if data, err = io.ReadAll(io.LimitReader(r, cfg.DefaultLimits.MaxBytes)); err == nil {
+			g = cfg.NewCFGOf[K]()
+			err = g.UnmarshalJSON(data)
+		}
+	case "dot":
+		g, err = dot.ReadCFG[K](r)
+	case "graphml":
+		g, err = graphml.ReadCFG[K](r)
+	default:
+		return fmt.Errorf("unknown input format %q", from)
+	}
+	if err != nil {
+		return err
+	}
+	for _, r := range removals {
+		if err := remove(g, r); err != nil {
+			return err
+		}
+	}
+	if len(removals) > 0 {
+		if err := g.ValidateStructure(); err != nil {
+			return err
+		}
+	}
+
+	switch to {
+	case "edges":
+		return g.WriteEdgeList(os.Stdout)
+	case "json":
+		data, err := g.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Printf("%s\n", data)
+		return err
+	case "dot":
+		lsgraph, err := findLoops(g)
+		if err != nil {
+			return err
+		}
+		return dot.WriteCFG(os.Stdout, g, lsgraph)
+	case "graphml":
+		return graphml.WriteCFG(os.Stdout, g)
+	case "loops":
+		lsgraph, err := findLoops(g)
+		if err != nil {
+			return err
+		}
+		data, err := lsgraph.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Printf("%s\n", data)
+		return err
+	}
+	return fmt.Errorf("unknown output format %q", to)
+}
+
+// remove takes the block or edge 'r' out of 'g'.
+//
+func remove[K comparable](g *cfg.CFG[K], r string) error {
+	if a, b, ok := strings.Cut(r, "->"); ok {
+		from, err := cfg.ParseName[K](a)
+		if err != nil {
+			return err
+		}
+		to, err := cfg.ParseName[K](b)
+		if err != nil {
+			return err
+		}
+		if !g.RemoveEdge(from, to) {
+			return fmt.Errorf("no edge %s", r)
+		}
+		return nil
+	}
+	name, err := cfg.ParseName[K](r)
+	if err != nil {
+		return err
+	}
+	if !g.RemoveBlock(name) {
+		return fmt.Errorf("no block %s", r)
+	}
+	return nil
+}
+
+// findLoops returns the loops of 'g', as read from -loops or found
+// by the Havlak loop finder.
+//
+func findLoops[K comparable](g *cfg.CFG[K]) (*lsg.LSG[K], error) {
+	if *loops == "" {
+		lsgraph := lsg.NewLSGOf[K]()
+		havlakloopfinder.FindHavlakLoops(g, lsgraph)
+		lsgraph.CalculateNestingLevel()
+		return lsgraph, nil
+	}
+	var r io.Reader = os.Stdin
+	if *loops != "-" {
+		f, err := os.Open(*loops)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := io.ReadAll(io.LimitReader(r, cfg.DefaultLimits.MaxBytes))
+	if err != nil {
+		return nil, err
+	}
+	return lsg.UnmarshalLSG(data, g)
+}
@@ -0,0 +1,208 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//======================================================
+// JSON Encoding
+//======================================================
+
+// A CFG marshals to a versioned JSON document:
+//
+//    {
+//      "version": 1,
+//      "entries": [0],
+//      "virtual_entry": -1,
+//      "blocks": [
+//        {"name": 0, "count": 1},
+//        {"name": 1}
+//      ],
+//      "edges": [
+//        {"from": 0, "to": 1, "kind": "taken", "label": "then", "weight": 1}
+//      ]
+//    }
+//
+// Block names are JSON values of the name type, numbers for int and
+// strings for string names, except that unsigned names are strings
+// in hex, as FormatName writes them: JSON numbers are doubles, and
+// cannot hold every 64-bit address. "entries" lists the entry
+// blocks; "virtual_entry" names the synthetic entry of a graph with
+// several and is omitted otherwise. The virtual entry and its edges
+// are not listed under "blocks" and "edges". "blocks" is in Blocks
+// order; "edges" is grouped by source block, each block's successors
+// in order. "count", "kind" (see EdgeKind.String; default
+// "fallthrough"), "label" and "weight" are omitted when zero.
+//
+// A document whose version is not CFGJSONVersion is rejected.
+
+package cfg
+
+import "encoding/json"
+import "fmt"
+
+// CFGJSONVersion is the version of the JSON schema written by
+// CFG.MarshalJSON.
+//
+const CFGJSONVersion = 1
+
+// JSONName is a block name in the JSON encodings of this package
+// and of package lsg.
+//
+type JSONName[K comparable] struct {
+	Name K
+}
+
+func (n JSONName[K]) MarshalJSON() ([]byte, error) {
+	if isUnsignedName(n.Name) {
+		return json.Marshal(FormatName(n.Name))
+	}
+	return json.Marshal(n.Name)
+}
+
+func (n *JSONName[K]) UnmarshalJSON(data []byte) error {
+	if !isUnsignedName(n.Name) {
+		return json.Unmarshal(data, &n.Name)
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("cfg: block name %s is not a string", data)
+	}
+	name, err := ParseName[K](s)
+	if err != nil {
+		return err
+	}
+	n.Name = name
+	return nil
+}
+
+type jsonCFG[K comparable] struct {
+	Version      int            `json:"version"`
+	Entries      []JSONName[K]  `json:"entries"`
+	VirtualEntry *JSONName[K]   `json:"virtual_entry,omitempty"`
+	Blocks       []jsonBlock[K] `json:"blocks"`
+	Edges        []jsonEdge[K]  `json:"edges"`
+}
+
+type jsonBlock[K comparable] struct {
+	Name  JSONName[K] `json:"name"`
+	Count int64       `json:"count,omitempty"`
+}
+
+type jsonEdge[K comparable] struct {
+	From   JSONName[K] `json:"from"`
+	To     JSONName[K] `json:"to"`
+	Kind   string      `json:"kind,omitempty"`
+	Label  string      `json:"label,omitempty"`
+	Weight int64       `json:"weight,omitempty"`
+}
+
+func (cfg *CFG[K]) MarshalJSON() ([]byte, error) {
+	doc := jsonCFG[K]{
+		Version: CFGJSONVersion,
+		Entries: []JSONName[K]{},
+		Blocks:  []jsonBlock[K]{},
+		Edges:   []jsonEdge[K]{},
+	}
+	for _, bb := range cfg.Entries() {
+		doc.Entries = append(doc.Entries, JSONName[K]{bb.Name()})
+	}
+	if cfg.virtualEntry != nil {
+		doc.VirtualEntry = &JSONName[K]{cfg.virtualEntry.Name()}
+	}
+
+	blocks := cfg.Blocks()
+	for _, bb := range blocks {
+		if bb != cfg.virtualEntry {
+			doc.Blocks = append(doc.Blocks, jsonBlock[K]{JSONName[K]{bb.Name()}, bb.Count()})
+		}
+	}
+	for _, bb := range blocks {
+		if bb == cfg.virtualEntry {
+			continue
+		}
+		for iter := bb.OutEdges().Front(); iter != nil; iter = iter.Next() {
+			edge := iter.Value.(*BasicBlockEdge[K])
+			e := jsonEdge[K]{From: JSONName[K]{bb.Name()}, To: JSONName[K]{edge.Dst().Name()},
+				Label: edge.Label(), Weight: edge.Weight()}
+			if edge.Kind() != EdgeFallthrough {
+				e.Kind = edge.Kind().String()
+			}
+			doc.Edges = append(doc.Edges, e)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON replaces the contents of 'cfg' with the graph in
+// 'data'. Every block must be listed under "blocks" exactly once.
+//
+func (cfg *CFG[K]) UnmarshalJSON(data []byte) error {
+	var doc jsonCFG[K]
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc.Version != CFGJSONVersion {
+		return fmt.Errorf("cfg: unsupported JSON version %d", doc.Version)
+	}
+
+	g := NewCFGOf[K]()
+	for _, b := range doc.Blocks {
+		if g.bb[b.Name.Name] != nil {
+			return fmt.Errorf("cfg: block %s listed twice", FormatName(b.Name.Name))
+		}
+		g.CreateNode(b.Name.Name).SetCount(b.Count)
+	}
+	for _, e := range doc.Edges {
+		from, to := e.From.Name, e.To.Name
+		if g.bb[from] == nil || g.bb[to] == nil {
+			return fmt.Errorf("cfg: edge %s -> %s between unlisted blocks",
+				FormatName(from), FormatName(to))
+		}
+		kind := EdgeFallthrough
+		if e.Kind != "" {
+			var ok bool
+			if kind, ok = ParseEdgeKind(e.Kind); !ok {
+				return fmt.Errorf("cfg: unknown edge kind %q", e.Kind)
+			}
+		}
+		edge := NewBasicBlockEdgeOfKind(g, from, to, kind)
+		edge.SetLabel(e.Label)
+		edge.SetWeight(e.Weight)
+	}
+
+	entries := make([]K, 0, len(doc.Entries))
+	for _, n := range doc.Entries {
+		if g.bb[n.Name] == nil {
+			return fmt.Errorf("cfg: entry %s is not a listed block", FormatName(n.Name))
+		}
+		entries = append(entries, n.Name)
+	}
+	switch {
+	case doc.VirtualEntry != nil && len(distinct(entries)) < 2:
+		return fmt.Errorf("cfg: virtual entry given for fewer than two entries")
+	case doc.VirtualEntry != nil:
+		virtual := doc.VirtualEntry.Name
+		if g.bb[virtual] != nil {
+			return fmt.Errorf("cfg: virtual entry %s is also a listed block",
+				FormatName(virtual))
+		}
+		g.SetEntriesNamed(virtual, entries...)
+	case len(entries) > 0:
+		g.SetEntries(entries...)
+	}
+	if err := g.ValidateStructure(); err != nil {
+		return fmt.Errorf("cfg: %v", err)
+	}
+
+	*cfg = *g
+	return nil
+}
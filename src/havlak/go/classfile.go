@@ -0,0 +1,569 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Control flow graphs from JVM class files.
+//
+// Read decodes a .class file and builds a CFG for the Code attribute
+// of every method that has one. Blocks are named by the bytecode
+// offset of their first instruction, as javap -c prints them. A
+// block starts at offset 0, at every branch target and exception
+// handler, at both ends of every range the exception table
+// protects, and after every instruction that does not simply fall
+// through. The edges are:
+//
+//    if<cond>, ifnull, ifnonnull
+//                            target taken, next fallthrough
+//    goto, goto_w            target fallthrough
+//    tableswitch             case, labeled by the key or "default"
+//    lookupswitch            case, labeled by the key or "default"
+//    jsr, jsr_w              target taken, next call-return
+//    <t>return, athrow, ret  no successors
+//
+// Every block inside the range of an exception table entry gets an
+// exceptional edge to its handler, labeled with the caught class
+// ("java/io/IOException"), or "any" for a finally block.
+//
+package classfile
+
+import "fmt"
+import "io"
+import "strconv"
+import "./basicblock"
+
+// Method is the CFG of one method with code.
+//
+type Method struct {
+	Class      string // internal form, "java/lang/Object"
+	Name       string
+	Descriptor string // "(I[J)V"
+	CFG        *cfg.CFG[int]
+}
+
+// FormatError is a decoding error at a particular offset of the
+// class file.
+//
+type FormatError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("offset %#x: %s", e.Offset, e.Msg)
+}
+
+// Read decodes a class file with cfg.DefaultLimits, applying
+// MaxBlocks and MaxEdges to each method.
+//
+func Read(r io.Reader) ([]*Method, error) {
+	return ReadLimits(r, cfg.DefaultLimits)
+}
+
+// ReadLimits decodes a class file, failing if it is larger than
+// limits.MaxBytes or a method exceeds the other limits.
+//
+func ReadLimits(r io.Reader, limits cfg.Limits) ([]*Method, error) {
+	if limits.MaxBytes > 0 {
+		r = io.LimitReader(r, limits.MaxBytes+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxBytes > 0 && int64(len(data)) > limits.MaxBytes {
+		return nil, fmt.Errorf("input larger than %d bytes", limits.MaxBytes)
+	}
+	return Decode(data, limits)
+}
+
+// Decode is ReadLimits for a class file already in memory.
+//
+func Decode(data []byte, limits cfg.Limits) ([]*Method, error) {
+	d := &decoder{data: data, limits: limits}
+	methods := d.class()
+	if d.err != nil {
+		return nil, d.err
+	}
+	return methods, nil
+}
+
+//-----------------------------------------------------------
+
+// decoder reads the class file. The first error sticks: later reads
+// return zero values, so callers check err only where it matters.
+//
+type decoder struct {
+	data   []byte
+	pos    int
+	err    error
+	limits cfg.Limits
+
+	utf8    map[int]string // constant pool strings
+	classes map[int]int    // Class entries, to their name's index
+}
+
+func (d *decoder) fail(offset int, format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = &FormatError{Offset: offset, Msg: fmt.Sprintf(format, args...)}
+	}
+	d.pos = len(d.data)
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if n < 0 || n > len(d.data)-d.pos {
+		d.fail(d.pos, "unexpected end")
+		return nil
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) u1() int {
+	b := d.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return int(b[0])
+}
+
+func (d *decoder) u2() int {
+	b := d.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return int(b[0])<<8 | int(b[1])
+}
+
+func (d *decoder) u4() int {
+	b := d.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return int(uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]))
+}
+
+// utf8At returns the string of a Utf8 constant. Class files use a
+// modified UTF-8, which for names is plain UTF-8 in practice.
+//
+func (d *decoder) utf8At(index int) string {
+	s, ok := d.utf8[index]
+	if !ok {
+		d.fail(d.pos, "constant %d is not a Utf8", index)
+	}
+	return s
+}
+
+func (d *decoder) classAt(index int) string {
+	name, ok := d.classes[index]
+	if !ok {
+		d.fail(d.pos, "constant %d is not a Class", index)
+		return ""
+	}
+	return d.utf8At(name)
+}
+
+func (d *decoder) class() []*Method {
+	if d.u4() != 0xcafebabe || d.err != nil {
+		d.err = &FormatError{Offset: 0, Msg: "not a class file"}
+		return nil
+	}
+	d.u2() // minor_version
+	d.u2() // major_version
+	d.constantPool()
+	d.u2() // access_flags
+	this := d.classAt(d.u2())
+	d.u2() // super_class
+	d.bytes(2 * d.u2())
+
+	for n := d.u2(); n > 0 && d.err == nil; n-- {
+		d.member(this)
+	}
+	var methods []*Method
+	for n := d.u2(); n > 0 && d.err == nil; n-- {
+		if m := d.member(this); m != nil {
+			methods = append(methods, m)
+		}
+	}
+	for n := d.u2(); n > 0 && d.err == nil; n-- {
+		d.u2()
+		d.bytes(d.u4())
+	}
+	if d.err == nil && d.pos != len(d.data) {
+		d.fail(d.pos, "data after the end of the class")
+	}
+	return methods
+}
+
+func (d *decoder) constantPool() {
+	d.utf8 = make(map[int]string)
+	d.classes = make(map[int]int)
+	count := d.u2()
+	for i := 1; i < count && d.err == nil; i++ {
+		switch tag := d.u1(); tag {
+		case 1: // Utf8
+			d.utf8[i] = string(d.bytes(d.u2()))
+		case 7: // Class
+			d.classes[i] = d.u2()
+		case 8, 16, 19, 20: // String, MethodType, Module, Package
+			d.u2()
+		case 15: // MethodHandle
+			d.u1()
+			d.u2()
+		case 3, 4, 9, 10, 11, 12, 17, 18:
+			d.u4()
+		case 5, 6: // Long and Double take two entries
+			d.bytes(8)
+			i++
+		default:
+			d.fail(d.pos-1, "unknown constant pool tag %d", tag)
+		}
+	}
+}
+
+// member reads a field_info or method_info, returning the CFG of
+// a method with a Code attribute.
+//
+func (d *decoder) member(class string) *Method {
+	d.u2() // access_flags
+	name := d.utf8At(d.u2())
+	descriptor := d.utf8At(d.u2())
+	var m *Method
+	for n := d.u2(); n > 0 && d.err == nil; n-- {
+		attr := d.utf8At(d.u2())
+		length := d.u4()
+		start := d.pos
+		body := d.bytes(length)
+		if attr != "Code" || d.err != nil {
+			continue
+		}
+		m = &Method{Class: class, Name: name, Descriptor: descriptor}
+		code := *d
+		code.data, code.pos = d.data[:start+len(body)], start
+		m.CFG = code.code(m)
+		if code.err != nil {
+			d.err = code.err
+			return nil
+		}
+	}
+	return m
+}
+
+//-----------------------------------------------------------
+
+// flow is what an instruction does with control.
+//
+type flow int
+
+const (
+	flowNext   flow = iota // continues with the next instruction
+	flowCond               // conditional branch
+	flowGoto               // unconditional branch
+	flowSwitch             // tableswitch or lookupswitch
+	flowJsr                // call of a subroutine
+	flowStop               // return, athrow, ret
+)
+
+type target struct {
+	pc    int
+	label string // of a switch case
+}
+
+type instruction struct {
+	pc      int
+	flow    flow
+	targets []target
+}
+
+type handler struct {
+	start, end, pc int
+	class          string
+}
+
+// lengths of the instructions longer than one byte; init fills in
+// the rest, leaving 0 for the variable-length ones.
+var lengths = [256]int{
+	0x10: 2, 0x11: 3, 0x12: 2, 0x13: 3, 0x14: 3,
+	0x15: 2, 0x16: 2, 0x17: 2, 0x18: 2, 0x19: 2,
+	0x36: 2, 0x37: 2, 0x38: 2, 0x39: 2, 0x3a: 2,
+	0x84: 3, 0xa9: 2,
+	0xb2: 3, 0xb3: 3, 0xb4: 3, 0xb5: 3, 0xb6: 3, 0xb7: 3, 0xb8: 3,
+	0xb9: 5, 0xba: 5, 0xbb: 3, 0xbc: 2, 0xbd: 3, 0xc0: 3, 0xc1: 3,
+	0xc4: 0, 0xc5: 4, 0xc8: 5, 0xc9: 5,
+}
+
+const (
+	opIfeq         = 0x99
+	opIfAcmpne     = 0xa6
+	opGoto         = 0xa7
+	opJsr          = 0xa8
+	opRet          = 0xa9
+	opTableswitch  = 0xaa
+	opLookupswitch = 0xab
+	opIreturn      = 0xac
+	opReturn       = 0xb1
+	opAthrow       = 0xbf
+	opWide         = 0xc4
+	opIfnull       = 0xc6
+	opIfnonnull    = 0xc7
+	opGotoW        = 0xc8
+	opJsrW         = 0xc9
+	opLast         = 0xc9
+)
+
+func init() {
+	for op := 0; op <= opLast; op++ {
+		if lengths[op] == 0 && op != opTableswitch && op != opLookupswitch && op != opWide {
+			lengths[op] = 1
+		}
+	}
+	for op := opIfeq; op <= opJsr; op++ {
+		lengths[op] = 3
+	}
+	lengths[opIfnull], lengths[opIfnonnull] = 3, 3
+}
+
+// code decodes a Code attribute into the CFG of method 'm'.
+//
+func (d *decoder) code(m *Method) *cfg.CFG[int] {
+	d.u2() // max_stack
+	d.u2() // max_locals
+	length := d.u4()
+	base := d.pos
+	code := d.bytes(length)
+	if d.err != nil {
+		return nil
+	}
+	if length == 0 {
+		d.fail(base, "empty code in %s", m.Name)
+		return nil
+	}
+
+	var handlers []handler
+	for n := d.u2(); n > 0 && d.err == nil; n-- {
+		h := handler{start: d.u2(), end: d.u2(), pc: d.u2(), class: "any"}
+		if catch := d.u2(); catch != 0 {
+			h.class = d.classAt(catch)
+		}
+		handlers = append(handlers, h)
+	}
+	if d.err != nil {
+		return nil
+	}
+
+	insns := decodeInstructions(code)
+	if insns == nil {
+		d.fail(base, "truncated or unknown instruction in %s", m.Name)
+		return nil
+	}
+	return d.build(m, base, code, insns, handlers)
+}
+
+// decodeInstructions splits the bytecode into instructions and
+// finds their branch targets. It returns nil for malformed code.
+//
+func decodeInstructions(code []byte) []instruction {
+	s4 := func(pc int) int {
+		return int(int32(uint32(code[pc])<<24 | uint32(code[pc+1])<<16 | uint32(code[pc+2])<<8 | uint32(code[pc+3])))
+	}
+	var insns []instruction
+	for pc := 0; pc < len(code); {
+		op := int(code[pc])
+		insn := instruction{pc: pc}
+		size := lengths[op]
+		switch {
+		case op > opLast:
+			return nil
+		case op == opWide:
+			if pc+1 >= len(code) {
+				return nil
+			}
+			size = 4
+			if code[pc+1] == 0x84 {
+				size = 6
+			}
+		case op == opTableswitch || op == opLookupswitch:
+			p := pc + 4 - pc%4 // after the padding
+			if p+12 > len(code) {
+				return nil
+			}
+			deflt := pc + s4(p)
+			if op == opTableswitch {
+				low, high := s4(p+4), s4(p+8)
+				if high < low || (high-low+1) > (len(code)-p-12)/4 {
+					return nil
+				}
+				for i := 0; i <= high-low; i++ {
+					key := strconv.Itoa(low + i)
+					insn.targets = append(insn.targets, target{pc + s4(p+12+4*i), key})
+				}
+				size = p + 12 + 4*(high-low+1) - pc
+			} else {
+				npairs := s4(p + 4)
+				if npairs < 0 || npairs > (len(code)-p-8)/8 {
+					return nil
+				}
+				for i := 0; i < npairs; i++ {
+					key := strconv.Itoa(s4(p + 8 + 8*i))
+					insn.targets = append(insn.targets, target{pc + s4(p+12+8*i), key})
+				}
+				size = p + 8 + 8*npairs - pc
+			}
+			insn.targets = append(insn.targets, target{deflt, "default"})
+			insn.flow = flowSwitch
+		}
+		if pc+size > len(code) {
+			return nil
+		}
+
+		switch {
+		case op >= opIfeq && op <= opIfAcmpne || op == opIfnull || op == opIfnonnull:
+			insn.flow = flowCond
+		case op == opGoto || op == opGotoW:
+			insn.flow = flowGoto
+		case op == opJsr || op == opJsrW:
+			insn.flow = flowJsr
+		case op >= opIreturn && op <= opReturn || op == opAthrow || op == opRet:
+			insn.flow = flowStop
+		}
+		switch {
+		case op == opGotoW || op == opJsrW:
+			insn.targets = []target{{pc: pc + s4(pc+1)}}
+		case insn.flow == flowCond || insn.flow == flowGoto || insn.flow == flowJsr:
+			insn.targets = []target{{pc: pc + int(int16(uint16(code[pc+1])<<8|uint16(code[pc+2])))}}
+		}
+		insns = append(insns, insn)
+		pc += size
+	}
+	return insns
+}
+
+// build finds the leaders and links the blocks.
+//
+func (d *decoder) build(m *Method, base int, code []byte, insns []instruction, handlers []handler) *cfg.CFG[int] {
+	index := make(map[int]int, len(insns))
+	for i, insn := range insns {
+		index[insn.pc] = i
+	}
+	leader := make([]bool, len(insns))
+	mark := func(pc int, what string) bool {
+		i, ok := index[pc]
+		if !ok {
+			d.fail(base+pc, "%s %d in %s is not an instruction", what, pc, m.Name)
+			return false
+		}
+		leader[i] = true
+		return true
+	}
+
+	leader[0] = true
+	for i, insn := range insns {
+		for _, t := range insn.targets {
+			if !mark(t.pc, "branch target") {
+				return nil
+			}
+		}
+		if insn.flow != flowNext && i+1 < len(insns) {
+			leader[i+1] = true
+		}
+	}
+	for _, h := range handlers {
+		if h.start >= h.end {
+			d.fail(base, "empty exception range in %s", m.Name)
+			return nil
+		}
+		if !mark(h.start, "try start") || !mark(h.pc, "handler") ||
+			h.end < len(code) && !mark(h.end, "try end") {
+			return nil
+		}
+	}
+
+	g := cfg.NewCFGOf[int]()
+	for i, insn := range insns {
+		if leader[i] {
+			if d.limits.MaxBlocks > 0 && g.NumNodes() >= d.limits.MaxBlocks {
+				d.fail(base+insn.pc, "more than %d blocks in %s", d.limits.MaxBlocks, m.Name)
+				return nil
+			}
+			g.CreateNode(insn.pc)
+		}
+	}
+
+	numEdges := 0
+	edge := func(from, to int, kind cfg.EdgeKind, label string) bool {
+		numEdges++
+		if d.limits.MaxEdges > 0 && numEdges > d.limits.MaxEdges {
+			d.fail(base+from, "more than %d edges in %s", d.limits.MaxEdges, m.Name)
+			return false
+		}
+		cfg.NewBasicBlockEdgeOfKind(g, from, to, kind).SetLabel(label)
+		return true
+	}
+
+	block := 0
+	for i, insn := range insns {
+		if leader[i] {
+			block = insn.pc
+		}
+		if i+1 < len(insns) && !leader[i+1] {
+			continue
+		}
+		next := -1
+		if i+1 < len(insns) {
+			next = insns[i+1].pc
+		}
+		ok := true
+		switch insn.flow {
+		case flowNext, flowCond, flowJsr:
+			if next < 0 {
+				d.fail(base+insn.pc, "%s falls off the end of its code", m.Name)
+				return nil
+			}
+		}
+		switch insn.flow {
+		case flowNext:
+			ok = edge(block, next, cfg.EdgeFallthrough, "")
+		case flowCond:
+			ok = edge(block, insn.targets[0].pc, cfg.EdgeTaken, "") &&
+				edge(block, next, cfg.EdgeFallthrough, "")
+		case flowGoto:
+			ok = edge(block, insn.targets[0].pc, cfg.EdgeFallthrough, "")
+		case flowJsr:
+			ok = edge(block, insn.targets[0].pc, cfg.EdgeTaken, "") &&
+				edge(block, next, cfg.EdgeCallReturn, "")
+		case flowSwitch:
+			for _, t := range insn.targets {
+				if ok = edge(block, t.pc, cfg.EdgeSwitchCase, t.label); !ok {
+					break
+				}
+			}
+		}
+		if !ok {
+			return nil
+		}
+
+		// One exceptional edge per handler, for the first entry
+		// that covers the block.
+		seen := make(map[int]bool)
+		for _, h := range handlers {
+			if block >= h.start && block < h.end && !seen[h.pc] {
+				seen[h.pc] = true
+				if !edge(block, h.pc, cfg.EdgeExceptional, h.class) {
+					return nil
+				}
+			}
+		}
+	}
+	g.SetStart(0)
+	return g
+}
@@ -0,0 +1,123 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//======================================================
+// Control Dependence
+//======================================================
+
+// Block 'b' is control dependent on the edge u -> v if taking that
+// edge makes 'b' certain to run while 'u' itself does not: 'b'
+// post-dominates 'v' but does not strictly post-dominate 'u'. The
+// blocks dependent on u -> v are thus those on the path up the
+// post-dominator tree from 'v' to the immediate post-dominator of
+// 'u', not included (Ferrante, Ottenstein and Warren).
+//
+// A loop header depends on the edges that branch back into the loop,
+// and the blocks of an infinite loop on the branches of its header,
+// whose synthetic edge to the exit makes it a branch even when it
+// has a single successor. Blocks that only ever run once the
+// function is entered depend on nothing; the entries of a graph with
+// several depend on the edges of its virtual entry.
+
+package dominators
+
+import "fmt"
+import "io"
+import "strconv"
+import "strings"
+import "./basicblock"
+
+// ControlDeps is the control dependence graph of a CFG.
+//
+type ControlDeps[K comparable] struct {
+	cfgraph  *cfg.CFG[K]
+	deps     map[*cfg.BasicBlock[K]][]*cfg.BasicBlockEdge[K]
+	controls map[*cfg.BasicBlockEdge[K]][]*cfg.BasicBlock[K]
+}
+
+// ComputeControlDeps builds the control dependence graph of
+// 'cfgraph' from its post-dominator tree.
+//
+func ComputeControlDeps[K comparable](cfgraph *cfg.CFG[K], post *PostTree[K]) *ControlDeps[K] {
+	c := &ControlDeps[K]{
+		cfgraph:  cfgraph,
+		deps:     make(map[*cfg.BasicBlock[K]][]*cfg.BasicBlockEdge[K]),
+		controls: make(map[*cfg.BasicBlockEdge[K]][]*cfg.BasicBlock[K]),
+	}
+	tree := post.tree
+	for _, u := range cfgraph.Blocks() {
+		ru := post.backward[u]
+		if !tree.Reachable(ru) {
+			continue
+		}
+		stop := tree.Idom(ru)
+		for ll := u.OutEdges().Front(); ll != nil; ll = ll.Next() {
+			edge := ll.Value.(*cfg.BasicBlockEdge[K])
+			rv := post.backward[edge.Dst()]
+			if !tree.Reachable(rv) || tree.StrictlyDominates(rv, ru) {
+				continue
+			}
+			for r := rv; r != nil && r != stop; r = tree.Idom(r) {
+				bb := post.forward[r]
+				c.deps[bb] = append(c.deps[bb], edge)
+				c.controls[edge] = append(c.controls[edge], bb)
+			}
+		}
+	}
+	return c
+}
+
+// DependsOn returns the edges 'bb' is control dependent on, grouped
+// by source block in Blocks order, each block's edges in successor
+// order.
+//
+func (c *ControlDeps[K]) DependsOn(bb *cfg.BasicBlock[K]) []*cfg.BasicBlockEdge[K] {
+	return c.deps[bb]
+}
+
+// Controls returns the blocks control dependent on 'edge', from its
+// target up the post-dominator tree.
+//
+func (c *ControlDeps[K]) Controls(edge *cfg.BasicBlockEdge[K]) []*cfg.BasicBlock[K] {
+	return c.controls[edge]
+}
+
+// WriteDeps prints the blocks that depend on some edge, in Blocks
+// order, with the edges they depend on:
+//
+//    2: 1->2 (taken "then")
+//    4: 1->3, 3->4 (case "7")
+//
+func (c *ControlDeps[K]) WriteDeps(w io.Writer) error {
+	for _, bb := range c.cfgraph.Blocks() {
+		deps := c.deps[bb]
+		if len(deps) == 0 {
+			continue
+		}
+		edges := make([]string, len(deps))
+		for i, edge := range deps {
+			edges[i] = cfg.BlockName(edge.Src()) + "->" + cfg.BlockName(edge.Dst())
+			switch {
+			case edge.Label() != "":
+				edges[i] += fmt.Sprintf(" (%v %s)", edge.Kind(), strconv.Quote(edge.Label()))
+			case edge.Kind() != cfg.EdgeFallthrough:
+				edges[i] += fmt.Sprintf(" (%v)", edge.Kind())
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s\n", cfg.BlockName(bb), strings.Join(edges, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Dominator trees of control flow graphs.
+//
+// Block 'a' dominates block 'b' if every path from the start node to
+// 'b' goes through 'a'. The immediate dominators are computed with
+// the Semi-NCA algorithm (Georgiadis, Tarjan et al.), which finds the
+// semidominators as Lengauer and Tarjan do and then the immediate
+// dominators as nearest common ancestors in the DFS tree. It is
+// near-linear and, in practice, faster than the full Lengauer-Tarjan
+// algorithm on CFGs.
+//
+// The tree is then numbered in depth-first order, so that, as in the
+// isAncestor test of the Havlak loop finder, 'a' dominates 'b'
+// exactly when the number of 'b' falls between that of 'a' and the
+// last number in the subtree of 'a'; Dominates takes constant time.
+//
+// Graphs with several entries are analyzed from their virtual entry,
+// which then dominates every reachable block. Blocks unreachable from
+// the start node are not in the tree.
+//
+package dominators
+
+import "container/list"
+import "fmt"
+import "io"
+import "strings"
+import "./basicblock"
+
+// Tree is the dominator tree of a CFG. It is not updated when the
+// graph changes.
+//
+type Tree[K comparable] struct {
+	number   map[*cfg.BasicBlock[K]]int // DFS preorder number in the CFG
+	vertex   []*cfg.BasicBlock[K]       // by number
+	idom     []int                      // by number, -1 for the root
+	children [][]int                    // by number, in preorder
+	pre      []int                      // preorder number in the tree
+	last     []int                      // largest pre in the subtree
+	depth    []int                      // in the tree
+}
+
+// Compute builds the dominator tree of 'cfgraph' from its start
+// node. A graph without a start node has an empty tree.
+//
+func Compute[K comparable](cfgraph *cfg.CFG[K]) *Tree[K] {
+	t := &Tree[K]{number: make(map[*cfg.BasicBlock[K]]int)}
+	start := cfgraph.StartBasicBlock()
+	if start == nil {
+		return t
+	}
+
+	// Step 1: number the reachable blocks in DFS preorder, keeping
+	// each one's parent in the DFS tree. The search is iterative,
+	// since a long chain of blocks would overflow a recursive one.
+	//
+	var parent []int
+	type frame struct {
+		node int
+		next *list.Element // the next out-edge to follow
+	}
+	visit := func(bb *cfg.BasicBlock[K], from int) frame {
+		n := len(t.vertex)
+		t.number[bb] = n
+		t.vertex = append(t.vertex, bb)
+		parent = append(parent, from)
+		return frame{n, bb.OutEdges().Front()}
+	}
+	stack := []frame{visit(start, -1)}
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.next == nil {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		dst := top.next.Value.(*cfg.BasicBlockEdge[K]).Dst()
+		top.next = top.next.Next()
+		if _, seen := t.number[dst]; !seen {
+			stack = append(stack, visit(dst, top.node))
+		}
+	}
+	size := len(t.vertex)
+
+	// Step 2: semidominators, in reverse preorder. eval(v) gives
+	// the vertex of smallest semidominator on the path from v up to
+	// the nearest vertex not yet linked, compressing the path as it
+	// goes.
+	//
+	semi := make([]int, size)
+	label := make([]int, size)
+	ancestor := make([]int, size)
+	for i := range semi {
+		semi[i] = i
+		label[i] = i
+		ancestor[i] = -1
+	}
+	var path []int
+	eval := func(v int) int {
+		if ancestor[v] == -1 {
+			return v
+		}
+		path = path[:0]
+		for u := v; ancestor[ancestor[u]] != -1; u = ancestor[u] {
+			path = append(path, u)
+		}
+		for i := len(path) - 1; i >= 0; i-- {
+			u := path[i]
+			a := ancestor[u]
+			if semi[label[a]] < semi[label[u]] {
+				label[u] = label[a]
+			}
+			ancestor[u] = ancestor[a]
+		}
+		return label[v]
+	}
+	for w := size - 1; w > 0; w-- {
+		for ll := t.vertex[w].InEdges().Front(); ll != nil; ll = ll.Next() {
+			v, ok := t.number[ll.Value.(*cfg.BasicBlockEdge[K]).Src()]
+			if !ok {
+				continue // unreachable
+			}
+			if u := eval(v); semi[u] < semi[w] {
+				semi[w] = semi[u]
+			}
+		}
+		ancestor[w] = parent[w]
+	}
+
+	// Step 3: the immediate dominator of w is the nearest common
+	// ancestor of its semidominator and its DFS parent, which is
+	// found walking up from the parent through the immediate
+	// dominators already known.
+	//
+	t.idom = make([]int, size)
+	t.idom[0] = -1
+	for w := 1; w < size; w++ {
+		d := parent[w]
+		for d > semi[w] {
+			d = t.idom[d]
+		}
+		t.idom[w] = d
+	}
+
+	// Step 4: children lists and the interval numbering of the tree.
+	//
+	t.children = make([][]int, size)
+	for w := 1; w < size; w++ {
+		t.children[t.idom[w]] = append(t.children[t.idom[w]], w)
+	}
+	t.pre = make([]int, size)
+	t.last = make([]int, size)
+	t.depth = make([]int, size)
+	order := []int{0}
+	for n := 0; len(order) > 0; n++ {
+		v := order[len(order)-1]
+		order = order[:len(order)-1]
+		t.pre[v] = n
+		for i := len(t.children[v]) - 1; i >= 0; i-- {
+			c := t.children[v][i]
+			t.depth[c] = t.depth[v] + 1
+			order = append(order, c)
+		}
+	}
+	for v := size - 1; v >= 0; v-- {
+		if t.last[v] < t.pre[v] {
+			t.last[v] = t.pre[v]
+		}
+		if p := t.idom[v]; p >= 0 && t.last[p] < t.last[v] {
+			t.last[p] = t.last[v]
+		}
+	}
+	return t
+}
+
+// Root returns the start node the tree was computed from, or nil.
+//
+func (t *Tree[K]) Root() *cfg.BasicBlock[K] {
+	if len(t.vertex) == 0 {
+		return nil
+	}
+	return t.vertex[0]
+}
+
+// Reachable reports whether 'bb' is in the tree.
+//
+func (t *Tree[K]) Reachable(bb *cfg.BasicBlock[K]) bool {
+	_, ok := t.number[bb]
+	return ok
+}
+
+// Idom returns the immediate dominator of 'bb', or nil for the root
+// and for unreachable blocks.
+//
+func (t *Tree[K]) Idom(bb *cfg.BasicBlock[K]) *cfg.BasicBlock[K] {
+	if n, ok := t.number[bb]; ok && n > 0 {
+		return t.vertex[t.idom[n]]
+	}
+	return nil
+}
+
+// Children returns the blocks immediately dominated by 'bb', in the
+// order the depth-first search reached them.
+//
+func (t *Tree[K]) Children(bb *cfg.BasicBlock[K]) []*cfg.BasicBlock[K] {
+	n, ok := t.number[bb]
+	if !ok {
+		return nil
+	}
+	children := make([]*cfg.BasicBlock[K], len(t.children[n]))
+	for i, c := range t.children[n] {
+		children[i] = t.vertex[c]
+	}
+	return children
+}
+
+// Blocks returns the reachable blocks in preorder of the tree, each
+// block before the blocks it dominates.
+//
+func (t *Tree[K]) Blocks() []*cfg.BasicBlock[K] {
+	blocks := make([]*cfg.BasicBlock[K], len(t.vertex))
+	for n, bb := range t.vertex {
+		blocks[t.pre[n]] = bb
+	}
+	return blocks
+}
+
+// Dominates reports whether 'a' dominates 'b'. Every block dominates
+// itself; unreachable blocks dominate nothing and are dominated by
+// nothing.
+//
+func (t *Tree[K]) Dominates(a, b *cfg.BasicBlock[K]) bool {
+	na, ok := t.number[a]
+	if !ok {
+		return false
+	}
+	nb, ok := t.number[b]
+	if !ok {
+		return false
+	}
+	return t.pre[na] <= t.pre[nb] && t.pre[nb] <= t.last[na]
+}
+
+// StrictlyDominates reports whether 'a' dominates 'b' and is not 'b'.
+//
+func (t *Tree[K]) StrictlyDominates(a, b *cfg.BasicBlock[K]) bool {
+	return a != b && t.Dominates(a, b)
+}
+
+// Depth returns the depth of 'bb' in the tree, 0 for the root, or -1
+// if it is unreachable.
+//
+func (t *Tree[K]) Depth(bb *cfg.BasicBlock[K]) int {
+	if n, ok := t.number[bb]; ok {
+		return t.depth[n]
+	}
+	return -1
+}
+
+// WriteTree prints the tree, one block per line indented by depth,
+// each block's children in the order Children returns them:
+//
+//    0
+//      1
+//        2
+//        5
+//
+// Unreachable blocks are listed last, as "unreachable 7 8".
+//
+func (t *Tree[K]) WriteTree(w io.Writer, cfgraph *cfg.CFG[K]) error {
+	return t.writeTree(w, cfgraph, "unreachable", cfg.BlockName[K])
+}
+
+func (t *Tree[K]) writeTree(w io.Writer, cfgraph *cfg.CFG[K], dead string, name func(*cfg.BasicBlock[K]) string) error {
+	for _, bb := range t.Blocks() {
+		indent := strings.Repeat("  ", t.Depth(bb))
+		if _, err := fmt.Fprintf(w, "%s%s\n", indent, name(bb)); err != nil {
+			return err
+		}
+	}
+	var rest []string
+	for _, bb := range cfgraph.Blocks() {
+		if !t.Reachable(bb) {
+			rest = append(rest, name(bb))
+		}
+	}
+	if len(rest) > 0 {
+		if _, err := fmt.Fprintf(w, "%s %s\n", dead, strings.Join(rest, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Dominator trees of CFGs stored as edge lists.
+//
+// Usage: domtree [-names int|uint|string] [-post | -cdg | -df | -phi file.defs] file.edges ...
+//
+// Reads each CFG in the edge-list format of package cfg (or standard
+// input, for "-") and prints its dominator tree, one block per line
+// indented under its immediate dominator. With -post, it prints the
+// post-dominator tree instead, with -cdg the control dependences of
+// every block, and with -df the dominance frontier of every block.
+//
+// With -phi, it prints the blocks that need a phi node for each
+// variable of 'file.defs', marking the headers of the loops the
+// Havlak loop finder reports. The file has one record per line:
+//
+//    def <variable> <block> ...    the blocks assigning the variable
+//    live <block> <variable> ...   the variables live into the block
+//
+// and '#' starts a comment. Given any live records, the phis are
+// pruned to the live variables. The phis are then checked against the
+// loops: every header of a loop assigning a variable that is live into
+// it must have a phi for it, and every phi not on a loop header must
+// be on a join. Each mismatch is reported on standard error, and the
+// exit status is 1.
+//
+// The fixtures in testdata/dom are checked with 'make check-dom'.
+//
+package main
+
+import "bufio"
+import "errors"
+import "flag"
+import "fmt"
+import "io"
+import "os"
+import "sort"
+import "strings"
+import "./basicblock"
+import "./lsg"
+import "./havlakloopfinder"
+import "./dominators"
+
+var names = flag.String("names", "int", "type of the block names: int, uint or string")
+var post = flag.Bool("post", false, "print the post-dominator tree")
+var cdg = flag.Bool("cdg", false, "print the control dependences")
+var df = flag.Bool("df", false, "print the dominance frontiers")
+var phi = flag.String("phi", "", "print the phi nodes needed for the variables in `file`")
+
+func main() {
+	flag.Parse()
+	modes := 0
+	for _, on := range []bool{*post, *cdg, *df, *phi != ""} {
+		if on {
+			modes++
+		}
+	}
+	if flag.NArg() == 0 || modes > 1 {
+		fmt.Fprintf(os.Stderr, "usage: domtree [-names int|uint|string] [-post | -cdg | -df | -phi file.defs] file.edges ...\n")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		f := os.Stdin
+		if path != "-" {
+			var err error
+			if f, err = os.Open(path); err != nil {
+				fmt.Fprintf(os.Stderr, "domtree: %v\n", err)
+				status = 1
+				continue
+			}
+		}
+		var err error
+		switch *names {
+		case "int":
+			err = report[int](f)
+		case "uint":
+			err = report[uint64](f)
+		case "string":
+			err = report[string](f)
+		default:
+			err = fmt.Errorf("unknown name type %q", *names)
+		}
+		if f != os.Stdin {
+			f.Close()
+		}
+		if err != nil {
+			for _, line := range strings.Split(err.Error(), "\n") {
+				fmt.Fprintf(os.Stderr, "domtree: %s: %s\n", path, line)
+			}
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+func report[K comparable](r io.Reader) error {
+	g, err := cfg.ReadEdgeList[K](r)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *post:
+		return dominators.ComputePost(g).WriteTree(os.Stdout)
+	case *cdg:
+		return dominators.ComputeControlDeps(g, dominators.ComputePost(g)).WriteDeps(os.Stdout)
+	case *df:
+		f := dominators.ComputeFrontiers(dominators.Compute(g))
+		for _, bb := range g.Blocks() {
+			if frontier := f.Frontier(bb); len(frontier) > 0 {
+				fmt.Printf("%v:%s\n", cfg.BlockName(bb), blockList(frontier, nil))
+			}
+		}
+		return nil
+	case *phi != "":
+		return reportPhis(g)
+	}
+	return dominators.Compute(g).WriteTree(os.Stdout, g)
+}
+
+// reportPhis prints one line per variable, in name order, with its
+// phi blocks; loop headers are followed by "(loop)".
+//
+func reportPhis[K comparable](g *cfg.CFG[K]) error {
+	defs, liveIn, err := readDefs(g, *phi)
+	if err != nil {
+		return err
+	}
+	lsgraph := lsg.NewLSGOf[K]()
+	havlakloopfinder.FindLoops(g, lsgraph)
+	headers := make(map[*cfg.BasicBlock[K]]bool)
+	for _, loop := range lsgraph.Loops() {
+		headers[loop.Header()] = true
+	}
+
+	phis := dominators.PlacePhis(dominators.ComputeFrontiers(dominators.Compute(g)), defs, liveIn)
+	vars := make([]string, 0, len(defs))
+	for v := range defs {
+		vars = append(vars, v)
+	}
+	sort.Strings(vars)
+	for _, v := range vars {
+		fmt.Printf("%s:%s\n", v, blockList(phis[v], headers))
+	}
+	return checkPhis(g, lsgraph.Loops(), headers, defs, liveIn, vars, phis)
+}
+
+// checkPhis compares the phis with the loops: a variable assigned in
+// a loop, and live into its header if liveIn is given, needs a phi at
+// the header, and a block other than a loop header needs two
+// predecessors to have one. A mismatch means that the frontiers or
+// the live records are wrong.
+//
+func checkPhis[K comparable](g *cfg.CFG[K], loops []*lsg.SimpleLoop[K], headers map[*cfg.BasicBlock[K]]bool, defs map[string]map[*cfg.BasicBlock[K]]bool, liveIn map[*cfg.BasicBlock[K]]map[string]bool, vars []string, phis map[string][]*cfg.BasicBlock[K]) error {
+	var errs []error
+	reached := g.Reachable()
+	for _, v := range vars {
+		hasPhi := make(map[*cfg.BasicBlock[K]]bool)
+		for _, bb := range phis[v] {
+			hasPhi[bb] = true
+		}
+		for _, loop := range loops {
+			h := loop.Header()
+			if h == nil || hasPhi[h] || liveIn != nil && !liveIn[h][v] {
+				continue
+			}
+			var assigned []*cfg.BasicBlock[K]
+			for bb := range loop.AllBlocks() {
+				if defs[v][bb] {
+					assigned = append(assigned, bb)
+				}
+			}
+			if len(assigned) > 0 {
+				cfg.SortBlocks(assigned)
+				errs = append(errs, fmt.Errorf("%s: no phi at loop header %s, assigned in the loop at%s",
+					v, cfg.BlockName(h), blockList(assigned, nil)))
+			}
+		}
+		for _, bb := range phis[v] {
+			if headers[bb] {
+				continue
+			}
+			preds := 0
+			for ll := bb.InEdges().Front(); ll != nil; ll = ll.Next() {
+				if reached[ll.Value.(*cfg.BasicBlockEdge[K]).Src()] {
+					preds++
+				}
+			}
+			if preds < 2 {
+				errs = append(errs, fmt.Errorf("%s: phi at %s, neither a loop header nor a join",
+					v, cfg.BlockName(bb)))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func blockList[K comparable](blocks []*cfg.BasicBlock[K], headers map[*cfg.BasicBlock[K]]bool) string {
+	var b strings.Builder
+	for _, bb := range blocks {
+		b.WriteString(" " + cfg.BlockName(bb))
+		if headers[bb] {
+			b.WriteString(" (loop)")
+		}
+	}
+	return b.String()
+}
+
+// readDefs reads a -phi file. liveIn is nil if it has no live records.
+//
+func readDefs[K comparable](g *cfg.CFG[K], path string) (map[string]map[*cfg.BasicBlock[K]]bool, map[*cfg.BasicBlock[K]]map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	defs := make(map[string]map[*cfg.BasicBlock[K]]bool)
+	var liveIn map[*cfg.BasicBlock[K]]map[string]bool
+	block := func(s string) (*cfg.BasicBlock[K], error) {
+		name, err := cfg.ParseName[K](s)
+		if err != nil {
+			return nil, err
+		}
+		if bb := g.BasicBlocks()[name]; bb != nil {
+			return bb, nil
+		}
+		return nil, fmt.Errorf("no block %s", s)
+	}
+
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || fields[0] != "def" && fields[0] != "live" {
+			return nil, nil, fmt.Errorf("%s:%d: want 'def <variable> <block> ...' or 'live <block> <variable> ...'", path, lineno)
+		}
+		switch fields[0] {
+		case "def":
+			if defs[fields[1]] == nil {
+				defs[fields[1]] = make(map[*cfg.BasicBlock[K]]bool)
+			}
+			for _, s := range fields[2:] {
+				bb, err := block(s)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s:%d: %v", path, lineno, err)
+				}
+				defs[fields[1]][bb] = true
+			}
+		case "live":
+			bb, err := block(fields[1])
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s:%d: %v", path, lineno, err)
+			}
+			if liveIn == nil {
+				liveIn = make(map[*cfg.BasicBlock[K]]map[string]bool)
+			}
+			if liveIn[bb] == nil {
+				liveIn[bb] = make(map[string]bool)
+			}
+			for _, v := range fields[2:] {
+				liveIn[bb][v] = true
+			}
+		}
+	}
+	return defs, liveIn, scanner.Err()
+}
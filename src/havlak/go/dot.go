@@ -0,0 +1,204 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Graphviz DOT output and input for control flow graphs.
+//
+// A CFG is written as a digraph. When a loop structure graph is
+// given, every loop becomes a nested 'subgraph cluster' holding the
+// blocks that belong directly to it, loop headers are filled, and
+// irreducible loops are drawn in red. Back edges, from inside a loop
+// to its header, are dashed; edge kinds and labels become edge
+// labels. Entry blocks carry an 'entry' attribute with their
+// position among the entries and the virtual entry a 'virtual' one,
+// so that ReadCFG can read the graph back. Blocks, clusters and
+// edges are always written in the same order, so the output can be
+// diffed.
+//
+package dot
+
+import "bufio"
+import "fmt"
+import "io"
+import "sort"
+import "strings"
+import "./basicblock"
+import "./lsg"
+
+// WriteCFG writes 'cfgraph' in DOT syntax. 'lsgraph' may be nil, in
+// which case no loop clusters are drawn.
+//
+func WriteCFG[K comparable](w io.Writer, cfgraph *cfg.CFG[K], lsgraph *lsg.LSG[K]) error {
+	bw := bufio.NewWriter(w)
+	blocks := cfgraph.Blocks()
+	position := make(map[*cfg.BasicBlock[K]]int)
+	for i, bb := range blocks {
+		position[bb] = i
+	}
+
+	// Innermost loop of every block, and the loop each header heads.
+	owner := make(map[*cfg.BasicBlock[K]]*lsg.SimpleLoop[K])
+	heads := make(map[*cfg.BasicBlock[K]]*lsg.SimpleLoop[K])
+	children := make(map[*lsg.SimpleLoop[K]][]*lsg.SimpleLoop[K])
+	var topLevel []*lsg.SimpleLoop[K]
+	if lsgraph != nil {
+		for _, loop := range lsgraph.Loops() {
+			for bb, _ := range loop.BasicBlocks() {
+				owner[bb] = loop
+			}
+			if loop.Header() != nil {
+				heads[loop.Header()] = loop
+			}
+			if parent := loop.Parent(); parent == nil || parent == lsgraph.Root() {
+				topLevel = append(topLevel, loop)
+			} else {
+				children[parent] = append(children[parent], loop)
+			}
+		}
+	}
+	byHeader := func(loops []*lsg.SimpleLoop[K]) {
+		sort.Slice(loops, func(i, j int) bool {
+			return position[loops[i].Header()] < position[loops[j].Header()]
+		})
+	}
+	byHeader(topLevel)
+	for _, loops := range children {
+		byHeader(loops)
+	}
+
+	fmt.Fprintf(bw, "digraph cfg {\n")
+	fmt.Fprintf(bw, "  node [shape=box];\n")
+
+	entry := make(map[*cfg.BasicBlock[K]]int)
+	for i, bb := range cfgraph.Entries() {
+		entry[bb] = i + 1
+	}
+
+	writeBlock := func(bb *cfg.BasicBlock[K], indent string) {
+		attrs := []string{"label=" + quote(bb.String())}
+		switch loop := heads[bb]; {
+		case bb == cfgraph.VirtualEntry():
+			attrs = append(attrs, "shape=point", "virtual=true")
+		case loop != nil && !loop.IsReducible():
+			attrs = append(attrs, "style=filled", "fillcolor=salmon")
+		case loop != nil:
+			attrs = append(attrs, "style=filled", "fillcolor=lightblue")
+		}
+		if bb == cfgraph.StartBasicBlock() {
+			attrs = append(attrs, "peripheries=2")
+		}
+		if n := entry[bb]; n > 0 {
+			attrs = append(attrs, fmt.Sprintf("entry=%d", n))
+		}
+		fmt.Fprintf(bw, "%s%s [%s];\n", indent, nodeID(bb), strings.Join(attrs, ", "))
+	}
+
+	// Loop clusters, innermost blocks inside the innermost cluster.
+	members := make(map[*lsg.SimpleLoop[K]][]*cfg.BasicBlock[K])
+	for _, bb := range blocks {
+		if loop := owner[bb]; loop != nil {
+			members[loop] = append(members[loop], bb)
+		}
+	}
+	clusters := 0
+	var writeLoop func(loop *lsg.SimpleLoop[K], indent string)
+	writeLoop = func(loop *lsg.SimpleLoop[K], indent string) {
+		fmt.Fprintf(bw, "%ssubgraph cluster_%d {\n", indent, clusters)
+		clusters++
+		label := "loop " + loop.Header().String()
+		if loop.IsReducible() {
+			fmt.Fprintf(bw, "%s  style=rounded; color=blue;\n", indent)
+		} else {
+			label += " (irreducible)"
+			fmt.Fprintf(bw, "%s  style=\"rounded,dashed\"; color=red;\n", indent)
+		}
+		fmt.Fprintf(bw, "%s  label=%s;\n", indent, quote(label))
+		for _, bb := range members[loop] {
+			writeBlock(bb, indent+"  ")
+		}
+		for _, child := range children[loop] {
+			writeLoop(child, indent+"  ")
+		}
+		fmt.Fprintf(bw, "%s}\n", indent)
+	}
+	for _, loop := range topLevel {
+		writeLoop(loop, "  ")
+	}
+	for _, bb := range blocks {
+		if owner[bb] == nil {
+			writeBlock(bb, "  ")
+		}
+	}
+
+	// isBackEdge: the edge goes to the header of a loop that
+	// contains its source.
+	isBackEdge := func(edge *cfg.BasicBlockEdge[K]) bool {
+		target := heads[edge.Dst()]
+		if target == nil {
+			return false
+		}
+		for loop := owner[edge.Src()]; loop != nil; loop = loop.Parent() {
+			if loop == target {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, bb := range blocks {
+		for iter := bb.OutEdges().Front(); iter != nil; iter = iter.Next() {
+			edge := iter.Value.(*cfg.BasicBlockEdge[K])
+			var attrs []string
+			if label := edgeLabel(edge); label != "" {
+				attrs = append(attrs, "label="+quote(label))
+			}
+			switch {
+			case isBackEdge(edge):
+				attrs = append(attrs, "style=dashed", "color=blue")
+			case edge.Kind() == cfg.EdgeExceptional:
+				attrs = append(attrs, "style=dotted")
+			}
+			fmt.Fprintf(bw, "  %s -> %s", nodeID(bb), nodeID(edge.Dst()))
+			if len(attrs) > 0 {
+				fmt.Fprintf(bw, " [%s]", strings.Join(attrs, ", "))
+			}
+			fmt.Fprintf(bw, ";\n")
+		}
+	}
+
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
+
+func nodeID[K comparable](bb *cfg.BasicBlock[K]) string {
+	return quote(cfg.FormatName(bb.Name()))
+}
+
+func edgeLabel[K comparable](edge *cfg.BasicBlockEdge[K]) string {
+	switch {
+	case edge.Label() != "":
+		return fmt.Sprintf("%v:%s", edge.Kind(), edge.Label())
+	case edge.Kind() != cfg.EdgeFallthrough:
+		return edge.Kind().String()
+	}
+	return ""
+}
+
+// quote makes a DOT double-quoted string.
+//
+func quote(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	s = strings.ReplaceAll(s, "\n", "\\n")
+	return "\"" + s + "\""
+}
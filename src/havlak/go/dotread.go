@@ -0,0 +1,782 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//======================================================
+// DOT Input
+//======================================================
+
+// ReadCFG takes a digraph as WriteCFG writes it or as people draw
+// it: node, edge and attribute statements, edge chains, subgraphs
+// (as edge operands too), comments and quoted, numeral and HTML IDs.
+// Subgraphs and clusters are flattened away and layout attributes
+// ignored. What makes the CFG is
+//
+//    node IDs           block names, parsed with cfg.ParseName
+//    entry=N            on a node, makes it an entry; several
+//                       entries are ordered by N, and entry=true
+//                       ones follow in the order they appear
+//    virtual=true       on a node, names the virtual entry of a
+//                       graph with several entries; its edges are
+//                       implied by the entries and not read
+//    label="kind:text"  on an edge, kind and label, as WriteCFG
+//    label=kind         writes them; any other label is the label
+//                       of a fallthrough edge
+//    kind=K             on an edge, the kind, which makes the label
+//                       just a label
+//
+// Blocks are created in the order their IDs first appear. Without
+// an entry attribute the first block is the start node, as in the
+// edge-list format. Reading what WriteCFG writes gives a graph that
+// is StructurallyEqual to the original.
+
+package dot
+
+import "fmt"
+import "io"
+import "sort"
+import "strconv"
+import "strings"
+import "./basicblock"
+
+// ReadCFG parses a DOT digraph with cfg.DefaultLimits.
+//
+func ReadCFG[K comparable](r io.Reader) (*cfg.CFG[K], error) {
+	return ReadCFGLimits[K](r, cfg.DefaultLimits)
+}
+
+// ReadCFGLimits parses a DOT digraph, failing if the input exceeds
+// 'limits'.
+//
+func ReadCFGLimits[K comparable](r io.Reader, limits cfg.Limits) (*cfg.CFG[K], error) {
+	if limits.MaxBytes > 0 {
+		r = io.LimitReader(r, limits.MaxBytes+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxBytes > 0 && int64(len(data)) > limits.MaxBytes {
+		return nil, fmt.Errorf("input larger than %d bytes", limits.MaxBytes)
+	}
+
+	p := &parser{lex: lexer{src: string(data), line: 1}, limits: limits,
+		nodes: make(map[string]*node)}
+	if err := p.graph(); err != nil {
+		return nil, err
+	}
+	return build[K](p)
+}
+
+//-----------------------------------------------------------
+
+type tokenKind int
+
+const (
+	tokEOF   tokenKind = iota
+	tokID              // identifier, numeral, quoted or HTML string
+	tokPunct           // { } [ ] = ; , :
+	tokEdge            // -> or --
+)
+
+type token struct {
+	kind   tokenKind
+	text   string // the ID, without quotes, or the punctuation
+	quoted bool   // a quoted or HTML ID, never a keyword
+	line   int
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return &cfg.SyntaxError{Line: l.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// skip passes blanks and comments: /* */, // and lines starting
+// with '#', which are C preprocessor output.
+//
+func (l *lexer) skip() error {
+	atLineStart := l.pos == 0 || l.src[l.pos-1] == '\n'
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+			atLineStart = true
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+			continue
+		case c == '#' && atLineStart,
+			strings.HasPrefix(l.src[l.pos:], "//"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return l.errorf("unterminated comment")
+			}
+			l.line += strings.Count(l.src[l.pos:l.pos+2+end], "\n")
+			l.pos += end + 4
+			continue
+		}
+		return nil
+	}
+	return nil
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skip(); err != nil {
+		return token{}, err
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, line: l.line}, nil
+	}
+	start, line := l.pos, l.line
+	c := l.src[l.pos]
+	switch {
+	case strings.ContainsRune("{}[]=;,:", rune(c)):
+		l.pos++
+		return token{tokPunct, l.src[start:l.pos], false, line}, nil
+
+	case strings.HasPrefix(l.src[l.pos:], "->") || strings.HasPrefix(l.src[l.pos:], "--"):
+		l.pos += 2
+		return token{tokEdge, l.src[start:l.pos], false, line}, nil
+
+	case c == '"':
+		s, err := l.quoted()
+		if err != nil {
+			return token{}, err
+		}
+		// "a" + "b" is "ab".
+		for {
+			save, saveLine := l.pos, l.line
+			if err := l.skip(); err != nil {
+				return token{}, err
+			}
+			if l.pos >= len(l.src) || l.src[l.pos] != '+' {
+				l.pos, l.line = save, saveLine
+				break
+			}
+			l.pos++
+			if err := l.skip(); err != nil {
+				return token{}, err
+			}
+			if l.pos >= len(l.src) || l.src[l.pos] != '"' {
+				return token{}, l.errorf("'+' not followed by a string")
+			}
+			more, err := l.quoted()
+			if err != nil {
+				return token{}, err
+			}
+			s += more
+		}
+		return token{tokID, s, true, line}, nil
+
+	case c == '<':
+		depth := 0
+		for ; l.pos < len(l.src); l.pos++ {
+			switch l.src[l.pos] {
+			case '<':
+				depth++
+			case '>':
+				depth--
+			case '\n':
+				l.line++
+			}
+			if depth == 0 {
+				l.pos++
+				return token{tokID, l.src[start+1 : l.pos-1], true, line}, nil
+			}
+		}
+		return token{}, &cfg.SyntaxError{Line: line, Msg: "unterminated HTML string"}
+
+	case c == '-' || c == '.' || '0' <= c && c <= '9':
+		l.pos++
+		for l.pos < len(l.src) && (l.src[l.pos] == '.' || isIDChar(l.src[l.pos])) {
+			// Graphviz would split 0x10 in two; take it whole.
+			l.pos++
+		}
+		return token{tokID, l.src[start:l.pos], false, line}, nil
+
+	case isIDChar(c):
+		for l.pos < len(l.src) && isIDChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{tokID, l.src[start:l.pos], false, line}, nil
+	}
+	return token{}, l.errorf("unexpected character %q", c)
+}
+
+func isIDChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' || c == '_' || c >= 0x80
+}
+
+// quoted reads a double-quoted string. It undoes what quote does:
+// \" and \\ stand for themselves and \n for a newline. Any other
+// escape, such as the \l of a label, is kept, and a backslash at the
+// end of a line continues the string.
+//
+func (l *lexer) quoted() (string, error) {
+	line := l.line
+	var b strings.Builder
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		c := l.src[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return b.String(), nil
+		case c == '\\' && l.pos+1 < len(l.src):
+			l.pos++
+			switch e := l.src[l.pos]; e {
+			case '"', '\\':
+				b.WriteByte(e)
+			case 'n':
+				b.WriteByte('\n')
+			case '\n':
+				l.line++
+			case '\r':
+				if l.pos+1 < len(l.src) && l.src[l.pos+1] == '\n' {
+					l.pos++
+					l.line++
+				}
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+		default:
+			if c == '\n' {
+				l.line++
+			}
+			b.WriteByte(c)
+		}
+	}
+	return "", &cfg.SyntaxError{Line: line, Msg: "unterminated string"}
+}
+
+//-----------------------------------------------------------
+
+// node and edge are what the statements say about them, before the
+// names are parsed.
+//
+type node struct {
+	id    string
+	line  int
+	attrs map[string]string
+}
+
+type edge struct {
+	from, to *node
+	line     int
+	attrs    map[string]string
+}
+
+// scope holds the node and edge defaults of a graph or subgraph.
+//
+type scope struct {
+	node, edge map[string]string
+}
+
+func (s scope) copy() scope {
+	c := scope{make(map[string]string), make(map[string]string)}
+	for k, v := range s.node {
+		c.node[k] = v
+	}
+	for k, v := range s.edge {
+		c.edge[k] = v
+	}
+	return c
+}
+
+type parser struct {
+	lex    lexer
+	tok    token
+	peeked bool
+	limits cfg.Limits
+
+	nodes map[string]*node
+	order []*node
+	edges []*edge
+}
+
+func (p *parser) peek() (token, error) {
+	if !p.peeked {
+		tok, err := p.lex.next()
+		if err != nil {
+			return token{}, err
+		}
+		p.tok, p.peeked = tok, true
+	}
+	return p.tok, nil
+}
+
+func (p *parser) next() (token, error) {
+	tok, err := p.peek()
+	p.peeked = false
+	return tok, err
+}
+
+func (p *parser) errorf(tok token, format string, args ...interface{}) error {
+	return &cfg.SyntaxError{Line: tok.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// is tells whether tok is the punctuation or keyword s. Keywords
+// are case-insensitive and never quoted.
+//
+func is(tok token, s string) bool {
+	switch tok.kind {
+	case tokPunct, tokEdge:
+		return tok.text == s
+	case tokID:
+		return !tok.quoted && strings.EqualFold(tok.text, s)
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	tok, err := p.next()
+	if err != nil {
+		return err
+	}
+	if !is(tok, s) {
+		return p.errorf(tok, "expected %q, found %q", s, tok.text)
+	}
+	return nil
+}
+
+// graph parses '[strict] digraph [ID] { stmt_list }'.
+//
+func (p *parser) graph() error {
+	tok, err := p.next()
+	if err != nil {
+		return err
+	}
+	if is(tok, "strict") {
+		if tok, err = p.next(); err != nil {
+			return err
+		}
+	}
+	switch {
+	case is(tok, "graph"):
+		return p.errorf(tok, "an undirected graph is not a CFG")
+	case !is(tok, "digraph"):
+		return p.errorf(tok, "expected digraph, found %q", tok.text)
+	}
+	if tok, err = p.peek(); err != nil {
+		return err
+	}
+	if tok.kind == tokID {
+		p.next()
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	if _, err := p.stmtList(scope{}.copy()); err != nil {
+		return err
+	}
+	if tok, err = p.next(); err != nil {
+		return err
+	}
+	if tok.kind != tokEOF {
+		return p.errorf(tok, "text after the graph")
+	}
+	return nil
+}
+
+// stmtList parses statements up to and including the closing '}'
+// and returns the nodes they mention, for a subgraph used as an
+// edge operand.
+//
+func (p *parser) stmtList(sc scope) ([]*node, error) {
+	var members []*node
+	for {
+		tok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case tok.kind == tokEOF:
+			return nil, p.errorf(tok, "missing '}'")
+		case is(tok, "}"):
+			p.next()
+			return members, nil
+		case is(tok, ";") || is(tok, ","):
+			p.next()
+			continue
+		}
+		nodes, err := p.stmt(sc)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, nodes...)
+	}
+}
+
+func (p *parser) stmt(sc scope) ([]*node, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if is(tok, "graph") || is(tok, "node") || is(tok, "edge") {
+		attrs, err := p.attrList(true)
+		if err != nil {
+			return nil, err
+		}
+		target := map[string]map[string]string{"node": sc.node, "edge": sc.edge}[strings.ToLower(tok.text)]
+		for k, v := range attrs {
+			if target != nil {
+				target[k] = v
+			}
+		}
+		return nil, nil
+	}
+
+	var operand []*node
+	switch {
+	case is(tok, "subgraph") || is(tok, "{"):
+		if operand, err = p.subgraph(tok, sc); err != nil {
+			return nil, err
+		}
+	case tok.kind == tokID:
+		next, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if is(next, "=") {
+			// A graph attribute.
+			p.next()
+			if value, err := p.next(); err != nil {
+				return nil, err
+			} else if value.kind != tokID {
+				return nil, p.errorf(value, "expected a value after '='")
+			}
+			return nil, nil
+		}
+		n, err := p.nodeID(tok, sc)
+		if err != nil {
+			return nil, err
+		}
+		operand = []*node{n}
+	default:
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+
+	next, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if next.kind != tokEdge {
+		if len(operand) == 1 && !is(tok, "subgraph") && !is(tok, "{") {
+			// A node statement.
+			attrs, err := p.attrList(false)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range attrs {
+				operand[0].attrs[k] = v
+			}
+		}
+		return operand, nil
+	}
+	return p.edgeStmt(operand, sc)
+}
+
+// edgeStmt parses the rest of 'a -> b -> { c d } [attrs]'.
+//
+func (p *parser) edgeStmt(first []*node, sc scope) ([]*node, error) {
+	operands := [][]*node{first}
+	all := append([]*node(nil), first...)
+	line := 0
+	for {
+		op, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if op.kind != tokEdge {
+			break
+		}
+		p.next()
+		if op.text != "->" {
+			return nil, p.errorf(op, "undirected edge in a digraph")
+		}
+		line = op.line
+		tok, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		var operand []*node
+		switch {
+		case is(tok, "subgraph") || is(tok, "{"):
+			operand, err = p.subgraph(tok, sc)
+		case tok.kind == tokID:
+			var n *node
+			n, err = p.nodeID(tok, sc)
+			operand = []*node{n}
+		default:
+			err = p.errorf(tok, "expected a node or subgraph after '->'")
+		}
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+		all = append(all, operand...)
+	}
+
+	attrs, err := p.attrList(false)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+1 < len(operands); i++ {
+		for _, from := range operands[i] {
+			for _, to := range operands[i+1] {
+				if p.limits.MaxEdges > 0 && len(p.edges) >= p.limits.MaxEdges {
+					return nil, &cfg.SyntaxError{Line: line, Msg: fmt.Sprintf("more than %d edges", p.limits.MaxEdges)}
+				}
+				e := &edge{from: from, to: to, line: line, attrs: make(map[string]string)}
+				for k, v := range sc.edge {
+					e.attrs[k] = v
+				}
+				for k, v := range attrs {
+					e.attrs[k] = v
+				}
+				p.edges = append(p.edges, e)
+			}
+		}
+	}
+	return all, nil
+}
+
+// subgraph parses '[subgraph [ID]] { stmt_list }' after its first
+// token. Its defaults start as a copy of the enclosing ones.
+//
+func (p *parser) subgraph(first token, sc scope) ([]*node, error) {
+	if is(first, "subgraph") {
+		tok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind == tokID {
+			p.next()
+		}
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+	}
+	return p.stmtList(sc.copy())
+}
+
+// nodeID looks up or creates the node named by tok, skipping a
+// port.
+//
+func (p *parser) nodeID(tok token, sc scope) (*node, error) {
+	for i := 0; i < 2; i++ {
+		next, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !is(next, ":") {
+			break
+		}
+		p.next()
+		if port, err := p.next(); err != nil {
+			return nil, err
+		} else if port.kind != tokID {
+			return nil, p.errorf(port, "expected a port after ':'")
+		}
+	}
+
+	if n := p.nodes[tok.text]; n != nil {
+		return n, nil
+	}
+	if p.limits.MaxBlocks > 0 && len(p.order) >= p.limits.MaxBlocks {
+		return nil, p.errorf(tok, "more than %d blocks", p.limits.MaxBlocks)
+	}
+	n := &node{id: tok.text, line: tok.line, attrs: make(map[string]string)}
+	for k, v := range sc.node {
+		n.attrs[k] = v
+	}
+	p.nodes[tok.text] = n
+	p.order = append(p.order, n)
+	return n, nil
+}
+
+// attrList parses any number of '[ a=b, c=d; ... ]'; 'required'
+// asks for at least one.
+//
+func (p *parser) attrList(required bool) (map[string]string, error) {
+	attrs := make(map[string]string)
+	for {
+		tok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !is(tok, "[") {
+			if required {
+				return nil, p.errorf(tok, "expected '['")
+			}
+			return attrs, nil
+		}
+		p.next()
+		required = false
+		for {
+			tok, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			if is(tok, "]") {
+				break
+			}
+			if is(tok, ",") || is(tok, ";") {
+				continue
+			}
+			if tok.kind != tokID {
+				return nil, p.errorf(tok, "expected an attribute name, found %q", tok.text)
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			value, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			if value.kind != tokID {
+				return nil, p.errorf(value, "expected a value for %s", tok.text)
+			}
+			attrs[tok.text] = value.text
+		}
+	}
+}
+
+//-----------------------------------------------------------
+
+// build makes the CFG from the parsed nodes and edges.
+//
+func build[K comparable](p *parser) (*cfg.CFG[K], error) {
+	fail := func(line int, format string, args ...interface{}) (*cfg.CFG[K], error) {
+		return nil, &cfg.SyntaxError{Line: line, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	var virtual *node
+	type entry struct {
+		n     *node
+		order int // the N of entry=N, or MaxInt for entry=true
+	}
+	var entries []entry
+	for _, n := range p.order {
+		if v, ok := n.attrs["virtual"]; ok && truth(v) {
+			if virtual != nil {
+				return fail(n.line, "two virtual entries, %s and %s", virtual.id, n.id)
+			}
+			virtual = n
+			continue
+		}
+		v, ok := n.attrs["entry"]
+		if !ok {
+			continue
+		}
+		if order, err := strconv.Atoi(v); err == nil {
+			if order > 0 {
+				entries = append(entries, entry{n, order})
+			}
+		} else if truth(v) {
+			entries = append(entries, entry{n, int(^uint(0) >> 1)})
+		} else if v != "false" && v != "no" {
+			return fail(n.line, "bad entry value %q", v)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].order < entries[j].order })
+
+	g := cfg.NewCFGOf[K]()
+	names := make(map[*node]K)
+	for _, n := range p.order {
+		name, err := cfg.ParseName[K](n.id)
+		if err != nil {
+			return fail(n.line, "%v", err)
+		}
+		names[n] = name
+		if n != virtual {
+			g.CreateNode(name)
+		}
+	}
+	for _, e := range p.edges {
+		if e.from == virtual {
+			continue
+		}
+		if e.to == virtual {
+			return fail(e.line, "edge into the virtual entry %s", virtual.id)
+		}
+		kind, label, err := edgeKind(e.attrs)
+		if err != nil {
+			return fail(e.line, "%v", err)
+		}
+		cfg.NewBasicBlockEdgeOfKind(g, names[e.from], names[e.to], kind).SetLabel(label)
+	}
+
+	nodes := make([]K, 0, len(entries))
+	distinct := make(map[K]bool)
+	for _, e := range entries {
+		if !distinct[names[e.n]] {
+			distinct[names[e.n]] = true
+			nodes = append(nodes, names[e.n])
+		}
+	}
+	switch {
+	case virtual != nil && len(nodes) < 2:
+		return fail(virtual.line, "virtual entry given for fewer than two entries")
+	case virtual != nil && g.BasicBlocks()[names[virtual]] != nil:
+		return fail(virtual.line, "virtual entry %s has the name of a block", virtual.id)
+	case virtual != nil:
+		g.SetEntriesNamed(names[virtual], nodes...)
+	case len(entries) > 0:
+		g.SetEntries(nodes...)
+	}
+	if err := g.ValidateStructure(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// edgeKind reads the kind and label of an edge from its 'kind' and
+// 'label' attributes.
+//
+func edgeKind(attrs map[string]string) (cfg.EdgeKind, string, error) {
+	label := attrs["label"]
+	if k, ok := attrs["kind"]; ok {
+		kind, ok := cfg.ParseEdgeKind(k)
+		if !ok {
+			return kind, "", fmt.Errorf("unknown edge kind %q", k)
+		}
+		return kind, label, nil
+	}
+	prefix, rest, labeled := strings.Cut(label, ":")
+	if kind, ok := cfg.ParseEdgeKind(prefix); ok {
+		if labeled {
+			return kind, rest, nil
+		}
+		return kind, "", nil
+	}
+	return cfg.EdgeFallthrough, label, nil
+}
+
+func truth(v string) bool {
+	return v == "true" || v == "yes" || v == "1"
+}
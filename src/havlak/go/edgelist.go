@@ -0,0 +1,430 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//======================================================
+// Text Edge-List Format
+//======================================================
+
+// A CFG can be stored as a line-oriented edge list:
+//
+//    # A loop with an early exit.
+//    block 0
+//    block 1
+//    block 2
+//    block 3
+//    entry 0
+//    edge 0 1
+//    edge 1 2 taken "body"
+//    edge 1 3
+//    edge 2 1
+//
+// Records are separated by newlines, fields by blanks, and a '#'
+// outside quotes starts a comment. Any field may be written as a
+// double-quoted Go string, which is how names and labels containing
+// blanks, quotes or '#' are written. The records are:
+//
+//    block <name>
+//        Declares a block. Blocks are created in file order.
+//    entry <name> [<name> ...]
+//        Declares the entry block(s), as SetEntries does. Without an
+//        entry record the first block created is the start node.
+//    virtual <name>
+//        Names the virtual entry of a multi-entry graph; without it
+//        SetEntries picks a name.
+//    edge <from> <to> [<kind> [<label>]]
+//        Adds an edge, creating undeclared blocks. <kind> is one of
+//        fallthrough (the default), taken, case, exceptional and
+//        call-return. Two edges between the same blocks must differ
+//        in kind or label, as ValidateStructure requires.
+//
+// Block names are written as FormatName prints them. WriteEdgeList
+// declares every block, then the entries, then the edges grouped by
+// source block, so reading its output with ReadEdgeList gives a
+// graph that is StructurallyEqual to the original.
+
+package cfg
+
+import "bufio"
+import "fmt"
+import "io"
+import "strconv"
+import "strings"
+
+// Limits bounds the resources a reader may use on untrusted input.
+// A zero field means no limit.
+//
+type Limits struct {
+	MaxBytes  int64 // total input size
+	MaxLine   int   // length of a single line
+	MaxBlocks int
+	MaxEdges  int
+}
+
+// DefaultLimits are generous enough for any real function.
+//
+var DefaultLimits = Limits{
+	MaxBytes:  64 << 20,
+	MaxLine:   64 << 10,
+	MaxBlocks: 1 << 20,
+	MaxEdges:  4 << 20,
+}
+
+// SyntaxError is a parse error at a particular line of the input.
+//
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// ReadEdgeList parses the edge-list format with DefaultLimits.
+//
+func ReadEdgeList[K comparable](r io.Reader) (*CFG[K], error) {
+	return ReadEdgeListLimits[K](r, DefaultLimits)
+}
+
+// ReadEdgeListLimits parses the edge-list format, failing as soon as
+// the input exceeds 'limits'.
+//
+func ReadEdgeListLimits[K comparable](r io.Reader, limits Limits) (*CFG[K], error) {
+	cfg := NewCFGOf[K]()
+	var entries []K
+	var virtual *K
+	entryLine := 0
+	numEdges := 0
+
+	scanner := NewLineScanner(r, limits)
+	lineno := 0
+	fail := func(format string, args ...interface{}) (*CFG[K], error) {
+		return nil, &SyntaxError{lineno, fmt.Sprintf(format, args...)}
+	}
+
+	for scanner.Scan() {
+		lineno++
+		fields, err := splitFields(scanner.Text())
+		if err != nil {
+			return fail("%v", err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		names := make([]K, 0, 2)
+		parseNames := func(fields []string) error {
+			for _, f := range fields {
+				name, err := ParseName[K](f)
+				if err != nil {
+					return err
+				}
+				names = append(names, name)
+			}
+			return nil
+		}
+		create := func(name K) bool {
+			if cfg.bb[name] == nil && limits.MaxBlocks > 0 && len(cfg.bb) >= limits.MaxBlocks {
+				return false
+			}
+			cfg.CreateNode(name)
+			return true
+		}
+
+		switch fields[0] {
+		case "block":
+			if len(fields) != 2 {
+				return fail("block takes one name")
+			}
+			if err := parseNames(fields[1:]); err != nil {
+				return fail("%v", err)
+			}
+			if !create(names[0]) {
+				return fail("more than %d blocks", limits.MaxBlocks)
+			}
+
+		case "entry":
+			if len(fields) < 2 {
+				return fail("entry needs at least one name")
+			}
+			if entries != nil {
+				return fail("entries already given on line %d", entryLine)
+			}
+			if err := parseNames(fields[1:]); err != nil {
+				return fail("%v", err)
+			}
+			entries, entryLine = names, lineno
+
+		case "virtual":
+			if len(fields) != 2 {
+				return fail("virtual takes one name")
+			}
+			if err := parseNames(fields[1:]); err != nil {
+				return fail("%v", err)
+			}
+			virtual = &names[0]
+
+		case "edge":
+			if len(fields) < 3 || len(fields) > 5 {
+				return fail("edge takes two names, an optional kind and an optional label")
+			}
+			if err := parseNames(fields[1:3]); err != nil {
+				return fail("%v", err)
+			}
+			kind := EdgeFallthrough
+			if len(fields) > 3 {
+				var ok bool
+				if kind, ok = ParseEdgeKind(fields[3]); !ok {
+					return fail("unknown edge kind %q", fields[3])
+				}
+			}
+			if limits.MaxEdges > 0 && numEdges >= limits.MaxEdges {
+				return fail("more than %d edges", limits.MaxEdges)
+			}
+			if !create(names[0]) || !create(names[1]) {
+				return fail("more than %d blocks", limits.MaxBlocks)
+			}
+			edge := NewBasicBlockEdgeOfKind(cfg, names[0], names[1], kind)
+			if len(fields) > 4 {
+				edge.SetLabel(fields[4])
+			}
+			numEdges++
+
+		default:
+			return fail("unknown record %q", fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, &SyntaxError{lineno + 1, err.Error()}
+	}
+
+	entries = distinct(entries)
+	if virtual != nil && len(entries) < 2 {
+		return nil, &SyntaxError{lineno, "virtual entry given for fewer than two entries"}
+	}
+	switch {
+	case virtual != nil:
+		taken := cfg.bb[*virtual] != nil
+		for _, n := range entries {
+			taken = taken || n == *virtual
+		}
+		if taken {
+			return nil, &SyntaxError{lineno, "virtual entry name is also a block"}
+		}
+		cfg.SetEntriesNamed(*virtual, entries...)
+	case entries != nil:
+		cfg.SetEntries(entries...)
+	}
+	if err := cfg.ValidateStructure(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// WriteEdgeList writes the graph in the edge-list format.
+//
+func (cfg *CFG[K]) WriteEdgeList(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	blocks := cfg.Blocks()
+
+	for _, bb := range blocks {
+		if bb != cfg.virtualEntry {
+			fmt.Fprintf(bw, "block %s\n", quoteField(FormatName(bb.Name())))
+		}
+	}
+
+	if entries := cfg.Entries(); len(entries) > 0 {
+		bw.WriteString("entry")
+		for _, bb := range entries {
+			fmt.Fprintf(bw, " %s", quoteField(FormatName(bb.Name())))
+		}
+		bw.WriteString("\n")
+	}
+	if cfg.virtualEntry != nil {
+		fmt.Fprintf(bw, "virtual %s\n", quoteField(FormatName(cfg.virtualEntry.Name())))
+	}
+
+	for _, bb := range blocks {
+		if bb == cfg.virtualEntry {
+			continue
+		}
+		for iter := bb.OutEdges().Front(); iter != nil; iter = iter.Next() {
+			edge := iter.Value.(*BasicBlockEdge[K])
+			fmt.Fprintf(bw, "edge %s %s", quoteField(FormatName(bb.Name())),
+				quoteField(FormatName(edge.Dst().Name())))
+			if edge.Kind() != EdgeFallthrough || edge.Label() != "" {
+				fmt.Fprintf(bw, " %v", edge.Kind())
+			}
+			if edge.Label() != "" {
+				fmt.Fprintf(bw, " %s", quoteField(edge.Label()))
+			}
+			bw.WriteString("\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// StructurallyEqual reports whether two graphs have the same block
+// names, the same entries (and virtual entry name), and for every
+// block the same sequence of successors with the same kinds and
+// labels. Profile counts and weights are not compared.
+//
+func (cfg *CFG[K]) StructurallyEqual(other *CFG[K]) bool {
+	if len(cfg.bb) != len(other.bb) {
+		return false
+	}
+	name := func(bb *BasicBlock[K]) *K {
+		if bb == nil {
+			return nil
+		}
+		n := bb.Name()
+		return &n
+	}
+	sameName := func(a, b *BasicBlock[K]) bool {
+		na, nb := name(a), name(b)
+		return (na == nil) == (nb == nil) && (na == nil || *na == *nb)
+	}
+
+	if !sameName(cfg.startNode, other.startNode) ||
+		!sameName(cfg.virtualEntry, other.virtualEntry) {
+		return false
+	}
+	for n, bb := range cfg.bb {
+		ob := other.bb[n]
+		if ob == nil || bb.NumSucc() != ob.NumSucc() || bb.NumPred() != ob.NumPred() {
+			return false
+		}
+		for i, j := bb.OutEdges().Front(), ob.OutEdges().Front(); i != nil; i, j = i.Next(), j.Next() {
+			e, oe := i.Value.(*BasicBlockEdge[K]), j.Value.(*BasicBlockEdge[K])
+			if e.Dst().Name() != oe.Dst().Name() || e.Kind() != oe.Kind() || e.Label() != oe.Label() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// LineScanner is a bufio.Scanner over lines that enforces the total
+// size and line length limits. The importers for other formats read
+// their input through it too.
+//
+type LineScanner struct {
+	*bufio.Scanner
+	input  *limitedReader
+	limits Limits
+}
+
+func NewLineScanner(r io.Reader, limits Limits) *LineScanner {
+	s := &LineScanner{limits: limits}
+	if limits.MaxBytes > 0 {
+		s.input = &limitedReader{r: r, n: limits.MaxBytes}
+		r = s.input
+	}
+	s.Scanner = bufio.NewScanner(r)
+	if limits.MaxLine > 0 {
+		s.Buffer(make([]byte, 0, min(limits.MaxLine+1, 4096)), limits.MaxLine+1)
+	} else {
+		s.Buffer(nil, 1<<30)
+	}
+	return s
+}
+
+// Scan stops, with an error, as soon as the input is known to be too
+// large, so that a line cut short by the limit is never returned.
+//
+func (s *LineScanner) Scan() bool {
+	return s.Scanner.Scan() && s.Err() == nil
+}
+
+func (s *LineScanner) Err() error {
+	switch {
+	case s.input != nil && s.input.exceeded:
+		return fmt.Errorf("input larger than %d bytes", s.limits.MaxBytes)
+	case s.Scanner.Err() == bufio.ErrTooLong:
+		return fmt.Errorf("line longer than %d bytes", s.limits.MaxLine)
+	}
+	return s.Scanner.Err()
+}
+
+// limitedReader is io.LimitedReader, except that it notes whether
+// there was more input past the limit.
+//
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n <= 0 && err == nil {
+		var probe [1]byte
+		if m, _ := io.ReadFull(l.r, probe[:]); m > 0 {
+			l.exceeded = true
+		}
+	}
+	return n, err
+}
+
+// splitFields breaks a line into blank-separated fields, decoding
+// double-quoted fields and dropping a trailing '#' comment.
+//
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	for {
+		line = strings.TrimLeft(line, " \t\r")
+		if line == "" || line[0] == '#' {
+			return fields, nil
+		}
+		if line[0] == '"' {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, fmt.Errorf("bad quoted field %s", line)
+			}
+			field, _ := strconv.Unquote(quoted)
+			fields = append(fields, field)
+			line = line[len(quoted):]
+			if line != "" && !strings.ContainsRune(" \t\r#", rune(line[0])) {
+				return nil, fmt.Errorf("missing blank after %s", quoted)
+			}
+			continue
+		}
+		end := strings.IndexAny(line, " \t\r#")
+		if end < 0 {
+			end = len(line)
+		}
+		if strings.IndexByte(line[:end], '"') >= 0 {
+			return nil, fmt.Errorf("stray quote in %q", line[:end])
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+}
+
+// quoteField quotes a field if splitFields would not read it back
+// as a single field.
+//
+func quoteField(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"#\\") || !strconv.CanBackquote(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
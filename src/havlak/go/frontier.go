@@ -0,0 +1,135 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//======================================================
+// Dominance Frontiers and Phi Placement
+//======================================================
+
+// The dominance frontier of block 'x' is the set of blocks 'y' such
+// that 'x' dominates a predecessor of 'y' but does not strictly
+// dominate 'y': where the definitions made in 'x' meet others. It is
+// computed as Cooper, Harvey and Kennedy do, walking up the tree
+// from every predecessor of a block to its immediate dominator.
+//
+// A variable defined in a set of blocks needs a phi node in the
+// iterated dominance frontier of the set, the closure of the
+// frontier under adding the phis themselves as definitions (Cytron
+// et al.). That is minimal SSA; pruned SSA also leaves out the phis
+// of variables not live into the block, which the caller tells from
+// its own liveness analysis. The header of a loop in which a
+// variable is assigned is in the frontier of the assigning block, so
+// most phis end up on the headers the loop finder reports.
+
+package dominators
+
+import "./basicblock"
+
+// Frontiers holds the dominance frontier of every block of a tree.
+//
+type Frontiers[K comparable] struct {
+	tree *Tree[K]
+	df   map[*cfg.BasicBlock[K]][]*cfg.BasicBlock[K]
+}
+
+// ComputeFrontiers finds the dominance frontiers of the blocks in
+// 't'. Edges from unreachable blocks are ignored.
+//
+func ComputeFrontiers[K comparable](t *Tree[K]) *Frontiers[K] {
+	f := &Frontiers[K]{tree: t, df: make(map[*cfg.BasicBlock[K]][]*cfg.BasicBlock[K])}
+	for _, bb := range t.vertex {
+		idom := t.Idom(bb)
+		for ll := bb.InEdges().Front(); ll != nil; ll = ll.Next() {
+			pred := ll.Value.(*cfg.BasicBlockEdge[K]).Src()
+			if !t.Reachable(pred) {
+				continue
+			}
+			for runner := pred; runner != nil && runner != idom; runner = t.Idom(runner) {
+				df := f.df[runner]
+				if len(df) > 0 && df[len(df)-1] == bb {
+					break // already walked from another predecessor
+				}
+				f.df[runner] = append(df, bb)
+			}
+		}
+	}
+	for _, df := range f.df {
+		cfg.SortBlocks(df)
+	}
+	return f
+}
+
+// Frontier returns the dominance frontier of 'bb' in Blocks order.
+//
+func (f *Frontiers[K]) Frontier(bb *cfg.BasicBlock[K]) []*cfg.BasicBlock[K] {
+	return f.df[bb]
+}
+
+// Iterated returns the iterated dominance frontier of 'blocks', in
+// Blocks order.
+//
+func (f *Frontiers[K]) Iterated(blocks map[*cfg.BasicBlock[K]]bool) []*cfg.BasicBlock[K] {
+	return f.place(blocks, nil)
+}
+
+// place is the worklist algorithm of Cytron et al. A block where
+// 'live' is false gets no phi, and so defines nothing new.
+//
+func (f *Frontiers[K]) place(defs map[*cfg.BasicBlock[K]]bool, live func(*cfg.BasicBlock[K]) bool) []*cfg.BasicBlock[K] {
+	var phis, work []*cfg.BasicBlock[K]
+	queued := make(map[*cfg.BasicBlock[K]]bool)
+	hasPhi := make(map[*cfg.BasicBlock[K]]bool)
+	for bb, ok := range defs {
+		if ok {
+			queued[bb] = true
+			work = append(work, bb)
+		}
+	}
+	for len(work) > 0 {
+		x := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, y := range f.df[x] {
+			if hasPhi[y] || live != nil && !live(y) {
+				continue
+			}
+			hasPhi[y] = true
+			phis = append(phis, y)
+			if !queued[y] {
+				queued[y] = true
+				work = append(work, y)
+			}
+		}
+	}
+	cfg.SortBlocks(phis)
+	return phis
+}
+
+// PlacePhis returns, for every variable of 'defs', the blocks that
+// need a phi node for it, in Blocks order; variables needing none
+// are left out. defs[v] is the set of blocks assigning 'v'. If
+// 'liveIn' is not nil, liveIn[bb][v] says whether 'v' is live on
+// entry to 'bb', and phis of dead variables are pruned.
+//
+func PlacePhis[K comparable](f *Frontiers[K], defs map[string]map[*cfg.BasicBlock[K]]bool, liveIn map[*cfg.BasicBlock[K]]map[string]bool) map[string][]*cfg.BasicBlock[K] {
+	phis := make(map[string][]*cfg.BasicBlock[K])
+	for v, blocks := range defs {
+		var live func(*cfg.BasicBlock[K]) bool
+		if liveIn != nil {
+			live = func(bb *cfg.BasicBlock[K]) bool { return liveIn[bb][v] }
+		}
+		if p := f.place(blocks, live); len(p) > 0 {
+			phis[v] = p
+		}
+	}
+	return phis
+}
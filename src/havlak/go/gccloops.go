@@ -0,0 +1,178 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Loop nests of functions in GCC dumps.
+//
+// Usage: gccloops [-cfg] file.c.015t.cfg ...
+//
+// Builds the CFG of every function in the given -fdump-tree-cfg
+// dumps, runs the Havlak loop finder on it and prints the loop tree
+// with blocks named by GCC's block numbers. GCC finds loops by
+// dominance and leaves irreducible regions out of its loop tree, so
+// the reducible loops found must be exactly GCC's: the same headers,
+// blocks and nesting. Any difference is reported and makes the exit
+// status 1. Dumps of the passes after the loop optimizers have no
+// loop tree to compare with. With -cfg, the CFG is printed first, in
+// the edge-list format.
+//
+// The fixtures in testdata/gcc are checked with 'make check-gcc'.
+//
+package main
+
+import "flag"
+import "fmt"
+import "os"
+import "sort"
+import "./lsg"
+import "./havlakloopfinder"
+import "./gimple"
+
+var printCFG = flag.Bool("cfg", false, "print the CFG of every function")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: gccloops [-cfg] file.cfg ...\n")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gccloops: %v\n", err)
+			status = 1
+			continue
+		}
+		fns, err := gimple.Read(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gccloops: %s: %v\n", path, err)
+			status = 1
+			continue
+		}
+
+		for _, fn := range fns {
+			lsgraph := lsg.NewLSG()
+			havlakloopfinder.FindHavlakLoops(fn.CFG, lsgraph)
+			lsgraph.CalculateNestingLevel()
+
+			numEdges := 0
+			for _, bb := range fn.CFG.Blocks() {
+				numEdges += bb.NumSucc()
+			}
+			fmt.Printf("%s: %d blocks, %d edges, %d loops\n",
+				fn.Name, fn.CFG.NumNodes(), numEdges, lsgraph.NumLoops())
+			if *printCFG {
+				if err := fn.CFG.WriteEdgeList(os.Stdout); err != nil {
+					fmt.Fprintf(os.Stderr, "gccloops: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if err := lsgraph.WriteNest(os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "gccloops: %v\n", err)
+				os.Exit(1)
+			}
+			if fn.Loops == nil {
+				continue
+			}
+			if diff := compareLoops(lsgraph, fn.Loops); diff != "" {
+				fmt.Fprintf(os.Stderr, "gccloops: %s: %s: %s\n", path, fn.Name, diff)
+				status = 1
+			}
+		}
+	}
+	os.Exit(status)
+}
+
+// compareLoops describes the first difference between the reducible
+// loops found and GCC's loop tree, or returns "" if they agree.
+//
+func compareLoops(lsgraph *lsg.LSG[int], loops []*gimple.Loop) string {
+	byNum := make(map[int]*gimple.Loop)
+	byHeader := make(map[int]*gimple.Loop)
+	for _, l := range loops {
+		byNum[l.Num] = l
+		byHeader[l.Header] = l
+	}
+
+	found := 0
+	for _, loop := range lsgraph.Loops() {
+		if !loop.IsReducible() {
+			continue
+		}
+		found++
+		header := loop.Header().Name()
+		l := byHeader[header]
+		if l == nil {
+			return fmt.Sprintf("GCC has no loop at bb %d", header)
+		}
+
+		var blocks []int
+		for bb, _ := range loop.AllBlocks() {
+			blocks = append(blocks, bb.Name())
+		}
+		if !sameBlocks(blocks, l.Nodes) {
+			return fmt.Sprintf("loop at bb %d has blocks %v, GCC's loop %d has %v",
+				header, sorted(blocks), l.Num, sorted(l.Nodes))
+		}
+
+		outer, gccOuter := -1, -1
+		if p := reducibleParent(loop); p != nil {
+			outer = p.Header().Name()
+		}
+		if o := byNum[l.Outer]; o != nil {
+			gccOuter = o.Header
+		}
+		if outer != gccOuter {
+			return fmt.Sprintf("loop at bb %d is in the loop at bb %d, GCC's loop %d in the loop at bb %d",
+				header, outer, l.Num, gccOuter)
+		}
+	}
+	if found != len(loops) {
+		return fmt.Sprintf("%d reducible loops found, GCC has %d", found, len(loops))
+	}
+	return ""
+}
+
+// reducibleParent is the innermost reducible loop around 'loop', or
+// nil if there is none.
+//
+func reducibleParent(loop *lsg.SimpleLoop[int]) *lsg.SimpleLoop[int] {
+	for p := loop.Parent(); p != nil && !p.IsRoot(); p = p.Parent() {
+		if p.IsReducible() {
+			return p
+		}
+	}
+	return nil
+}
+
+func sameBlocks(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = sorted(a), sorted(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sorted(s []int) []int {
+	s = append([]int(nil), s...)
+	sort.Ints(s)
+	return s
+}
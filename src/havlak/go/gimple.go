@@ -0,0 +1,629 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Control flow graphs from GCC's GIMPLE dumps.
+//
+// Read takes the .cfg file that gcc -fdump-tree-cfg writes, or any
+// later GIMPLE dump, with or without the -blocks and -details
+// options. Each ';; Function' in the dump becomes a CFG whose blocks
+// are named by GCC's block numbers; ENTRY and EXIT (0 and 1) are
+// left out and the first block of the body is the start node.
+//
+// A block begins at '<bb N>' or at ';;   basic block N'. The edges
+// come from its statements:
+//
+//    if (...) goto <bb t>; else goto <bb f>;
+//                                      t taken, f fallthrough
+//    goto <bb d>;                      fallthrough
+//    switch (x) <default: <L4>, case 0: <L0>, case 1 ... 2: <L1>>
+//                                      case, labeled "default",
+//                                      "0" or "1 ... 2"
+//    return, resx                      no successors
+//
+// and any other block falls through to the next one. GCC states the
+// successors of each block as well, in ';; N succs { ... }' lines
+// and, with -blocks, in ';;    succ:' annotations. Where it does,
+// those are the successors: an implied fallthrough GCC does not list
+// is dropped (a call that does not return), and a successor that no
+// statement names (an EH or abnormal edge) becomes an exceptional
+// edge, labeled "eh" or "abnormal" when the annotation says which.
+//
+// GCC's own loop tree, printed ahead of each function in the dumps
+// of the passes that keep it, is kept in Function.Loops for
+// comparison with the loops found on the CFG.
+//
+package gimple
+
+import "fmt"
+import "io"
+import "strconv"
+import "strings"
+import "./basicblock"
+
+// Function is the CFG of one function in a dump.
+//
+type Function struct {
+	Name    string // as GCC prints it, not mangled
+	AsmName string // the assembler name, mangled for C++
+	Line    int    // of the ';; Function' header
+	CFG     *cfg.CFG[int]
+	Loops   []*Loop // GCC's loop tree, nil if the dump has none
+}
+
+// Loop is one loop of GCC's loop tree. Loop 0, the function itself,
+// is the outermost and not listed.
+//
+type Loop struct {
+	Num    int
+	Header int
+	Latch  int   // -1 for a loop with several latches
+	Depth  int   // 1 for an outermost loop
+	Outer  int   // the number of the enclosing loop, 0 if none
+	Nodes  []int // with the blocks of inner loops
+}
+
+// Read parses a dump with cfg.DefaultLimits, applying MaxBlocks and
+// MaxEdges to each function.
+//
+func Read(r io.Reader) ([]*Function, error) {
+	return ReadLimits(r, cfg.DefaultLimits)
+}
+
+// ReadLimits parses a dump, failing as soon as the input exceeds
+// 'limits'.
+//
+func ReadLimits(r io.Reader, limits cfg.Limits) ([]*Function, error) {
+	p := &parser{limits: limits}
+	scanner := cfg.NewLineScanner(r, limits)
+	for scanner.Scan() {
+		p.lineno++
+		if err := p.line(scanner.Text()); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, &cfg.SyntaxError{Line: p.lineno + 1, Msg: err.Error()}
+	}
+	if p.fn != nil && p.inBody {
+		return nil, p.errorf("function %s is not closed", p.fn.Name)
+	}
+	return p.fns, nil
+}
+
+//-----------------------------------------------------------
+
+// block is a basic block whose successors are not resolved yet;
+// a goto may name a block or label further down.
+//
+type block struct {
+	num   int
+	line  int
+	edges []edge
+	cond  bool // in an 'if', before its 'else'
+	ends  bool // does not fall through to the next block
+
+	annotated bool   // has ';;    succ:' lines
+	succs     []succ // from those lines
+}
+
+// edge is a successor named by a statement: a block number, or a
+// label to look up when the function is complete.
+//
+type edge struct {
+	num   int
+	to    string // label, if num < 0
+	kind  cfg.EdgeKind
+	label string
+	line  int
+}
+
+// succ is a successor that GCC lists, with the flags of its
+// annotation, if any.
+//
+type succ struct {
+	num   int
+	flags string
+}
+
+type parser struct {
+	limits cfg.Limits
+	lineno int
+	fns    []*Function
+
+	fn      *Function // being parsed, nil before the first
+	inBody  bool      // between the function's '{' and '}'
+	loop    *Loop     // in the loop tree, being read
+	succs   map[int][]succ
+	blocks  []*block
+	byNum   map[int]*block
+	current *block
+	labels  map[string]int
+	inSucc  bool // in a ';;    succ:' annotation
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &cfg.SyntaxError{Line: p.lineno, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) line(text string) error {
+	if strings.HasPrefix(text, ";; Function ") {
+		if p.fn != nil && p.inBody {
+			return p.errorf("function %s is not closed", p.fn.Name)
+		}
+		return p.function(text[len(";; Function "):])
+	}
+	if p.fn == nil {
+		return nil
+	}
+	if strings.HasPrefix(text, ";;") {
+		return p.comment(strings.TrimSpace(text[2:]))
+	}
+	p.inSucc = false
+
+	switch {
+	case text == "{" && !p.inBody:
+		p.inBody = true
+		return nil
+	case !p.inBody:
+		return nil
+	case text == "}":
+		return p.finish()
+	}
+
+	stmt := strings.TrimSpace(text)
+	if strings.HasPrefix(stmt, "<bb ") {
+		n, rest, ok := blockRef(stmt)
+		for ok && strings.HasPrefix(rest, "[") {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				break
+			}
+			rest = strings.TrimSpace(rest[end+1:])
+		}
+		if !ok || rest != ":" {
+			return p.errorf("malformed block header %q", stmt)
+		}
+		return p.newBlock(n)
+	}
+	if p.current == nil || stmt == "" {
+		return nil
+	}
+	return p.statement(stmt)
+}
+
+// function starts a function at its header, which is
+// 'name (asmname, funcdef_no=0, ...)' or, from older GCCs,
+// 'name (asmname)'. A C++ name may have spaces and parentheses.
+//
+func (p *parser) function(header string) error {
+	open := strings.LastIndex(header, " (")
+	if open <= 0 || !strings.HasSuffix(header, ")") {
+		return p.errorf("malformed function header")
+	}
+	asm := header[open+2 : len(header)-1]
+	if comma := strings.IndexByte(asm, ','); comma >= 0 {
+		asm = asm[:comma]
+	}
+	p.fn = &Function{Name: header[:open], AsmName: asm, Line: p.lineno}
+	p.inBody, p.loop, p.inSucc = false, nil, false
+	p.succs = make(map[int][]succ)
+	p.blocks, p.current = nil, nil
+	p.byNum = make(map[int]*block)
+	p.labels = make(map[string]int)
+	return nil
+}
+
+// comment reads the ';;' lines that carry the loop tree, the
+// successor lists and the -blocks annotations; other ones are
+// skipped.
+//
+func (p *parser) comment(text string) error {
+	fields := strings.Fields(strings.NewReplacer(",", " ", "{", " { ", "}", " } ").Replace(text))
+	if len(fields) == 0 {
+		p.loop = nil
+		return nil
+	}
+
+	switch {
+	case len(fields) == 3 && fields[1] == "loops" && fields[2] == "found":
+		p.fn.Loops = []*Loop{}
+		p.loop = nil
+		return nil
+
+	case len(fields) == 2 && fields[0] == "Loop":
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 0 {
+			return p.errorf("malformed loop number %q", fields[1])
+		}
+		p.loop = nil
+		if n > 0 {
+			p.loop = &Loop{Num: n}
+			p.fn.Loops = append(p.fn.Loops, p.loop)
+		}
+		return nil
+
+	case p.loop != nil && (fields[0] == "header" || fields[0] == "depth"):
+		// header H, latch L
+		// header H, multiple latches: L1 L2 ...
+		// depth D, outer O
+		if fields[0] == "header" && len(fields) >= 4 &&
+			fields[2] == "multiple" && fields[3] == "latches:" {
+			fields = []string{"header", fields[1], "latch", "-1"}
+		}
+		if len(fields) != 4 {
+			return p.errorf("malformed loop %s", fields[0])
+		}
+		a, err1 := strconv.Atoi(fields[1])
+		b, err2 := strconv.Atoi(fields[3])
+		if err1 != nil || err2 != nil {
+			return p.errorf("malformed loop %s", fields[0])
+		}
+		if fields[0] == "header" {
+			p.loop.Header, p.loop.Latch = a, b
+		} else {
+			p.loop.Depth, p.loop.Outer = a, b
+		}
+		return nil
+
+	case p.loop != nil && fields[0] == "nodes:":
+		for _, f := range fields[1:] {
+			n, err := strconv.Atoi(f)
+			if err != nil {
+				return p.errorf("malformed loop node %q", f)
+			}
+			p.loop.Nodes = append(p.loop.Nodes, n)
+		}
+		return nil
+
+	case len(fields) >= 4 && fields[1] == "succs" && fields[2] == "{" &&
+		fields[len(fields)-1] == "}":
+		// N succs { a b ... }
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return p.errorf("malformed successor list")
+		}
+		list := []succ{}
+		for _, f := range fields[3 : len(fields)-1] {
+			s, err := strconv.Atoi(f)
+			if err != nil {
+				return p.errorf("malformed successor %q", f)
+			}
+			list = append(list, succ{num: s})
+		}
+		p.succs[n] = list
+		return nil
+
+	case len(fields) >= 3 && fields[0] == "basic" && fields[1] == "block":
+		// basic block N, loop depth D, ...
+		n, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return p.errorf("malformed block annotation")
+		}
+		p.inSucc = false
+		if !p.inBody {
+			return nil
+		}
+		return p.newBlock(n)
+
+	case fields[0] == "succ:":
+		if !p.inBody {
+			// Of a block being removed, ahead of the body.
+			return nil
+		}
+		if p.current == nil {
+			return p.errorf("successor annotation outside a block")
+		}
+		p.inSucc = true
+		p.current.annotated = true
+		return p.annotation(strings.TrimSpace(text[len("succ:"):]))
+
+	case fields[0] == "pred:":
+		p.inSucc = false
+		return nil
+
+	case p.inSucc:
+		return p.annotation(text)
+	}
+	p.loop = nil
+	return nil
+}
+
+// annotation reads one successor of a ';;    succ:' annotation,
+// such as '7 (FALLTHRU) loops.c:4:3', 'EXIT' or, with -details,
+// '3 [50.0% (guessed)]  count:5 (TRUE_VALUE,EXECUTABLE)'.
+//
+func (p *parser) annotation(text string) error {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil
+	}
+	if fields[0] == "EXIT" {
+		return nil
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil {
+		// Any other comment ends the annotation.
+		p.inSucc = false
+		return nil
+	}
+	s := succ{num: n}
+	for _, f := range fields[1:] {
+		if len(f) > 2 && f[0] == '(' && f[len(f)-1] == ')' &&
+			strings.ToUpper(f) == f {
+			s.flags = f[1 : len(f)-1]
+		}
+	}
+	p.current.succs = append(p.current.succs, s)
+	return nil
+}
+
+func (p *parser) newBlock(n int) error {
+	if p.current != nil && p.current.num == n {
+		// Both '<bb N>' and ';;   basic block N'.
+		return nil
+	}
+	if n < 2 {
+		return p.errorf("block %d in the body", n)
+	}
+	if p.byNum[n] != nil {
+		return p.errorf("bb %d defined twice", n)
+	}
+	if p.limits.MaxBlocks > 0 && len(p.blocks) >= p.limits.MaxBlocks {
+		return p.errorf("more than %d blocks in %s", p.limits.MaxBlocks, p.fn.Name)
+	}
+	p.current = &block{num: n, line: p.lineno}
+	p.blocks = append(p.blocks, p.current)
+	p.byNum[n] = p.current
+	return nil
+}
+
+func (p *parser) statement(stmt string) error {
+	b := p.current
+	switch {
+	case strings.HasSuffix(stmt, ":") && isLabel(stmt[:len(stmt)-1]):
+		p.labels[stmt[:len(stmt)-1]] = b.num
+
+	case strings.HasPrefix(stmt, "if ("):
+		b.cond = true
+		b.ends = true
+
+	case stmt == "else":
+		b.cond = false
+
+	case strings.HasPrefix(stmt, "goto "):
+		e, ok := target(strings.TrimSpace(stmt[len("goto "):]))
+		if !ok {
+			// A computed goto; its successors are GCC's to list.
+			b.ends = true
+			return nil
+		}
+		e.kind, e.line = cfg.EdgeFallthrough, p.lineno
+		if b.cond {
+			e.kind = cfg.EdgeTaken
+		}
+		b.edges = append(b.edges, e)
+		b.ends = true
+
+	case strings.HasPrefix(stmt, "switch ("):
+		return p.switchStatement(stmt)
+
+	case stmt == "return;" || strings.HasPrefix(stmt, "return ") ||
+		strings.HasPrefix(stmt, "resx "):
+		b.ends = true
+	}
+	return nil
+}
+
+// switchStatement reads the cases of
+// 'switch (x) <default: <L4> [INV], case 0: <L0> [INV], ...>'.
+//
+func (p *parser) switchStatement(stmt string) error {
+	b := p.current
+	open := strings.Index(stmt, ") <")
+	if open < 0 || !strings.HasSuffix(stmt, ">") {
+		return p.errorf("malformed switch")
+	}
+	cases := stmt[open+3 : len(stmt)-1]
+	for _, c := range strings.Split(cases, ", ") {
+		colon := strings.Index(c, ": ")
+		if colon < 0 {
+			return p.errorf("malformed switch case %q", c)
+		}
+		e, ok := target(c[colon+2:])
+		if !ok {
+			return p.errorf("malformed switch case %q", c)
+		}
+		e.kind, e.line = cfg.EdgeSwitchCase, p.lineno
+		e.label = strings.TrimPrefix(c[:colon], "case ")
+		b.edges = append(b.edges, e)
+	}
+	b.ends = true
+	return nil
+}
+
+// blockRef parses '<bb N>' at the start of s.
+//
+func blockRef(s string) (int, string, bool) {
+	if !strings.HasPrefix(s, "<bb ") {
+		return 0, s, false
+	}
+	end := strings.IndexByte(s, '>')
+	if end < 0 {
+		return 0, s, false
+	}
+	n, err := strconv.Atoi(s[len("<bb "):end])
+	if err != nil {
+		return 0, s, false
+	}
+	return n, strings.TrimSpace(s[end+1:]), true
+}
+
+// target parses the destination of a goto or switch case: '<bb N>',
+// '<bb N> (<L2>)', or a label such as '<L2>' or 'out', followed by
+// ';' and a probability.
+//
+func target(s string) (edge, bool) {
+	if n, _, ok := blockRef(s); ok {
+		return edge{num: n}, true
+	}
+	end := strings.IndexAny(s, "; ")
+	if end >= 0 {
+		s = s[:end]
+	}
+	if !isLabel(s) {
+		return edge{}, false
+	}
+	return edge{num: -1, to: s}, true
+}
+
+// isLabel tells whether s is a GIMPLE label: an artificial one like
+// '<L4>' or '<D.2345>', or a C identifier.
+//
+func isLabel(s string) bool {
+	if len(s) > 2 && s[0] == '<' && s[len(s)-1] == '>' {
+		s = s[1 : len(s)-1]
+		return !strings.ContainsAny(s, " <>")
+	}
+	if s == "" || s == "else" || s == "default" || ('0' <= s[0] && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+			'0' <= c && c <= '9' || c == '_' || c == '.' || c == '$') {
+			return false
+		}
+	}
+	return true
+}
+
+// finish resolves the successors of every block and builds the
+// function's CFG.
+//
+func (p *parser) finish() error {
+	if len(p.blocks) == 0 {
+		return p.errorf("function %s has no blocks", p.fn.Name)
+	}
+
+	g := cfg.NewCFGOf[int]()
+	for _, b := range p.blocks {
+		g.CreateNode(b.num)
+	}
+	numEdges := 0
+	for i, b := range p.blocks {
+		edges, err := p.successors(b, i)
+		if err != nil {
+			return err
+		}
+		numEdges += len(edges)
+		if p.limits.MaxEdges > 0 && numEdges > p.limits.MaxEdges {
+			return p.errorf("more than %d edges in %s", p.limits.MaxEdges, p.fn.Name)
+		}
+		for _, e := range edges {
+			cfg.NewBasicBlockEdgeOfKind(g, b.num, e.num, e.kind).SetLabel(e.label)
+		}
+	}
+	g.SetStart(p.blocks[0].num)
+
+	for _, loop := range p.fn.Loops {
+		nodes := append([]int{loop.Header}, loop.Nodes...)
+		for _, n := range nodes {
+			if p.byNum[n] == nil {
+				return p.errorf("loop %d of %s has undefined bb %d", loop.Num, p.fn.Name, n)
+			}
+		}
+	}
+
+	p.fn.CFG = g
+	p.fns = append(p.fns, p.fn)
+	p.fn = nil
+	p.inBody = false
+	return nil
+}
+
+// successors returns the edges out of b, the i'th block: those its
+// statements name or imply, reconciled with the successors GCC lists.
+//
+func (p *parser) successors(b *block, i int) ([]edge, error) {
+	var edges []edge
+	for _, e := range b.edges {
+		if e.num < 0 {
+			n, ok := p.labels[e.to]
+			if !ok {
+				p.lineno = e.line
+				return nil, p.errorf("jump to undefined label %s", e.to)
+			}
+			e.num = n
+		}
+		if p.byNum[e.num] == nil {
+			p.lineno = e.line
+			return nil, p.errorf("jump to undefined bb %d", e.num)
+		}
+		edges = append(edges, e)
+	}
+	implied := !b.ends && i+1 < len(p.blocks)
+	if implied {
+		edges = append(edges, edge{num: p.blocks[i+1].num, kind: cfg.EdgeFallthrough, line: b.line})
+	}
+
+	listed, ok := p.succs[b.num]
+	if b.annotated {
+		listed, ok = b.succs, true
+	}
+	if !ok {
+		return edges, nil
+	}
+
+	want := make(map[int]bool)
+	for _, s := range listed {
+		if s.num == 1 {
+			continue
+		}
+		if p.byNum[s.num] == nil {
+			p.lineno = b.line
+			return nil, p.errorf("bb %d has undefined successor %d", b.num, s.num)
+		}
+		want[s.num] = true
+	}
+	named := make(map[int]bool)
+	kept := edges[:0]
+	for j, e := range edges {
+		if !want[e.num] {
+			if implied && j == len(edges)-1 {
+				continue
+			}
+			p.lineno = e.line
+			return nil, p.errorf("bb %d jumps to bb %d, which is not among its successors", b.num, e.num)
+		}
+		named[e.num] = true
+		kept = append(kept, e)
+	}
+	for _, s := range listed {
+		if s.num == 1 || named[s.num] {
+			continue
+		}
+		named[s.num] = true
+		e := edge{num: s.num, kind: cfg.EdgeExceptional}
+		for _, f := range strings.Split(s.flags, ",") {
+			switch f {
+			case "EH":
+				e.label = "eh"
+			case "ABNORMAL":
+				e.label = "abnormal"
+			}
+		}
+		kept = append(kept, e)
+	}
+	return kept, nil
+}
@@ -0,0 +1,549 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Control flow graphs for Go functions.
+//
+// Build parses nothing itself; it takes a file from go/parser and
+// produces one int-named CFG per function and function literal,
+// with the source position at which every block starts. Blocks are
+// numbered in the order they are created: 0 is the entry, 1 the
+// single exit. Statements are grouped into blocks the usual way:
+//
+//    if        the condition block branches to "then" (taken) and
+//              "else" (fallthrough) and both rejoin after the if.
+//    for/range the loop header, at the for/range keyword, branches
+//              to the body (taken) and the exit; the body flows to
+//              the post statement, if any, and back to the header.
+//    switch    the tag block has a case edge to every clause, and to
+//              the end of the switch if there is no default.
+//    select    like switch; a select without default only waits.
+//    break, continue, goto, fallthrough, labels
+//              jump to the block of their target.
+//    return    jumps to the exit, through a block that stands for
+//              the deferred calls if the function contains a defer.
+//    panic     calls are treated like return, with an exceptional
+//              edge.
+//
+// Code that follows a jump starts a new block without predecessors,
+// which the loop finder reports as dead.
+//
+package gocfg
+
+import "bytes"
+import "fmt"
+import "go/ast"
+import "go/printer"
+import "go/token"
+import "io"
+import "sort"
+import "./basicblock"
+import "./lsg"
+import "./havlakloopfinder"
+
+// Function is the CFG of one function or function literal.
+//
+type Function struct {
+	Name     string
+	Pos      token.Pos
+	CFG      *cfg.CFG[int]
+	BlockPos map[int]token.Pos // where each block starts
+	Exit     int               // the single exit block
+}
+
+// Build returns the CFGs of all functions with bodies in 'file',
+// each followed by those of the function literals it contains, in
+// source order. Functions and literals are named as the gc compiler
+// of Go 1.22 names them, generic functions aside: "F.func1",
+// "F.func2", and so on for the literals directly in F, "F.func1.1"
+// for the first one inside F.func1. Those at package level are
+// "init.func1", and so on, numbered across the whole file, and the
+// init functions themselves are "init.0", "init.1", and so on.
+//
+func Build(fset *token.FileSet, file *ast.File) []*Function {
+	var fns []*Function
+	var literals func(outer, format string, n ast.Node, count *int)
+	literals = func(outer, format string, n ast.Node, count *int) {
+		ast.Inspect(n, func(n ast.Node) bool {
+			lit, ok := n.(*ast.FuncLit)
+			if !ok {
+				return true
+			}
+			*count++
+			name := outer + fmt.Sprintf(format, *count)
+			fns = append(fns, BuildFunc(fset, name, lit.Pos(), lit.Body))
+			literals(name, ".%d", lit.Body, new(int))
+			return false
+		})
+	}
+
+	inits, globals := 0, 0
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Body == nil {
+				continue
+			}
+			name := funcName(fset, decl)
+			if name == "init" {
+				name = fmt.Sprintf("init.%d", inits)
+				inits++
+			}
+			fns = append(fns, BuildFunc(fset, name, decl.Pos(), decl.Body))
+			literals(name, ".func%d", decl.Body, new(int))
+		case *ast.GenDecl:
+			literals("init", ".func%d", decl, &globals)
+		}
+	}
+	return fns
+}
+
+// BuildFunc builds the CFG of a single function body. Function
+// literals inside it are not followed; their code is not part of
+// this function's control flow.
+//
+func BuildFunc(fset *token.FileSet, name string, pos token.Pos, body *ast.BlockStmt) *Function {
+	fn := &Function{
+		Name:     name,
+		Pos:      pos,
+		CFG:      cfg.NewCFG(),
+		BlockPos: make(map[int]token.Pos),
+	}
+	b := &builder{fn: fn, fset: fset, labels: make(map[string]*labelInfo)}
+
+	entry := b.newBlock(body.Lbrace)
+	fn.CFG.SetStart(entry)
+	fn.Exit = b.newBlock(body.Rbrace)
+	b.returnTo = fn.Exit
+	if hasDefer(body) {
+		b.returnTo = b.newBlock(body.Rbrace)
+		b.edge(b.returnTo, fn.Exit, cfg.EdgeFallthrough, "")
+	}
+
+	b.current = entry
+	b.stmtList(body.List)
+	b.jump(b.returnTo, cfg.EdgeFallthrough, "")
+	return fn
+}
+
+// FindLoops runs Havlak's algorithm on the function and computes
+// the nesting levels.
+//
+func (fn *Function) FindLoops() *lsg.LSG[int] {
+	lsgraph := lsg.NewLSG()
+	havlakloopfinder.FindHavlakLoops(fn.CFG, lsgraph)
+	lsgraph.CalculateNestingLevel()
+	return lsgraph
+}
+
+// WriteReport prints the loop nest of a function, one loop per line,
+// indented by depth and ordered by the position of the loop header.
+//
+func WriteReport(w io.Writer, fset *token.FileSet, fn *Function) error {
+	lsgraph := fn.FindLoops()
+	if _, err := fmt.Fprintf(w, "%s: func %s: %d loops\n",
+		fset.Position(fn.Pos), fn.Name, lsgraph.NumLoops()); err != nil {
+		return err
+	}
+
+	var write func(loop *lsg.SimpleLoop[int], indent string) error
+	write = func(loop *lsg.SimpleLoop[int], indent string) error {
+		var children []*lsg.SimpleLoop[int]
+		for child, _ := range loop.Children() {
+			children = append(children, child)
+		}
+		sort.Slice(children, func(i, j int) bool {
+			return fn.BlockPos[children[i].Header().Name()] <
+				fn.BlockPos[children[j].Header().Name()]
+		})
+		for _, child := range children {
+			irreducible := ""
+			if !child.IsReducible() {
+				irreducible = " (irreducible)"
+			}
+			if _, err := fmt.Fprintf(w, "%s%s: loop header %v, depth %d, nesting %d%s\n",
+				indent, fset.Position(fn.BlockPos[child.Header().Name()]), child.Header(),
+				child.DepthLevel(), child.NestingLevel(), irreducible); err != nil {
+				return err
+			}
+			if err := write(child, indent+"  "); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return write(lsgraph.Root(), "  ")
+}
+
+//-----------------------------------------------------------
+
+// targets are the blocks that break and continue go to inside a
+// statement; -1 means the statement is not a target for that kind
+// of jump, so the search goes on outwards.
+//
+type targets struct {
+	outer        *targets
+	brk, cont    int
+	fallthroughs int
+}
+
+type labelInfo struct {
+	block     int // the labeled statement, for goto
+	brk, cont int // for labeled break and continue
+}
+
+type builder struct {
+	fn       *Function
+	fset     *token.FileSet
+	current  int // block being filled, -1 right after a jump
+	returnTo int
+	targets  *targets
+	labels   map[string]*labelInfo
+	label    *labelInfo // label of the statement being built
+}
+
+func (b *builder) newBlock(pos token.Pos) int {
+	name := b.fn.CFG.NumNodes()
+	b.fn.CFG.CreateNode(name)
+	b.fn.BlockPos[name] = pos
+	return name
+}
+
+func (b *builder) edge(from, to int, kind cfg.EdgeKind, label string) {
+	cfg.NewBasicBlockEdgeOfKind(b.fn.CFG, from, to, kind).SetLabel(label)
+}
+
+// jump ends the current block with an edge to 'to'.
+//
+func (b *builder) jump(to int, kind cfg.EdgeKind, label string) {
+	if b.current >= 0 {
+		b.edge(b.current, to, kind, label)
+	}
+	b.current = -1
+}
+
+// ensure starts an unreachable block if the previous statement jumped.
+//
+func (b *builder) ensure(pos token.Pos) {
+	if b.current < 0 {
+		b.current = b.newBlock(pos)
+	}
+}
+
+func (b *builder) labelBlock(name string, pos token.Pos) *labelInfo {
+	l := b.labels[name]
+	if l == nil {
+		l = &labelInfo{block: b.newBlock(pos), brk: -1, cont: -1}
+		b.labels[name] = l
+	}
+	return l
+}
+
+// push opens a break/continue scope, also recording the targets for
+// the label of the statement, if it has one.
+//
+func (b *builder) push(brk, cont int) {
+	b.targets = &targets{outer: b.targets, brk: brk, cont: cont, fallthroughs: -1}
+	if b.label != nil {
+		b.label.brk, b.label.cont = brk, cont
+		b.label = nil
+	}
+}
+
+func (b *builder) pop() {
+	b.targets = b.targets.outer
+}
+
+func (b *builder) source(n ast.Node) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, b.fset, n)
+	return buf.String()
+}
+
+func (b *builder) stmtList(list []ast.Stmt) {
+	for _, s := range list {
+		b.stmt(s)
+	}
+}
+
+func (b *builder) stmt(s ast.Stmt) {
+	label := b.label
+	b.label = nil
+
+	switch s := s.(type) {
+	case *ast.EmptyStmt:
+		// nothing
+
+	case *ast.BlockStmt:
+		b.stmtList(s.List)
+
+	case *ast.LabeledStmt:
+		l := b.labelBlock(s.Label.Name, s.Pos())
+		b.fn.BlockPos[l.block] = s.Pos()
+		b.jump(l.block, cfg.EdgeFallthrough, "")
+		b.current = l.block
+		b.label = l
+		b.stmt(s.Stmt)
+
+	case *ast.IfStmt:
+		b.ensure(s.Pos())
+		if s.Init != nil {
+			b.stmt(s.Init)
+		}
+		cond := b.current
+		then := b.newBlock(s.Body.Pos())
+		b.edge(cond, then, cfg.EdgeTaken, "then")
+		done := b.newBlock(s.End())
+		if s.Else != nil {
+			els := b.newBlock(s.Else.Pos())
+			b.edge(cond, els, cfg.EdgeFallthrough, "else")
+			b.current = els
+			b.stmt(s.Else)
+			b.jump(done, cfg.EdgeFallthrough, "")
+		} else {
+			b.edge(cond, done, cfg.EdgeFallthrough, "else")
+		}
+		b.current = then
+		b.stmt(s.Body)
+		b.jump(done, cfg.EdgeFallthrough, "")
+		b.current = done
+
+	case *ast.ForStmt:
+		b.ensure(s.Pos())
+		if s.Init != nil {
+			b.stmt(s.Init)
+		}
+		header := b.newBlock(s.Pos())
+		b.jump(header, cfg.EdgeFallthrough, "")
+		body := b.newBlock(s.Body.Pos())
+		done := b.newBlock(s.End())
+		cont := header
+		if s.Post != nil {
+			cont = b.newBlock(s.Post.Pos())
+		}
+		if s.Cond != nil {
+			b.edge(header, body, cfg.EdgeTaken, "body")
+			b.edge(header, done, cfg.EdgeFallthrough, "exit")
+		} else {
+			b.edge(header, body, cfg.EdgeFallthrough, "body")
+		}
+
+		b.label = label
+		b.push(done, cont)
+		b.current = body
+		b.stmt(s.Body)
+		b.jump(cont, cfg.EdgeFallthrough, "")
+		b.pop()
+
+		if s.Post != nil {
+			b.current = cont
+			b.stmt(s.Post)
+			b.jump(header, cfg.EdgeFallthrough, "")
+		}
+		b.current = done
+
+	case *ast.RangeStmt:
+		b.ensure(s.Pos())
+		header := b.newBlock(s.Pos())
+		b.jump(header, cfg.EdgeFallthrough, "")
+		body := b.newBlock(s.Body.Pos())
+		done := b.newBlock(s.End())
+		b.edge(header, body, cfg.EdgeTaken, "body")
+		b.edge(header, done, cfg.EdgeFallthrough, "exit")
+
+		b.label = label
+		b.push(done, header)
+		b.current = body
+		b.stmt(s.Body)
+		b.jump(header, cfg.EdgeFallthrough, "")
+		b.pop()
+		b.current = done
+
+	case *ast.SwitchStmt:
+		b.ensure(s.Pos())
+		if s.Init != nil {
+			b.stmt(s.Init)
+		}
+		b.label = label
+		b.switchBody(s.Body, s.End(), true)
+
+	case *ast.TypeSwitchStmt:
+		b.ensure(s.Pos())
+		if s.Init != nil {
+			b.stmt(s.Init)
+		}
+		b.stmt(s.Assign)
+		b.label = label
+		b.switchBody(s.Body, s.End(), true)
+
+	case *ast.SelectStmt:
+		b.ensure(s.Pos())
+		b.label = label
+		b.switchBody(s.Body, s.End(), false)
+
+	case *ast.BranchStmt:
+		b.ensure(s.Pos())
+		b.branch(s)
+
+	case *ast.ReturnStmt:
+		b.ensure(s.Pos())
+		b.jump(b.returnTo, cfg.EdgeFallthrough, "return")
+
+	case *ast.ExprStmt:
+		b.ensure(s.Pos())
+		if isPanic(s.X) {
+			b.jump(b.returnTo, cfg.EdgeExceptional, "panic")
+		}
+
+	default:
+		// Assignments, declarations, go and defer statements,
+		// sends and increments do not affect control flow.
+		b.ensure(s.Pos())
+	}
+}
+
+// switchBody builds the clauses of a switch, type switch or select.
+// For switches, a missing default means control can skip all cases.
+//
+func (b *builder) switchBody(body *ast.BlockStmt, end token.Pos, isSwitch bool) {
+	head := b.current
+	done := b.newBlock(end)
+	clauses := make([]int, len(body.List))
+	hasDefault := false
+
+	for i, clause := range body.List {
+		clauses[i] = b.newBlock(clause.Pos())
+		label := "default"
+		switch c := clause.(type) {
+		case *ast.CaseClause:
+			if c.List != nil {
+				var buf bytes.Buffer
+				for j, e := range c.List {
+					if j > 0 {
+						buf.WriteString(", ")
+					}
+					buf.WriteString(b.source(e))
+				}
+				label = buf.String()
+			} else {
+				hasDefault = true
+			}
+		case *ast.CommClause:
+			if c.Comm != nil {
+				label = b.source(c.Comm)
+			} else {
+				hasDefault = true
+			}
+		}
+		b.edge(head, clauses[i], cfg.EdgeSwitchCase, label)
+	}
+	if isSwitch && !hasDefault {
+		b.edge(head, done, cfg.EdgeSwitchCase, "default")
+	}
+
+	b.push(done, -1)
+	for i, clause := range body.List {
+		b.current = clauses[i]
+		if i+1 < len(clauses) {
+			b.targets.fallthroughs = clauses[i+1]
+		}
+		switch c := clause.(type) {
+		case *ast.CaseClause:
+			b.stmtList(c.Body)
+		case *ast.CommClause:
+			if c.Comm != nil {
+				b.stmt(c.Comm)
+			}
+			b.stmtList(c.Body)
+		}
+		b.jump(done, cfg.EdgeFallthrough, "")
+	}
+	b.pop()
+	b.current = done
+}
+
+func (b *builder) branch(s *ast.BranchStmt) {
+	target := -1
+	switch s.Tok {
+	case token.BREAK, token.CONTINUE:
+		if s.Label != nil {
+			if l := b.labels[s.Label.Name]; l != nil {
+				target = l.brk
+				if s.Tok == token.CONTINUE {
+					target = l.cont
+				}
+			}
+			break
+		}
+		for t := b.targets; t != nil && target < 0; t = t.outer {
+			target = t.brk
+			if s.Tok == token.CONTINUE {
+				target = t.cont
+			}
+		}
+	case token.GOTO:
+		target = b.labelBlock(s.Label.Name, s.Pos()).block
+	case token.FALLTHROUGH:
+		if b.targets != nil {
+			target = b.targets.fallthroughs
+		}
+	}
+
+	if target < 0 {
+		// Not valid Go; the type checker would have complained.
+		b.current = -1
+		return
+	}
+	b.jump(target, cfg.EdgeFallthrough, s.Tok.String())
+}
+
+// isPanic recognizes calls to the predeclared panic. Without type
+// information a local function named panic would also match.
+//
+func isPanic(x ast.Expr) bool {
+	call, ok := x.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	id, ok := call.Fun.(*ast.Ident)
+	return ok && id.Name == "panic"
+}
+
+func hasDefer(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.DeferStmt:
+			found = true
+		case *ast.FuncLit:
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+// funcName returns "F", "T.M" or "(*T).M".
+//
+func funcName(fset *token.FileSet, decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return decl.Name.Name
+	}
+	recv := decl.Recv.List[0].Type
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, recv)
+	if _, ok := recv.(*ast.StarExpr); ok {
+		return "(" + buf.String() + ")." + decl.Name.Name
+	}
+	return buf.String() + "." + decl.Name.Name
+}
@@ -0,0 +1,67 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Loop nests of Go functions.
+//
+// Usage: goloops [-cfg] file.go ...
+//
+// Builds the CFG of every function in the given files, runs the
+// Havlak loop finder on it and prints the loops with the source
+// position of their headers.
+// With -cfg, the CFG follows, in the edge-list format.
+//
+// The fixtures in testdata/go are checked with 'make check-go'.
+//
+package main
+
+import "flag"
+import "fmt"
+import "go/parser"
+import "go/token"
+import "os"
+import "./gocfg"
+
+var printCFG = flag.Bool("cfg", false, "print the CFG of every function")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: goloops [-cfg] file.go ...\n")
+		os.Exit(2)
+	}
+
+	fset := token.NewFileSet()
+	status := 0
+	for _, path := range flag.Args() {
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "goloops: %v\n", err)
+			status = 1
+			continue
+		}
+		for _, fn := range gocfg.Build(fset, file) {
+			if err := gocfg.WriteReport(os.Stdout, fset, fn); err != nil {
+				fmt.Fprintf(os.Stderr, "goloops: %v\n", err)
+				os.Exit(1)
+			}
+			if *printCFG {
+				if err := fn.CFG.WriteEdgeList(os.Stdout); err != nil {
+					fmt.Fprintf(os.Stderr, "goloops: %v\n", err)
+					os.Exit(1)
+				}
+			}
+		}
+	}
+	os.Exit(status)
+}
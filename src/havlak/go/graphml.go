@@ -0,0 +1,438 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// GraphML input and output for control flow graphs.
+//
+// WriteCFG writes a graph as
+//
+//    <graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+//      <key id="entry" for="node" attr.name="entry" attr.type="int"/>
+//      ...
+//      <graph id="cfg" edgedefault="directed">
+//        <node id="0">
+//          <data key="entry">1</data>
+//        </node>
+//        <node id="1"/>
+//        <edge source="0" target="1">
+//          <data key="kind">taken</data>
+//          <data key="label">then</data>
+//        </edge>
+//      </graph>
+//    </graphml>
+//
+// with node IDs as cfg.FormatName prints the block names, and ReadCFG
+// reads that back or what yEd and other editors save. Keys are
+// matched by their attr.name, so the key IDs may be anything; the
+// ones that make the CFG are
+//
+//    entry     on a node, makes it an entry; several entries are
+//              ordered by its value, and entry=true ones follow in
+//              the order they appear
+//    virtual   on a node, marks the virtual entry of a graph with
+//              several entries; its edges are implied by the entries
+//              and not read
+//    kind      on an edge, its kind: fallthrough (the default),
+//              taken, case, exceptional or call-return
+//    label     on an edge, its label
+//
+// and key defaults apply. Nested graphs, such as yEd's groups, are
+// flattened: their nodes are blocks and the group nodes are not.
+// Edges must be directed; hyperedges and ports are not supported.
+// Reading what WriteCFG writes gives a graph that is StructurallyEqual
+// to the original. Names and labels that XML cannot hold, empty names
+// and text with invalid UTF-8 or with control characters other than
+// tab, newline and carriage return, make WriteCFG fail before it
+// writes anything.
+//
+package graphml
+
+import "bufio"
+import "encoding/xml"
+import "fmt"
+import "io"
+import "sort"
+import "strconv"
+import "strings"
+import "unicode/utf8"
+import "./basicblock"
+
+// WriteCFG writes 'cfgraph' as a GraphML document.
+//
+func WriteCFG[K comparable](w io.Writer, cfgraph *cfg.CFG[K]) error {
+	blocks := cfgraph.Blocks()
+	for _, bb := range blocks {
+		name := cfg.FormatName(bb.Name())
+		switch {
+		case name == "":
+			return fmt.Errorf("empty block name cannot be a node id")
+		case !xmlSafe(name):
+			return fmt.Errorf("block name %q cannot be written in XML", name)
+		}
+		for iter := bb.OutEdges().Front(); iter != nil; iter = iter.Next() {
+			edge := iter.Value.(*cfg.BasicBlockEdge[K])
+			if !xmlSafe(edge.Label()) {
+				return fmt.Errorf("edge %s -> %s: label %q cannot be written in XML",
+					name, cfg.FormatName(edge.Dst().Name()), edge.Label())
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="entry" for="node" attr.name="entry" attr.type="int"/>
+  <key id="virtual" for="node" attr.name="virtual" attr.type="boolean"/>
+  <key id="kind" for="edge" attr.name="kind" attr.type="string">
+    <default>fallthrough</default>
+  </key>
+  <key id="label" for="edge" attr.name="label" attr.type="string"/>
+  <graph id="cfg" edgedefault="directed">
+`)
+
+	entry := make(map[*cfg.BasicBlock[K]]int)
+	for i, bb := range cfgraph.Entries() {
+		entry[bb] = i + 1
+	}
+	for _, bb := range blocks {
+		id := escape(cfg.FormatName(bb.Name()))
+		switch {
+		case bb == cfgraph.VirtualEntry():
+			fmt.Fprintf(bw, "    <node id=\"%s\">\n      <data key=\"virtual\">true</data>\n    </node>\n", id)
+		case entry[bb] > 0:
+			fmt.Fprintf(bw, "    <node id=\"%s\">\n      <data key=\"entry\">%d</data>\n    </node>\n", id, entry[bb])
+		default:
+			fmt.Fprintf(bw, "    <node id=\"%s\"/>\n", id)
+		}
+	}
+	for _, bb := range blocks {
+		if bb == cfgraph.VirtualEntry() {
+			continue
+		}
+		for iter := bb.OutEdges().Front(); iter != nil; iter = iter.Next() {
+			edge := iter.Value.(*cfg.BasicBlockEdge[K])
+			fmt.Fprintf(bw, "    <edge source=\"%s\" target=\"%s\"",
+				escape(cfg.FormatName(bb.Name())), escape(cfg.FormatName(edge.Dst().Name())))
+			if edge.Kind() == cfg.EdgeFallthrough && edge.Label() == "" {
+				bw.WriteString("/>\n")
+				continue
+			}
+			bw.WriteString(">\n")
+			if edge.Kind() != cfg.EdgeFallthrough {
+				fmt.Fprintf(bw, "      <data key=\"kind\">%v</data>\n", edge.Kind())
+			}
+			if edge.Label() != "" {
+				fmt.Fprintf(bw, "      <data key=\"label\">%s</data>\n", escape(edge.Label()))
+			}
+			bw.WriteString("    </edge>\n")
+		}
+	}
+
+	bw.WriteString("  </graph>\n</graphml>\n")
+	return bw.Flush()
+}
+
+// xmlSafe reports whether 's' reads back unchanged from XML: it is
+// valid UTF-8 and has only the characters XML 1.0 allows.
+//
+func xmlSafe(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+		case r < 0x20, r >= 0xD800 && r < 0xE000, r == 0xFFFE, r == 0xFFFF:
+			return false
+		}
+	}
+	return true
+}
+
+// escape makes text safe in an attribute value or element.
+//
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+//-----------------------------------------------------------
+
+type xmlDocument struct {
+	Keys   []xmlKey   `xml:"key"`
+	Graphs []xmlGraph `xml:"graph"`
+}
+
+type xmlKey struct {
+	ID      string  `xml:"id,attr"`
+	For     string  `xml:"for,attr"`
+	Name    string  `xml:"attr.name,attr"`
+	Default *string `xml:"default"`
+}
+
+type xmlGraph struct {
+	EdgeDefault string     `xml:"edgedefault,attr"`
+	Nodes       []xmlNode  `xml:"node"`
+	Edges       []xmlEdge  `xml:"edge"`
+	Hyperedges  []struct{} `xml:"hyperedge"`
+}
+
+type xmlNode struct {
+	ID    string    `xml:"id,attr"`
+	Data  []xmlData `xml:"data"`
+	Graph *xmlGraph `xml:"graph"`
+}
+
+type xmlEdge struct {
+	Source   string    `xml:"source,attr"`
+	Target   string    `xml:"target,attr"`
+	Directed string    `xml:"directed,attr"`
+	Data     []xmlData `xml:"data"`
+}
+
+type xmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// ReadCFG parses a GraphML document with cfg.DefaultLimits.
+//
+func ReadCFG[K comparable](r io.Reader) (*cfg.CFG[K], error) {
+	return ReadCFGLimits[K](r, cfg.DefaultLimits)
+}
+
+// ReadCFGLimits parses a GraphML document, failing if the input
+// exceeds 'limits'. The document must hold one graph.
+//
+func ReadCFGLimits[K comparable](r io.Reader, limits cfg.Limits) (*cfg.CFG[K], error) {
+	if limits.MaxBytes > 0 {
+		r = io.LimitReader(r, limits.MaxBytes+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxBytes > 0 && int64(len(data)) > limits.MaxBytes {
+		return nil, fmt.Errorf("input larger than %d bytes", limits.MaxBytes)
+	}
+
+	var doc xmlDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Graphs) != 1 {
+		return nil, fmt.Errorf("%d graphs in the document, want 1", len(doc.Graphs))
+	}
+
+	rd := &reader{
+		limits:   limits,
+		keys:     make(map[string]string),
+		defaults: map[string]map[string]string{"node": {}, "edge": {}},
+		groups:   make(map[string]bool),
+		known:    make(map[string]bool),
+	}
+	for _, k := range doc.Keys {
+		name := k.Name
+		if name == "" {
+			name = k.ID
+		}
+		rd.keys[k.ID] = name
+		if k.Default == nil {
+			continue
+		}
+		for _, f := range []string{"node", "edge"} {
+			if k.For == f || k.For == "all" {
+				rd.defaults[f][name] = *k.Default
+			}
+		}
+	}
+	if err := rd.graph(&doc.Graphs[0]); err != nil {
+		return nil, err
+	}
+	return build[K](rd)
+}
+
+// node and edge are the attributes of a flattened node or edge,
+// before the names are parsed.
+//
+type node struct {
+	id    string
+	attrs map[string]string
+}
+
+type edge struct {
+	source, target string
+	attrs          map[string]string
+}
+
+type reader struct {
+	limits   cfg.Limits
+	keys     map[string]string // key ID to attr.name
+	defaults map[string]map[string]string
+	nodes    []node
+	edges    []edge
+	groups   map[string]bool // nodes with a nested graph
+	known    map[string]bool
+}
+
+func (rd *reader) attrs(what string, data []xmlData) map[string]string {
+	attrs := make(map[string]string)
+	for k, v := range rd.defaults[what] {
+		attrs[k] = v
+	}
+	for _, d := range data {
+		if name, ok := rd.keys[d.Key]; ok {
+			attrs[name] = d.Value
+		}
+	}
+	return attrs
+}
+
+// graph flattens a graph and the graphs nested in its nodes.
+//
+func (rd *reader) graph(g *xmlGraph) error {
+	if len(g.Hyperedges) > 0 {
+		return fmt.Errorf("hyperedges are not supported")
+	}
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		if n.ID == "" {
+			return fmt.Errorf("node without an id")
+		}
+		if rd.known[n.ID] || rd.groups[n.ID] {
+			return fmt.Errorf("node %q listed twice", n.ID)
+		}
+		if n.Graph != nil {
+			rd.groups[n.ID] = true
+			if err := rd.graph(n.Graph); err != nil {
+				return err
+			}
+			continue
+		}
+		if rd.limits.MaxBlocks > 0 && len(rd.nodes) >= rd.limits.MaxBlocks {
+			return fmt.Errorf("more than %d blocks", rd.limits.MaxBlocks)
+		}
+		rd.known[n.ID] = true
+		rd.nodes = append(rd.nodes, node{n.ID, rd.attrs("node", n.Data)})
+	}
+	for _, e := range g.Edges {
+		directed := e.Directed == "true" || e.Directed == "" && g.EdgeDefault == "directed"
+		if !directed {
+			return fmt.Errorf("undirected edge %s - %s", e.Source, e.Target)
+		}
+		if rd.limits.MaxEdges > 0 && len(rd.edges) >= rd.limits.MaxEdges {
+			return fmt.Errorf("more than %d edges", rd.limits.MaxEdges)
+		}
+		rd.edges = append(rd.edges, edge{e.Source, e.Target, rd.attrs("edge", e.Data)})
+	}
+	return nil
+}
+
+// build makes the CFG from the flattened nodes and edges. Edges may
+// name nodes of any nesting level, declared before or after them.
+//
+func build[K comparable](rd *reader) (*cfg.CFG[K], error) {
+	names := make(map[string]K)
+	virtual := ""
+	type entry struct {
+		id    string
+		order int // the value of entry, or MaxInt for entry=true
+	}
+	var entries []entry
+	for _, n := range rd.nodes {
+		name, err := cfg.ParseName[K](n.id)
+		if err != nil {
+			return nil, err
+		}
+		names[n.id] = name
+		if v, ok := n.attrs["virtual"]; ok && truth(v) {
+			if virtual != "" {
+				return nil, fmt.Errorf("two virtual entries, %s and %s", virtual, n.id)
+			}
+			virtual = n.id
+			continue
+		}
+		v, ok := n.attrs["entry"]
+		if !ok {
+			continue
+		}
+		if order, err := strconv.Atoi(v); err == nil {
+			if order > 0 {
+				entries = append(entries, entry{n.id, order})
+			}
+		} else if truth(v) {
+			entries = append(entries, entry{n.id, int(^uint(0) >> 1)})
+		} else if v != "false" {
+			return nil, fmt.Errorf("bad entry value %q on node %s", v, n.id)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].order < entries[j].order })
+
+	g := cfg.NewCFGOf[K]()
+	for _, n := range rd.nodes {
+		if n.id != virtual {
+			g.CreateNode(names[n.id])
+		}
+	}
+	for _, e := range rd.edges {
+		for _, end := range []string{e.source, e.target} {
+			switch {
+			case rd.groups[end]:
+				return nil, fmt.Errorf("edge %s -> %s: %s is a group", e.source, e.target, end)
+			case !rd.known[end]:
+				return nil, fmt.Errorf("edge %s -> %s: no node %s", e.source, e.target, end)
+			}
+		}
+		if e.source == virtual {
+			continue
+		}
+		if e.target == virtual {
+			return nil, fmt.Errorf("edge into the virtual entry %s", virtual)
+		}
+		kind := cfg.EdgeFallthrough
+		if k, ok := e.attrs["kind"]; ok && k != "" {
+			if kind, ok = cfg.ParseEdgeKind(k); !ok {
+				return nil, fmt.Errorf("edge %s -> %s: unknown kind %q", e.source, e.target, k)
+			}
+		}
+		cfg.NewBasicBlockEdgeOfKind(g, names[e.source], names[e.target], kind).SetLabel(e.attrs["label"])
+	}
+
+	nodes := make([]K, 0, len(entries))
+	distinct := make(map[K]bool)
+	for _, e := range entries {
+		if !distinct[names[e.id]] {
+			distinct[names[e.id]] = true
+			nodes = append(nodes, names[e.id])
+		}
+	}
+	switch {
+	case virtual != "" && len(nodes) < 2:
+		return nil, fmt.Errorf("virtual entry given for fewer than two entries")
+	case virtual != "" && g.BasicBlocks()[names[virtual]] != nil:
+		return nil, fmt.Errorf("virtual entry %s has the name of a block", virtual)
+	case virtual != "":
+		g.SetEntriesNamed(names[virtual], nodes...)
+	case len(entries) > 0:
+		g.SetEntries(nodes...)
+	}
+	if err := g.ValidateStructure(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func truth(v string) bool {
+	return v == "true" || v == "1"
+}
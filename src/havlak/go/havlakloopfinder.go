@@ -43,16 +43,16 @@ const (
 // complete loops into a single node. These nodes and the
 // corresponding functionality are implemented with this class
 //
-type UnionFindNode struct {
-	parent    *UnionFindNode
-	bb        *cfg.BasicBlock
-	loop      *lsg.SimpleLoop
+type UnionFindNode[K comparable] struct {
+	parent    *UnionFindNode[K]
+	bb        *cfg.BasicBlock[K]
+	loop      *lsg.SimpleLoop[K]
 	dfsNumber int
 }
 
 // Init explicitly initializes UnionFind nodes.
 //
-func (u *UnionFindNode) Init(bb *cfg.BasicBlock, dfsNumber int) {
+func (u *UnionFindNode[K]) Init(bb *cfg.BasicBlock[K], dfsNumber int) {
 	u.parent = u
 	u.bb = bb
 	u.dfsNumber = dfsNumber
@@ -65,7 +65,7 @@ func (u *UnionFindNode) Init(bb *cfg.BasicBlock, dfsNumber int) {
 // visited and collapsed once, however, deep nests would still
 // result in significant traversals).
 //
-func (u *UnionFindNode) FindSet() *UnionFindNode {
+func (u *UnionFindNode[K]) FindSet() *UnionFindNode[K] {
 	nodeList := list.New()
 	node := u
 
@@ -78,7 +78,7 @@ func (u *UnionFindNode) FindSet() *UnionFindNode {
 
 	// Path Compression, all nodes' parents point to the 1st level parent.
 	for ll := nodeList.Front(); ll != nil; ll = ll.Next() {
-		ll.Value.(*UnionFindNode).SetParent(node.Parent())
+		ll.Value.(*UnionFindNode[K]).SetParent(node.Parent())
 	}
 
 	return node
@@ -86,29 +86,29 @@ func (u *UnionFindNode) FindSet() *UnionFindNode {
 
 // Union relies on path compression.
 //
-func (u *UnionFindNode) Union(B *UnionFindNode) {
+func (u *UnionFindNode[K]) Union(B *UnionFindNode[K]) {
 	u.SetParent(B)
 }
 
 // Getters/Setters
 //
-func (u *UnionFindNode) Parent() *UnionFindNode {
+func (u *UnionFindNode[K]) Parent() *UnionFindNode[K] {
 	return u.parent
 }
-func (u *UnionFindNode) Bb() *cfg.BasicBlock {
+func (u *UnionFindNode[K]) Bb() *cfg.BasicBlock[K] {
 	return u.bb
 }
-func (u *UnionFindNode) Loop() *lsg.SimpleLoop {
+func (u *UnionFindNode[K]) Loop() *lsg.SimpleLoop[K] {
 	return u.loop
 }
-func (u *UnionFindNode) DfsNumber() int {
+func (u *UnionFindNode[K]) DfsNumber() int {
 	return u.dfsNumber
 }
 
-func (u *UnionFindNode) SetParent(parent *UnionFindNode) {
+func (u *UnionFindNode[K]) SetParent(parent *UnionFindNode[K]) {
 	u.parent = parent
 }
-func (u *UnionFindNode) SetLoop(loop *lsg.SimpleLoop) {
+func (u *UnionFindNode[K]) SetLoop(loop *lsg.SimpleLoop[K]) {
 	u.loop = loop
 }
 
@@ -144,25 +144,46 @@ func isAncestor(w, v int, last []int) bool {
 // Go comment: moving the assignment of el into the if
 //    provided for improved scoping!
 //
-func listContainsNode(l *list.List, u *UnionFindNode) bool {
+func listContainsNode[K comparable](l *list.List, u *UnionFindNode[K]) bool {
 	for ll := l.Front(); ll != nil; ll = ll.Next() {
-		if el := ll.Value.(*UnionFindNode); el == u {
+		if el := ll.Value.(*UnionFindNode[K]); el == u {
 			return true
 		}
 	}
 	return false
 }
 
+// EdgeFilter decides which CFG edges the loop finder looks at.
+// Edges for which it returns false are treated as absent.
+//
+type EdgeFilter[K comparable] func(edge *cfg.BasicBlockEdge[K]) bool
+
+// SkipExceptional ignores edges into exception handlers, so that
+// a handler reached from inside a loop body does not look like part
+// of the loop.
+//
+func SkipExceptional[K comparable](edge *cfg.BasicBlockEdge[K]) bool {
+	return edge.Kind() != cfg.EdgeExceptional
+}
+
 // DFS - Depth-First-Search and node numbering.
 //
-func DFS(currentNode *cfg.BasicBlock, nodes []*UnionFindNode, number map[*cfg.BasicBlock]int, last []int, current int) int {
+func DFS[K comparable](currentNode *cfg.BasicBlock[K], nodes []*UnionFindNode[K], number map[*cfg.BasicBlock[K]]int, last []int, current int) int {
+	return dfs(currentNode, nodes, number, last, current, nil)
+}
+
+func dfs[K comparable](currentNode *cfg.BasicBlock[K], nodes []*UnionFindNode[K], number map[*cfg.BasicBlock[K]]int, last []int, current int, follow EdgeFilter[K]) int {
 	nodes[current].Init(currentNode, current)
 	number[currentNode] = current
 
 	lastid := current
 	for ll := currentNode.OutEdges().Front(); ll != nil; ll = ll.Next() {
-		if target := ll.Value.(*cfg.BasicBlock); number[target] == unvisited {
-			lastid = DFS(target, nodes, number, last, lastid+1)
+		edge := ll.Value.(*cfg.BasicBlockEdge[K])
+		if follow != nil && !follow(edge) {
+			continue
+		}
+		if target := edge.Dst(); number[target] == unvisited {
+			lastid = dfs(target, nodes, number, last, lastid+1, follow)
 		}
 	}
 	last[number[currentNode]] = lastid
@@ -176,7 +197,18 @@ func DFS(currentNode *cfg.BasicBlock, nodes []*UnionFindNode, number map[*cfg.Ba
 // been chosen to be identical to the nomenclature in Havlak's
 // paper (which, in turn, is similar to the one used by Tarjan).
 //
-func FindLoops(cfgraph *cfg.CFG, lsgraph *lsg.LSG) {
+// Functions with several entry points are handled through the
+// virtual entry installed by CFG.SetEntries: the search starts there,
+// so blocks reachable only from a secondary entry are not dead.
+//
+func FindLoops[K comparable](cfgraph *cfg.CFG[K], lsgraph *lsg.LSG[K]) {
+	FindLoopsFiltered(cfgraph, lsgraph, nil)
+}
+
+// FindLoopsFiltered is FindLoops restricted to the edges accepted by
+// 'follow'; a nil filter accepts every edge.
+//
+func FindLoopsFiltered[K comparable](cfgraph *cfg.CFG[K], lsgraph *lsg.LSG[K], follow EdgeFilter[K]) {
 	if cfgraph.StartBasicBlock() == nil {
 		return
 	}
@@ -186,14 +218,14 @@ func FindLoops(cfgraph *cfg.CFG, lsgraph *lsg.LSG) {
 	nonBackPreds := make([]map[int]bool, size)
 	backPreds := make([]list.List, size)
 
-	number := make(map[*cfg.BasicBlock]int)
+	number := make(map[*cfg.BasicBlock[K]]int)
 	header := make([]int, size, size)
 	types := make([]int, size, size)
 	last := make([]int, size, size)
-	nodes := make([]*UnionFindNode, size, size)
+	nodes := make([]*UnionFindNode[K], size, size)
 
 	for i := 0; i < size; i++ {
-		nodes[i] = new(UnionFindNode)
+		nodes[i] = new(UnionFindNode[K])
 	}
 
 	// Step a:
@@ -201,12 +233,18 @@ func FindLoops(cfgraph *cfg.CFG, lsgraph *lsg.LSG) {
 	//   - depth-first traversal and numbering.
 	//   - unreached BB's are marked as dead.
 	//
-	for i, bb := range cfgraph.BasicBlocks() {
+	// Block names need not be 0..size-1 (a virtual entry, for
+	// example, has a negative name), so per-node state is indexed
+	// by position, never by name.
+	//
+	for _, bb := range cfgraph.BasicBlocks() {
 		number[bb] = unvisited
+	}
+	for i := 0; i < size; i++ {
 		nonBackPreds[i] = make(map[int]bool)
 	}
 
-	DFS(cfgraph.StartBasicBlock(), nodes, number, last, 0)
+	dfs(cfgraph.StartBasicBlock(), nodes, number, last, 0, follow)
 
 	// Step b:
 	//   - iterate over all nodes.
@@ -230,8 +268,11 @@ func FindLoops(cfgraph *cfg.CFG, lsgraph *lsg.LSG) {
 
 		if nodeW.NumPred() > 0 {
 			for ll := nodeW.InEdges().Front(); ll != nil; ll = ll.Next() {
-				nodeV := ll.Value.(*cfg.BasicBlock)
-				v := number[nodeV]
+				edge := ll.Value.(*cfg.BasicBlockEdge[K])
+				if follow != nil && !follow(edge) {
+					continue
+				}
+				v := number[edge.Src()]
 				if v == unvisited {
 					continue // dead node
 				}
@@ -284,7 +325,7 @@ func FindLoops(cfgraph *cfg.CFG, lsgraph *lsg.LSG) {
 		workList := list.New()
 		for ll := nodePool.Front(); ll != nil; ll = ll.Next() {
 			// workaround for gccgo problem, suggested by Ian
-			v := ll.Value.(*UnionFindNode)
+			v := ll.Value.(*UnionFindNode[K])
 			workList.PushBack(v)
 		}
 
@@ -295,7 +336,7 @@ func FindLoops(cfgraph *cfg.CFG, lsgraph *lsg.LSG) {
 		// work the list...
 		//
 		for workList.Len() > 0 {
-			x := workList.Front().Value.(*UnionFindNode)
+			x := workList.Front().Value.(*UnionFindNode[K])
 			workList.Remove(workList.Front())
 
 			// Step e:
@@ -357,7 +398,7 @@ func FindLoops(cfgraph *cfg.CFG, lsgraph *lsg.LSG) {
 			nodes[w].SetLoop(loop)
 
 			for ll := nodePool.Front(); ll != nil; ll = ll.Next() {
-				node := ll.Value.(*UnionFindNode)
+				node := ll.Value.(*UnionFindNode[K])
 				// Add nodes to loop descriptor.
 				header[node.DfsNumber()] = w
 				node.Union(nodes[w])
@@ -378,7 +419,7 @@ func FindLoops(cfgraph *cfg.CFG, lsgraph *lsg.LSG) {
 }
 
 // External entry point.
-func FindHavlakLoops(cfgraph *cfg.CFG, lsgraph *lsg.LSG) int {
+func FindHavlakLoops[K comparable](cfgraph *cfg.CFG[K], lsgraph *lsg.LSG[K]) int {
 	FindLoops(cfgraph, lsgraph)
 	return lsgraph.NumLoops()
 }
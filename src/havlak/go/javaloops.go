@@ -0,0 +1,93 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Loop nests of Java methods.
+//
+// Usage: javaloops [-cfg] [-skip-exceptional] file.class ...
+//
+// Builds the CFG of every method with code in the given class files,
+// runs the Havlak loop finder on it and prints the loop tree with
+// blocks named by bytecode offset. Pointed at the classes of the
+// Java port (java/), it analyzes the benchmark's own bytecode.
+// With -cfg, the CFG is printed first, in the edge-list format.
+// With -skip-exceptional, the loop finder ignores the edges into
+// exception handlers, so a retry loop that goes around through a
+// catch block is not reported; the CFG printed is unchanged.
+//
+// The fixtures in testdata/jvm are checked with 'make check-jvm'.
+//
+package main
+
+import "flag"
+import "fmt"
+import "os"
+import "./lsg"
+import "./havlakloopfinder"
+import "./classfile"
+
+var printCFG = flag.Bool("cfg", false, "print the CFG of every method")
+var skipExceptional = flag.Bool("skip-exceptional", false, "ignore edges into exception handlers")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: javaloops [-cfg] [-skip-exceptional] file.class ...\n")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "javaloops: %v\n", err)
+			status = 1
+			continue
+		}
+		methods, err := classfile.Read(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "javaloops: %s: %v\n", path, err)
+			status = 1
+			continue
+		}
+
+		for _, m := range methods {
+			lsgraph := lsg.NewLSGOf[int]()
+			if *skipExceptional {
+				havlakloopfinder.FindLoopsFiltered(m.CFG, lsgraph, havlakloopfinder.SkipExceptional[int])
+			} else {
+				havlakloopfinder.FindHavlakLoops(m.CFG, lsgraph)
+			}
+			lsgraph.CalculateNestingLevel()
+
+			numEdges := 0
+			for _, bb := range m.CFG.Blocks() {
+				numEdges += bb.NumSucc()
+			}
+			fmt.Printf("%s.%s%s: %d blocks, %d edges, %d loops\n",
+				m.Class, m.Name, m.Descriptor, m.CFG.NumNodes(), numEdges, lsgraph.NumLoops())
+			if *printCFG {
+				if err := m.CFG.WriteEdgeList(os.Stdout); err != nil {
+					fmt.Fprintf(os.Stderr, "javaloops: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if err := lsgraph.WriteNest(os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "javaloops: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+	os.Exit(status)
+}
@@ -0,0 +1,85 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Loop nests of LLVM functions.
+//
+// Usage: llloops [-cfg] file.ll ...
+//
+// Builds the CFG of every function defined in the given .ll files,
+// runs the Havlak loop finder on it and prints the loop tree with
+// LLVM block names, in the same shape for every function so that
+// the output can be compared with what LLVM's LoopInfo reports.
+// With -cfg, the CFG is printed first, in the edge-list format.
+//
+// The fixtures in testdata/llvm are checked with 'make check-llvm'.
+//
+package main
+
+import "flag"
+import "fmt"
+import "os"
+import "./lsg"
+import "./havlakloopfinder"
+import "./llvmir"
+
+var printCFG = flag.Bool("cfg", false, "print the CFG of every function")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: llloops [-cfg] file.ll ...\n")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "llloops: %v\n", err)
+			status = 1
+			continue
+		}
+		fns, err := llvmir.Read(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "llloops: %s: %v\n", path, err)
+			status = 1
+			continue
+		}
+
+		for _, fn := range fns {
+			lsgraph := lsg.NewLSGOf[string]()
+			havlakloopfinder.FindHavlakLoops(fn.CFG, lsgraph)
+			lsgraph.CalculateNestingLevel()
+
+			numEdges := 0
+			for _, bb := range fn.CFG.Blocks() {
+				numEdges += bb.NumSucc()
+			}
+			fmt.Printf("@%s: %d blocks, %d edges, %d loops\n",
+				fn.Name, fn.CFG.NumNodes(), numEdges, lsgraph.NumLoops())
+			if *printCFG {
+				if err := fn.CFG.WriteEdgeList(os.Stdout); err != nil {
+					fmt.Fprintf(os.Stderr, "llloops: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if err := lsgraph.WriteNest(os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "llloops: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+	os.Exit(status)
+}
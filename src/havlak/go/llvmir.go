@@ -0,0 +1,482 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Control flow graphs from textual LLVM IR.
+//
+// Read finds every 'define' in a .ll file and splits its body into
+// basic blocks at labels and terminators. Blocks are named as LLVM
+// names them, without the '%' sigil: "entry", "for.body", or the
+// number of an unnamed block. The successors of a block are the
+// 'label' operands of its terminator, with these edge kinds:
+//
+//    br i1 %c, label %t, label %f      t taken, f fallthrough
+//    br label %d                       fallthrough
+//    switch ..., label %d [ v, label %x ... ]
+//                                      case, labeled "default" or v
+//    indirectbr ..., [ label %x ... ]  taken
+//    invoke ... to label %n unwind label %u
+//                                      n call-return, u exceptional
+//    callbr ... to label %n [ label %x ... ]
+//                                      n call-return, x taken
+//    catchswitch, catchret, cleanupret handler and unwind edges are
+//                                      exceptional, catchret's target
+//                                      is fallthrough
+//
+// ret, resume and unreachable end a block without successors.
+// Declarations, globals and metadata are skipped.
+//
+package llvmir
+
+import "fmt"
+import "io"
+import "strconv"
+import "strings"
+import "./basicblock"
+
+// Function is the CFG of one LLVM function.
+//
+type Function struct {
+	Name string // without the '@'
+	Line int    // of the 'define'
+	CFG  *cfg.CFG[string]
+}
+
+// Read parses a .ll file with cfg.DefaultLimits, applying MaxBlocks
+// and MaxEdges to each function.
+//
+func Read(r io.Reader) ([]*Function, error) {
+	return ReadLimits(r, cfg.DefaultLimits)
+}
+
+// ReadLimits parses a .ll file, failing as soon as the input
+// exceeds 'limits'.
+//
+func ReadLimits(r io.Reader, limits cfg.Limits) ([]*Function, error) {
+	p := &parser{limits: limits}
+	scanner := cfg.NewLineScanner(r, limits)
+	for scanner.Scan() {
+		p.lineno++
+		if err := p.line(scanner.Text()); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, &cfg.SyntaxError{Line: p.lineno + 1, Msg: err.Error()}
+	}
+	if p.fn != nil {
+		return nil, p.errorf("function @%s is not closed", p.fn.Name)
+	}
+	return p.fns, nil
+}
+
+//-----------------------------------------------------------
+
+// block is a basic block whose successors are not resolved yet;
+// a branch may name a block defined further down.
+//
+type block struct {
+	name  string
+	line  int // of the terminator
+	succs []successor
+}
+
+type successor struct {
+	name  string
+	kind  cfg.EdgeKind
+	label string
+}
+
+type parser struct {
+	limits cfg.Limits
+	lineno int
+	fns    []*Function
+
+	fn       *Function // being parsed, nil between functions
+	header   []string  // tokens of a 'define' not yet opened by '{'
+	pending  []string  // tokens of an instruction continued on the next line
+	blocks   []*block
+	current  *block // nil after a terminator
+	defined  map[string]bool
+	unnamed  int // next number for an unnamed value or block
+	numEdges int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &cfg.SyntaxError{Line: p.lineno, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) line(text string) error {
+	toks, err := tokenize(text)
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+	if len(toks) == 0 {
+		return nil
+	}
+
+	switch {
+	case p.fn == nil:
+		if toks[0] != "define" {
+			return nil
+		}
+		p.fn = &Function{Line: p.lineno}
+		p.header = nil
+		p.defined = make(map[string]bool)
+		p.blocks, p.current, p.numEdges = nil, nil, 0
+		return p.define(toks)
+
+	case p.header != nil:
+		return p.define(toks)
+
+	case p.pending != nil:
+		return p.instruction(toks)
+
+	case len(toks) == 1 && toks[0] == "}":
+		return p.finish()
+
+	case len(toks) == 2 && toks[1] == ":":
+		return p.label(toks[0])
+	}
+	return p.instruction(toks)
+}
+
+// define collects the function header up to the opening brace.
+//
+func (p *parser) define(toks []string) error {
+	p.header = append(p.header, toks...)
+	if p.header[len(p.header)-1] != "{" {
+		return nil
+	}
+	header := p.header
+	p.header = nil
+
+	at := -1
+	for i, t := range header {
+		if strings.HasPrefix(t, "@") {
+			at = i
+			break
+		}
+	}
+	if at < 0 || at+1 >= len(header) || header[at+1] != "(" {
+		return p.errorf("malformed define")
+	}
+	p.fn.Name = unquote(header[at][1:])
+
+	// Unnamed arguments take the first numbers; an unlabeled entry
+	// block takes the next one.
+	p.unnamed = 0
+	depth := 0
+	for i := at + 1; i < len(header); i++ {
+		switch header[i] {
+		case "(", "[", "{", "<":
+			depth++
+			continue
+		case ")", "]", "}", ">":
+			depth--
+		case ",":
+		default:
+			continue
+		}
+		if depth <= 1 && i > 0 {
+			if n, ok := number(header[i-1]); ok {
+				p.unnamed = n + 1
+			}
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+func (p *parser) label(tok string) error {
+	name := tok
+	if strings.HasPrefix(name, "\"") {
+		name = unquote(name)
+	}
+	if p.current != nil && len(p.blocks) > 0 {
+		return p.errorf("block %%%s has no terminator", p.current.name)
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		p.unnamed = n + 1
+	}
+	return p.newBlock(name)
+}
+
+func (p *parser) newBlock(name string) error {
+	if p.defined[name] {
+		return p.errorf("block %%%s defined twice", name)
+	}
+	if p.limits.MaxBlocks > 0 && len(p.blocks) >= p.limits.MaxBlocks {
+		return p.errorf("more than %d blocks in @%s", p.limits.MaxBlocks, p.fn.Name)
+	}
+	p.defined[name] = true
+	p.current = &block{name: name}
+	p.blocks = append(p.blocks, p.current)
+	return nil
+}
+
+var terminators = map[string]bool{
+	"ret": true, "br": true, "switch": true, "indirectbr": true,
+	"invoke": true, "callbr": true, "resume": true, "unreachable": true,
+	"catchswitch": true, "catchret": true, "cleanupret": true,
+}
+
+func (p *parser) instruction(toks []string) error {
+	toks = append(p.pending, toks...)
+	p.pending = nil
+	if depth(toks) > 0 {
+		p.pending = toks
+		return nil
+	}
+
+	if p.current == nil {
+		if err := p.newBlock(strconv.Itoa(p.unnamed)); err != nil {
+			return err
+		}
+		p.unnamed++
+	}
+
+	op := 0
+	if len(toks) >= 3 && toks[1] == "=" {
+		if n, ok := number(toks[0]); ok {
+			p.unnamed = n + 1
+		}
+		op = 2
+	}
+	if !terminators[toks[op]] {
+		return nil
+	}
+	if (toks[op] == "invoke" || toks[op] == "callbr") && !contains(toks, "label") {
+		// The destinations are on the next line.
+		p.pending = toks
+		return nil
+	}
+
+	p.current.line = p.lineno
+	p.current.succs = successors(toks[op], toks[op+1:])
+	p.numEdges += len(p.current.succs)
+	if p.limits.MaxEdges > 0 && p.numEdges > p.limits.MaxEdges {
+		return p.errorf("more than %d edges in @%s", p.limits.MaxEdges, p.fn.Name)
+	}
+	p.current = nil
+	return nil
+}
+
+// successors picks the 'label %x' operands out of a terminator.
+//
+func successors(op string, toks []string) []successor {
+	var succs []successor
+	labels := 0
+	for _, t := range toks {
+		if t == "label" {
+			labels++
+		}
+	}
+	inBrackets := false
+	entry := 0 // first token of the current switch case
+	for i := 0; i < len(toks); i++ {
+		switch toks[i] {
+		case "[":
+			inBrackets = true
+			entry = i + 1
+			continue
+		case "]":
+			inBrackets = false
+			continue
+		}
+		if toks[i] != "label" || i+1 >= len(toks) || !strings.HasPrefix(toks[i+1], "%") {
+			continue
+		}
+
+		s := successor{name: localName(toks[i+1]), kind: cfg.EdgeFallthrough}
+		prev := ""
+		if i > 0 {
+			prev = toks[i-1]
+		}
+		switch {
+		case prev == "unwind":
+			s.kind, s.label = cfg.EdgeExceptional, "unwind"
+		case op == "br":
+			if len(succs) == 0 && labels == 2 {
+				s.kind = cfg.EdgeTaken
+			}
+		case op == "switch" && !inBrackets:
+			s.kind, s.label = cfg.EdgeSwitchCase, "default"
+		case op == "switch":
+			// type value , label %dest
+			s.kind = cfg.EdgeSwitchCase
+			if i-1 > entry+1 {
+				s.label = strings.Join(toks[entry+1:i-1], " ")
+			}
+		case op == "indirectbr":
+			s.kind = cfg.EdgeTaken
+		case (op == "invoke" || op == "callbr") && prev == "to":
+			s.kind = cfg.EdgeCallReturn
+		case op == "callbr":
+			s.kind = cfg.EdgeTaken
+		case op == "catchswitch":
+			s.kind, s.label = cfg.EdgeExceptional, "handler"
+		}
+		succs = append(succs, s)
+		i++
+		entry = i + 1
+	}
+	return succs
+}
+
+// finish resolves the branch targets of the function and builds
+// its CFG.
+//
+func (p *parser) finish() error {
+	if len(p.blocks) == 0 {
+		return p.errorf("function @%s has no blocks", p.fn.Name)
+	}
+	if p.current != nil {
+		return p.errorf("block %%%s has no terminator", p.current.name)
+	}
+
+	g := cfg.NewCFGOf[string]()
+	for _, b := range p.blocks {
+		g.CreateNode(b.name)
+	}
+	for _, b := range p.blocks {
+		for _, s := range b.succs {
+			if !p.defined[s.name] {
+				p.lineno = b.line
+				return p.errorf("branch to undefined block %%%s", s.name)
+			}
+			cfg.NewBasicBlockEdgeOfKind(g, b.name, s.name, s.kind).SetLabel(s.label)
+		}
+	}
+	g.SetStart(p.blocks[0].name)
+
+	p.fn.CFG = g
+	p.fns = append(p.fns, p.fn)
+	p.fn = nil
+	return nil
+}
+
+//-----------------------------------------------------------
+
+// tokenize splits a line into LLVM tokens: names with their sigil
+// (%x, @"a b", !dbg), keywords and numbers, quoted strings, and
+// single punctuation characters. A ';' outside a string starts a
+// comment.
+//
+func tokenize(line string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == ';':
+			return toks, nil
+		case c == '"' || ((c == '%' || c == '@' || c == '!' || c == '$') &&
+			i+1 < len(line) && line[i+1] == '"'):
+			start := i
+			if c != '"' {
+				i++
+			}
+			end := strings.IndexByte(line[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			i += end + 2
+			toks = append(toks, line[start:i])
+		case isNameChar(c) || c == '%' || c == '@' || c == '!' || c == '#':
+			start := i
+			for i++; i < len(line) && isNameChar(line[i]); i++ {
+			}
+			toks = append(toks, line[start:i])
+		default:
+			toks = append(toks, line[i:i+1])
+			i++
+		}
+	}
+	return toks, nil
+}
+
+func isNameChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' || c == '-' || c == '$' || c == '.' || c == '_'
+}
+
+// depth is the number of unclosed brackets in an instruction.
+//
+func depth(toks []string) int {
+	d := 0
+	for _, t := range toks {
+		switch t {
+		case "[", "(", "{":
+			d++
+		case "]", ")", "}":
+			d--
+		}
+	}
+	return d
+}
+
+func contains(toks []string, tok string) bool {
+	for _, t := range toks {
+		if t == tok {
+			return true
+		}
+	}
+	return false
+}
+
+// localName strips the '%' of a local name and decodes quotes.
+//
+func localName(tok string) string {
+	return unquote(tok[1:])
+}
+
+// number returns N for the unnamed local %N.
+//
+func number(tok string) (int, bool) {
+	if !strings.HasPrefix(tok, "%") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(tok[1:])
+	return n, err == nil && n >= 0
+}
+
+// unquote decodes an LLVM quoted name, where '\\' and '\hh' are the
+// only escapes. Unquoted names are returned unchanged.
+//
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && s[i+1] == '\\' {
+			b.WriteByte('\\')
+			i++
+		} else if s[i] == '\\' && i+2 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+			b.WriteByte(s[i])
+		} else {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
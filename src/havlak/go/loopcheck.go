@@ -0,0 +1,254 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Differential check of the Havlak loop finder against natural loops.
+//
+// Usage: loopcheck [-names int|uint|string] [-profile file.prof] [-loops file.json] [-random n [-size n] [-seed n]] [file.edges ...]
+//
+// Reads each CFG in the edge-list format of package cfg (or standard
+// input, for "-") and, if it is reducible, compares the loops the
+// Havlak loop finder reports with the natural loops of its dominator
+// tree, which must be the same. It prints "ok" or "irreducible, not
+// checked" for each file, and the differences, if any, on standard
+// error. The forest of every finder of package loopforest is also
+// checked for consistency with loopverify.Verify, reducible or not.
+//
+// With -profile, it loads the execution profile of package cfg into
+// each graph, prints the weight of the back edges and of the exit
+// edges of every loop, by header, innermost first, and checks that
+// the weights conserve flow at every block:
+//
+//    loop.edges: loop 1: back edges 90, exits 10
+//
+// With -loops, it reads a loop forest in the JSON encoding of
+// package lsg instead of running the finders, checks it against each
+// graph with loopverify.Verify, and prints "forest ok" or the
+// violations, one per line, on standard error.
+//
+// With -random, it also checks 'n' random graphs of -size blocks.
+// Irreducible ones are made reducible by node splitting first; the
+// few that need too many copies are left out. A graph on which the
+// finders disagree is printed on standard error in the edge-list
+// format.
+//
+// The exit status is 1 if any check failed. 'make check-natural'
+// runs it on all the fixtures and a batch of random graphs.
+//
+package main
+
+import "flag"
+import "fmt"
+import "io"
+import "math/rand"
+import "os"
+import "strings"
+import "./basicblock"
+import "./lsg"
+import "./loopverify"
+import "./loopforest"
+import "./reducible"
+
+var names = flag.String("names", "int", "type of the block names: int, uint or string")
+var random = flag.Int("random", 0, "number of random graphs to check")
+var size = flag.Int("size", 12, "number of blocks of the random graphs")
+var seed = flag.Int64("seed", 1, "seed of the random graphs")
+var profile = flag.String("profile", "", "load the execution profile in `file`")
+var loops = flag.String("loops", "", "check the loop forest in `file` instead of finding the loops")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 && *random == 0 || *size < 1 {
+		fmt.Fprintf(os.Stderr, "usage: loopcheck [-names int|uint|string] [-profile file.prof] [-loops file.json] [-random n [-size n] [-seed n]] [file.edges ...]\n")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		f := os.Stdin
+		if path != "-" {
+			var err error
+			if f, err = os.Open(path); err != nil {
+				fmt.Fprintf(os.Stderr, "loopcheck: %v\n", err)
+				status = 1
+				continue
+			}
+		}
+		var err error
+		switch *names {
+		case "int":
+			err = report[int](path, f)
+		case "uint":
+			err = report[uint64](path, f)
+		case "string":
+			err = report[string](path, f)
+		default:
+			err = fmt.Errorf("unknown name type %q", *names)
+		}
+		if f != os.Stdin {
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "loopcheck: %s: %v\n", path, err)
+			status = 1
+		}
+	}
+	if *random > 0 && !checkRandom(rand.New(rand.NewSource(*seed))) {
+		status = 1
+	}
+	os.Exit(status)
+}
+
+func report[K comparable](path string, r io.Reader) error {
+	g, err := cfg.ReadEdgeList[K](r)
+	if err != nil {
+		return err
+	}
+	if *profile != "" {
+		if err := loadProfile(g, *profile); err != nil {
+			return err
+		}
+	}
+	if *loops != "" {
+		return checkForest(path, g, *loops)
+	}
+	lsgraph, err := verify[K](g)
+	if err != nil {
+		return err
+	}
+	if reducible.Check(g) != nil {
+		fmt.Printf("%s: irreducible, not checked\n", path)
+	} else if err := loopforest.Compare[K](g, loopforest.Havlak[K]{}, loopforest.Natural[K]{}); err != nil {
+		return err
+	} else {
+		fmt.Printf("%s: ok\n", path)
+	}
+	if *profile == "" {
+		return nil
+	}
+
+	for _, loop := range lsgraph.Loops() {
+		fmt.Printf("%s: loop %s: back edges %d, exits %d\n", path,
+			cfg.BlockName(loop.Header()), loop.BackEdgeWeight(), loop.ExitEdgeWeight())
+	}
+	if n := each(path, g.CheckFlowConservation()); n > 0 {
+		return fmt.Errorf("flow not conserved at %d places", n)
+	}
+	return nil
+}
+
+// checkForest checks the loop forest stored in 'forest' against 'g'.
+//
+func checkForest[K comparable](path string, g *cfg.CFG[K], forest string) error {
+	data, err := os.ReadFile(forest)
+	if err != nil {
+		return err
+	}
+	lsgraph, err := lsg.UnmarshalLSG(data, g)
+	if err != nil {
+		return err
+	}
+	if n := each(path, loopverify.Verify(lsgraph, g)); n > 0 {
+		return fmt.Errorf("%d violations in %s", n, forest)
+	}
+	fmt.Printf("%s: forest ok\n", path)
+	return nil
+}
+
+// each prints the lines of 'err', a list of violations, on standard
+// error, and returns their number.
+//
+func each(path string, err error) int {
+	if err == nil {
+		return 0
+	}
+	violations := strings.Split(err.Error(), "\n")
+	for _, v := range violations {
+		fmt.Fprintf(os.Stderr, "loopcheck: %s: %s\n", path, v)
+	}
+	return len(violations)
+}
+
+// verify runs every finder of package loopforest on 'g' and checks
+// the forests it builds with loopverify.Verify. It returns the
+// Havlak forest.
+//
+func verify[K comparable](g *cfg.CFG[K]) (*lsg.LSG[K], error) {
+	var havlak *lsg.LSG[K]
+	for _, f := range loopforest.Finders[K]() {
+		lsgraph := lsg.NewLSGOf[K]()
+		f.FindLoops(g, lsgraph)
+		lsgraph.CalculateNestingLevel()
+		if err := loopverify.Verify(lsgraph, g); err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name(), err)
+		}
+		if havlak == nil {
+			havlak = lsgraph
+		}
+	}
+	return havlak, nil
+}
+
+func loadProfile[K comparable](g *cfg.CFG[K], path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return cfg.LoadProfile(g, f)
+}
+
+// checkRandom checks graphs with edges between random blocks, some
+// of them taken branches, and sometimes a second entry.
+//
+func checkRandom(rng *rand.Rand) bool {
+	checked, split := 0, 0
+	for i := 0; i < *random; i++ {
+		g := cfg.NewCFGOf[int]()
+		for n := 0; n < *size; n++ {
+			g.CreateNode(n)
+		}
+		for e := rng.Intn(3 * *size); e > 0; e-- {
+			kind := cfg.EdgeFallthrough
+			if rng.Intn(3) == 0 {
+				kind = cfg.EdgeTaken
+			}
+			cfg.NewBasicBlockEdgeOfKind(g, rng.Intn(*size), rng.Intn(*size), kind)
+		}
+		if *size > 1 && rng.Intn(4) == 0 {
+			g.SetEntries(0, 1+rng.Intn(*size-1))
+		}
+
+		if reducible.Check(g) != nil {
+			reduced, _, err := reducible.Split(g, 10**size)
+			if err != nil {
+				continue
+			}
+			g = reduced
+			split++
+		}
+		if _, err := verify[int](g); err != nil {
+			fmt.Fprintf(os.Stderr, "loopcheck: random graph %d: %v\n", i, err)
+			g.WriteEdgeList(os.Stderr)
+			return false
+		}
+		if err := loopforest.Compare[int](g, loopforest.Havlak[int]{}, loopforest.Natural[int]{}); err != nil {
+			fmt.Fprintf(os.Stderr, "loopcheck: random graph %d: %v\n", i, err)
+			g.WriteEdgeList(os.Stderr)
+			return false
+		}
+		checked++
+	}
+	fmt.Printf("random: %d graphs ok, %d of them split\n", checked, split)
+	return true
+}
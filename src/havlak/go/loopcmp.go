@@ -0,0 +1,213 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Comparison of loop nesting forests of CFGs stored as edge lists.
+//
+// Usage: loopcmp [-names int|uint|string] file.edges ...
+//
+// Reads each CFG in the edge-list format of package cfg (or standard
+// input, for "-"), finds its loops with every finder of package
+// loopforest, and prints a summary line per finder and then every
+// loop on which they do not all agree: the blocks of the loop, those
+// of them entered from outside it, and what each finder makes of it.
+//
+//    havlak: 2 loops, 1 irreducible, depth 2
+//    sreedhar-gao-lee: 1 loop, 1 irreducible, depth 1
+//    steensgaard: 2 loops, 1 irreducible, depth 2
+//    natural: 1 loop, 0 irreducible, depth 1
+//    loop a b d e (entries a b)
+//      havlak: header a (irreducible)
+//      sreedhar-gao-lee: header a (irreducible)
+//      steensgaard: header a (irreducible)
+//      natural: none
+//    loop d e (entries d)
+//      havlak: header d
+//      sreedhar-gao-lee: none
+//      steensgaard: header d
+//      natural: header d
+//
+// Loops are the same if they have the same blocks, nested loops
+// included; they agree if they also have the same header and are
+// both reducible or both not.
+//
+// The fixtures in testdata/forest are checked with 'make check-forest'.
+//
+package main
+
+import "flag"
+import "fmt"
+import "io"
+import "os"
+import "sort"
+import "strings"
+import "./basicblock"
+import "./lsg"
+import "./loopforest"
+
+var names = flag.String("names", "int", "type of the block names: int, uint or string")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: loopcmp [-names int|uint|string] file.edges ...\n")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		f := os.Stdin
+		if path != "-" {
+			var err error
+			if f, err = os.Open(path); err != nil {
+				fmt.Fprintf(os.Stderr, "loopcmp: %v\n", err)
+				status = 1
+				continue
+			}
+		}
+		var err error
+		switch *names {
+		case "int":
+			err = report[int](f)
+		case "uint":
+			err = report[uint64](f)
+		case "string":
+			err = report[string](f)
+		default:
+			err = fmt.Errorf("unknown name type %q", *names)
+		}
+		if f != os.Stdin {
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "loopcmp: %s: %v\n", path, err)
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+func report[K comparable](r io.Reader) error {
+	g, err := cfg.ReadEdgeList[K](r)
+	if err != nil {
+		return err
+	}
+	index := make(map[*cfg.BasicBlock[K]]int)
+	for i, bb := range g.Blocks() {
+		index[bb] = i
+	}
+
+	// The loops of every finder, by their blocks in Blocks order.
+	finders := loopforest.Finders[K]()
+	found := make([]map[string]*lsg.SimpleLoop[K], len(finders))
+	blocks := make(map[string][]*cfg.BasicBlock[K])
+	for i, f := range finders {
+		lsgraph := lsg.NewLSGOf[K]()
+		f.FindLoops(g, lsgraph)
+		lsgraph.CalculateNestingLevel()
+		found[i] = make(map[string]*lsg.SimpleLoop[K])
+		irreducible := 0
+		for _, loop := range lsgraph.Loops() {
+			var all []*cfg.BasicBlock[K]
+			for bb := range loop.AllBlocks() {
+				all = append(all, bb)
+			}
+			cfg.SortBlocks(all)
+			key := blockList(all)
+			found[i][key] = loop
+			blocks[key] = all
+			if !loop.IsReducible() {
+				irreducible++
+			}
+		}
+		fmt.Printf("%s: %s, %d irreducible, depth %d\n", f.Name(),
+			plural(lsgraph.NumLoops(), "loop"), irreducible, lsgraph.Root().NestingLevel())
+	}
+
+	keys := make([]string, 0, len(blocks))
+	for key := range blocks {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := blocks[keys[i]], blocks[keys[j]]
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return index[a[k]] < index[b[k]]
+			}
+		}
+		return len(a) < len(b)
+	})
+
+	for _, key := range keys {
+		verdicts := make([]string, len(finders))
+		for i := range finders {
+			verdicts[i] = "none"
+			if loop := found[i][key]; loop != nil {
+				verdicts[i] = "header " + cfg.BlockName(loop.Header())
+				if !loop.IsReducible() {
+					verdicts[i] += " (irreducible)"
+				}
+			}
+		}
+		agree := true
+		for _, v := range verdicts {
+			agree = agree && v == verdicts[0]
+		}
+		if agree {
+			continue
+		}
+		fmt.Printf("loop %s (entries %s)\n", key, blockList(entries(g, blocks[key])))
+		for i, f := range finders {
+			fmt.Printf("  %s: %s\n", f.Name(), verdicts[i])
+		}
+	}
+	return nil
+}
+
+// entries returns the blocks of 'loop' with a reachable predecessor
+// outside it, or that are the start node.
+//
+func entries[K comparable](g *cfg.CFG[K], loop []*cfg.BasicBlock[K]) []*cfg.BasicBlock[K] {
+	in := make(map[*cfg.BasicBlock[K]]bool)
+	for _, bb := range loop {
+		in[bb] = true
+	}
+	reached := g.Reachable()
+	var entries []*cfg.BasicBlock[K]
+	for _, bb := range loop {
+		entry := bb == g.StartBasicBlock()
+		for ll := bb.InEdges().Front(); ll != nil && !entry; ll = ll.Next() {
+			src := ll.Value.(*cfg.BasicBlockEdge[K]).Src()
+			entry = reached[src] && !in[src]
+		}
+		if entry {
+			entries = append(entries, bb)
+		}
+	}
+	return entries
+}
+
+func blockList[K comparable](blocks []*cfg.BasicBlock[K]) string {
+	names := make([]string, len(blocks))
+	for i, bb := range blocks {
+		names[i] = cfg.BlockName(bb)
+	}
+	return strings.Join(names, " ")
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,246 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Loop nesting forests other than Havlak's.
+//
+// On reducible graphs all loop forests agree: a loop is a header and
+// the blocks that reach its back edges without passing through it.
+// Irreducible regions have no such header, and the definitions in
+// use differ on what to take instead. Ramalingam ("On loops,
+// dominators, and dominance frontiers", 2002) shows that they all fit
+// one scheme: the outermost loops are the strongly connected
+// components of the graph; each picks some of its blocks as headers,
+// the edges inside it to those headers are removed, and the loops
+// nested in it are the components of what is left. The definitions
+// differ only in the headers:
+//
+//    Havlak              the entry first in DFS preorder
+//    Sreedhar-Gao-Lee    the blocks no other block of the component
+//                        dominates
+//    Steensgaard         the entries: the blocks with predecessors
+//                        outside the component
+//
+// The Sreedhar-Gao-Lee headers include the entries, and can be more:
+// a block whose predecessors are all in the component but dominated
+// by different entries. Havlak's loops also differ in the blocks
+// they contain: the body of an irreducible loop is only what reaches
+// its back edges, so a component may be split among sibling loops
+// headed by its other entries.
+//
+// Every finder here fills an LSG the way the Havlak loop finder does:
+// inner loops before outer ones, top-level loops without a parent
+// until CalculateNestingLevel, and every block in the innermost loop
+// containing it. A loop with several headers has the one first in
+// DFS preorder as its header and is marked irreducible; the other
+// headers are ordinary blocks of it. Only blocks reachable from the
+// start node are in loops.
+//
+package loopforest
+
+import "container/list"
+import "./basicblock"
+import "./lsg"
+import "./havlakloopfinder"
+import "./dominators"
+import "./scc"
+
+// LoopFinder computes a loop nesting forest.
+//
+type LoopFinder[K comparable] interface {
+	// Name identifies the algorithm, as a single lowercase word.
+	Name() string
+
+	// FindLoops adds the loops of 'cfgraph' to 'lsgraph'.
+	FindLoops(cfgraph *cfg.CFG[K], lsgraph *lsg.LSG[K])
+}
+
+// Finders returns a finder for every definition, Havlak first and
+// natural loops last.
+//
+func Finders[K comparable]() []LoopFinder[K] {
+	return []LoopFinder[K]{Havlak[K]{}, SreedharGaoLee[K]{}, Steensgaard[K]{}, Natural[K]{}}
+}
+
+// Havlak is the loop finder of package havlakloopfinder.
+//
+type Havlak[K comparable] struct{}
+
+func (Havlak[K]) Name() string {
+	return "havlak"
+}
+
+func (Havlak[K]) FindLoops(cfgraph *cfg.CFG[K], lsgraph *lsg.LSG[K]) {
+	havlakloopfinder.FindLoops(cfgraph, lsgraph)
+}
+
+// SreedharGaoLee finds the loops of Sreedhar, Gao and Lee
+// ("Identifying loops using DJ graphs", 1996).
+//
+type SreedharGaoLee[K comparable] struct{}
+
+func (SreedharGaoLee[K]) Name() string {
+	return "sreedhar-gao-lee"
+}
+
+// A block of a component is dominated by another one exactly when
+// its immediate dominator is in the component too.
+//
+func (SreedharGaoLee[K]) FindLoops(cfgraph *cfg.CFG[K], lsgraph *lsg.LSG[K]) {
+	tree := dominators.Compute(cfgraph)
+	forest(cfgraph, lsgraph, func(members []*cfg.BasicBlock[K], in map[*cfg.BasicBlock[K]]bool) []*cfg.BasicBlock[K] {
+		var headers []*cfg.BasicBlock[K]
+		for _, bb := range members {
+			if !in[tree.Idom(bb)] {
+				headers = append(headers, bb)
+			}
+		}
+		return headers
+	})
+}
+
+// Steensgaard finds the loops of Steensgaard ("Sequentializing
+// program dependence graphs for irreducible programs", 1993).
+//
+type Steensgaard[K comparable] struct{}
+
+func (Steensgaard[K]) Name() string {
+	return "steensgaard"
+}
+
+func (Steensgaard[K]) FindLoops(cfgraph *cfg.CFG[K], lsgraph *lsg.LSG[K]) {
+	start := cfgraph.StartBasicBlock()
+	reached := cfgraph.Reachable()
+	forest(cfgraph, lsgraph, func(members []*cfg.BasicBlock[K], in map[*cfg.BasicBlock[K]]bool) []*cfg.BasicBlock[K] {
+		var headers []*cfg.BasicBlock[K]
+		for _, bb := range members {
+			entry := bb == start
+			for ll := bb.InEdges().Front(); ll != nil && !entry; ll = ll.Next() {
+				src := ll.Value.(*cfg.BasicBlockEdge[K]).Src()
+				entry = reached[src] && !in[src]
+			}
+			if entry {
+				headers = append(headers, bb)
+			}
+		}
+		return headers
+	})
+}
+
+// forest fills 'lsgraph' following Ramalingam's scheme. 'headers' is
+// given the blocks of a cyclic component in Blocks order, and the
+// same as a set, and returns at least one of them. Edges from
+// unreachable blocks do not enter any component.
+//
+func forest[K comparable](cfgraph *cfg.CFG[K], lsgraph *lsg.LSG[K], headers func([]*cfg.BasicBlock[K], map[*cfg.BasicBlock[K]]bool) []*cfg.BasicBlock[K]) {
+	start := cfgraph.StartBasicBlock()
+	if start == nil {
+		return
+	}
+	pre := preorder(start)
+	cut := make(map[*cfg.BasicBlock[K]]bool)
+
+	// loops returns the outermost loops of 'region', a set of blocks
+	// in Blocks order, after adding all the loops in it to the LSG.
+	var loops func(region []*cfg.BasicBlock[K]) []*lsg.SimpleLoop[K]
+	loops = func(region []*cfg.BasicBlock[K]) []*lsg.SimpleLoop[K] {
+		in := make(map[*cfg.BasicBlock[K]]bool)
+		sub := cfg.NewCFGOf[K]()
+		for _, bb := range region {
+			in[bb] = true
+			sub.CreateNode(bb.Name())
+		}
+		for _, bb := range region {
+			for ll := bb.OutEdges().Front(); ll != nil; ll = ll.Next() {
+				if dst := ll.Value.(*cfg.BasicBlockEdge[K]).Dst(); in[dst] && !cut[dst] {
+					cfg.NewBasicBlockEdge(sub, bb.Name(), dst.Name())
+				}
+			}
+		}
+
+		var outer []*lsg.SimpleLoop[K]
+		c := scc.Find(sub)
+		for _, i := range c.Topological() {
+			if !c.IsCyclic(i) {
+				continue
+			}
+			members := make([]*cfg.BasicBlock[K], 0, len(c.Members(i)))
+			component := make(map[*cfg.BasicBlock[K]]bool)
+			for _, bb := range c.Members(i) {
+				bb = cfgraph.BasicBlocks()[bb.Name()]
+				members = append(members, bb)
+				component[bb] = true
+			}
+			hs := headers(members, component)
+			first := hs[0]
+			for _, h := range hs {
+				cut[h] = true
+				if pre[h] < pre[first] {
+					first = h
+				}
+			}
+
+			inner := loops(members)
+			loop := lsgraph.NewLoop()
+			loop.SetHeader(first)
+			loop.SetIsReducible(len(hs) == 1)
+			nested := make(map[*cfg.BasicBlock[K]]bool)
+			for _, child := range inner {
+				child.SetParent(loop)
+				for bb := range child.AllBlocks() {
+					nested[bb] = true
+				}
+			}
+			for _, bb := range members {
+				if !nested[bb] {
+					loop.AddNode(bb)
+				}
+			}
+			lsgraph.AddLoop(loop)
+			outer = append(outer, loop)
+		}
+		return outer
+	}
+
+	reached := cfgraph.Reachable()
+	var region []*cfg.BasicBlock[K]
+	for _, bb := range cfgraph.Blocks() {
+		if reached[bb] {
+			region = append(region, bb)
+		}
+	}
+	loops(region)
+}
+
+// preorder numbers the blocks reachable from 'start' in the DFS
+// preorder of the Havlak loop finder, which follows out-edges in
+// order.
+//
+func preorder[K comparable](start *cfg.BasicBlock[K]) map[*cfg.BasicBlock[K]]int {
+	number := map[*cfg.BasicBlock[K]]int{start: 0}
+	stack := []*list.Element{start.OutEdges().Front()}
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		if next == nil {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		stack[len(stack)-1] = next.Next()
+		bb := next.Value.(*cfg.BasicBlockEdge[K]).Dst()
+		if _, seen := number[bb]; !seen {
+			number[bb] = len(number)
+			stack = append(stack, bb.OutEdges().Front())
+		}
+	}
+	return number
+}
@@ -0,0 +1,232 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//======================================================
+// JSON Encoding
+//======================================================
+
+// A loop structure graph marshals to a versioned JSON document that
+// lists the loop tree in preorder, the artificial root first:
+//
+//    {
+//      "version": 1,
+//      "loops": [
+//        {"id": 0, "root": true, "blocks": [], "children": [1],
+//         "reducible": false, "depth": 0, "nesting": 1},
+//        {"id": 1, "parent": 0, "header": 1, "blocks": [1, 2],
+//         "children": [], "reducible": true, "depth": 1, "nesting": 0}
+//      ]
+//    }
+//
+// Loop ids are preorder positions, children in creation order, so
+// they are stable for a given CFG. "blocks" are the blocks that
+// belong directly to the loop, not to a nested loop, in Blocks order;
+// a loop's full body is its blocks plus those of its descendants.
+// "header" and "parent" are omitted for the root. "depth" and
+// "nesting" are DepthLevel and NestingLevel. Block names are written
+// as in the JSON encoding of package cfg.
+//
+// Loops that are not linked under the root (CalculateNestingLevel
+// has not run) are listed after the tree as if they were children
+// of the root. A document whose version is not LSGJSONVersion is
+// rejected by UnmarshalLSG.
+
+package lsg
+
+import "encoding/json"
+import "fmt"
+import "sort"
+import "./basicblock"
+
+// LSGJSONVersion is the version of the JSON schema written by
+// LSG.MarshalJSON.
+//
+const LSGJSONVersion = 1
+
+type jsonLSG[K comparable] struct {
+	Version int           `json:"version"`
+	Loops   []jsonLoop[K] `json:"loops"`
+}
+
+type jsonLoop[K comparable] struct {
+	ID        int               `json:"id"`
+	Root      bool              `json:"root,omitempty"`
+	Parent    *int              `json:"parent,omitempty"`
+	Header    *cfg.JSONName[K]  `json:"header,omitempty"`
+	Blocks    []cfg.JSONName[K] `json:"blocks"`
+	Children  []int             `json:"children"`
+	Reducible bool              `json:"reducible"`
+	Depth     int               `json:"depth"`
+	Nesting   int               `json:"nesting"`
+}
+
+func (lsg *LSG[K]) MarshalJSON() ([]byte, error) {
+	var order []*SimpleLoop[K]
+	ids := make(map[*SimpleLoop[K]]int)
+	var visit func(loop *SimpleLoop[K])
+	visit = func(loop *SimpleLoop[K]) {
+		ids[loop] = len(order)
+		order = append(order, loop)
+		for _, child := range sortedChildren(loop) {
+			visit(child)
+		}
+	}
+	visit(lsg.root)
+
+	// Loops not yet linked under the root hang off it here.
+	var orphans []*SimpleLoop[K]
+	for _, loop := range lsg.Loops() {
+		if loop.parent == nil {
+			orphans = append(orphans, loop)
+		}
+	}
+	for _, loop := range orphans {
+		visit(loop)
+	}
+
+	doc := jsonLSG[K]{Version: LSGJSONVersion}
+	for _, loop := range order {
+		l := jsonLoop[K]{
+			ID:        ids[loop],
+			Root:      loop == lsg.root,
+			Blocks:    []cfg.JSONName[K]{},
+			Children:  []int{},
+			Reducible: loop.isReducible,
+			Depth:     loop.depthLevel,
+			Nesting:   loop.nestingLevel,
+		}
+		if loop != lsg.root {
+			parent := 0
+			if loop.parent != nil {
+				parent = ids[loop.parent]
+			}
+			l.Parent = &parent
+		}
+		if loop.header != nil {
+			l.Header = &cfg.JSONName[K]{Name: loop.header.Name()}
+		}
+
+		blocks := make([]*cfg.BasicBlock[K], 0, len(loop.basicBlocks))
+		for bb, _ := range loop.basicBlocks {
+			blocks = append(blocks, bb)
+		}
+		cfg.SortBlocks(blocks)
+		for _, bb := range blocks {
+			l.Blocks = append(l.Blocks, cfg.JSONName[K]{Name: bb.Name()})
+		}
+
+		for _, child := range sortedChildren(loop) {
+			l.Children = append(l.Children, ids[child])
+		}
+		if loop == lsg.root {
+			for _, orphan := range orphans {
+				l.Children = append(l.Children, ids[orphan])
+			}
+		}
+		doc.Loops = append(doc.Loops, l)
+	}
+	return json.Marshal(doc)
+}
+
+// sortedChildren returns the children of a loop in creation order.
+//
+func sortedChildren[K comparable](loop *SimpleLoop[K]) []*SimpleLoop[K] {
+	children := make([]*SimpleLoop[K], 0, len(loop.children))
+	for child, _ := range loop.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].counter < children[j].counter
+	})
+	return children
+}
+
+// UnmarshalLSG rebuilds a loop structure graph from JSON written by
+// LSG.MarshalJSON, resolving block names in 'cfgraph'.
+//
+func UnmarshalLSG[K comparable](data []byte, cfgraph *cfg.CFG[K]) (*LSG[K], error) {
+	var doc jsonLSG[K]
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Version != LSGJSONVersion {
+		return nil, fmt.Errorf("lsg: unsupported JSON version %d", doc.Version)
+	}
+
+	block := func(name K) (*cfg.BasicBlock[K], error) {
+		if bb := cfgraph.BasicBlocks()[name]; bb != nil {
+			return bb, nil
+		}
+		return nil, fmt.Errorf("lsg: no block %s in the CFG", cfg.FormatName(name))
+	}
+
+	lsg := NewLSGOf[K]()
+	loops := make(map[int]*SimpleLoop[K])
+	roots := 0
+	for _, l := range doc.Loops {
+		if loops[l.ID] != nil {
+			return nil, fmt.Errorf("lsg: loop id %d used twice", l.ID)
+		}
+		loop := lsg.root
+		if l.Root {
+			roots++
+		} else {
+			loop = lsg.NewLoop()
+			if l.Header == nil {
+				return nil, fmt.Errorf("lsg: loop %d has no header", l.ID)
+			}
+			header, err := block(l.Header.Name)
+			if err != nil {
+				return nil, err
+			}
+			loop.SetHeader(header)
+			lsg.AddLoop(loop)
+		}
+		for _, name := range l.Blocks {
+			bb, err := block(name.Name)
+			if err != nil {
+				return nil, err
+			}
+			loop.AddNode(bb)
+		}
+		loop.SetIsReducible(l.Reducible)
+		loop.SetDepthLevel(l.Depth)
+		loop.SetNestingLevel(l.Nesting)
+		loops[l.ID] = loop
+	}
+	if roots != 1 {
+		return nil, fmt.Errorf("lsg: %d root loops, want 1", roots)
+	}
+
+	for _, l := range doc.Loops {
+		loop := loops[l.ID]
+		for _, id := range l.Children {
+			child := loops[id]
+			if child == nil || child == lsg.root {
+				return nil, fmt.Errorf("lsg: loop %d has bad child %d", l.ID, id)
+			}
+			if child.parent != nil {
+				return nil, fmt.Errorf("lsg: loop %d has two parents", id)
+			}
+			child.SetParent(loop)
+		}
+	}
+	for _, l := range doc.Loops {
+		loop := loops[l.ID]
+		if !l.Root && (l.Parent == nil || loops[*l.Parent] != loop.parent) {
+			return nil, fmt.Errorf("lsg: parent of loop %d disagrees with children lists", l.ID)
+		}
+	}
+	return lsg, nil
+}
@@ -29,7 +29,7 @@ import "./havlakloopfinder"
 // Testing Code
 //======================================================
 
-func buildDiamond(cfgraph *cfg.CFG, start int) int {
+func buildDiamond(cfgraph *cfg.CFG[int], start int) int {
 	bb0 := start
 	cfg.NewBasicBlockEdge(cfgraph, bb0, bb0+1)
 	cfg.NewBasicBlockEdge(cfgraph, bb0, bb0+2)
@@ -39,18 +39,18 @@ func buildDiamond(cfgraph *cfg.CFG, start int) int {
 	return bb0 + 3
 }
 
-func buildConnect(cfgraph *cfg.CFG, start int, end int) {
+func buildConnect(cfgraph *cfg.CFG[int], start int, end int) {
 	cfg.NewBasicBlockEdge(cfgraph, start, end)
 }
 
-func buildStraight(cfgraph *cfg.CFG, start int, n int) int {
+func buildStraight(cfgraph *cfg.CFG[int], start int, n int) int {
 	for i := 0; i < n; i++ {
 		buildConnect(cfgraph, start+i, start+i+1)
 	}
 	return start + n
 }
 
-func buildBaseLoop(cfgraph *cfg.CFG, from int) int {
+func buildBaseLoop(cfgraph *cfg.CFG[int], from int) int {
 	header := buildStraight(cfgraph, from, 1)
 	diamond1 := buildDiamond(cfgraph, header)
 	d11 := buildStraight(cfgraph, diamond1, 1)
@@ -72,7 +72,7 @@ func main() {
 
 	fmt.Printf("Constructing Simple CFG...\n")
 
-	cfgraph.CreateNode(0) // top
+	cfgraph.SetStart(0) // top
 	buildBaseLoop(cfgraph, 0)
 	cfgraph.CreateNode(1) // bottom
 	cfg.NewBasicBlockEdge(cfgraph, 0, 2)
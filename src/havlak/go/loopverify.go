@@ -0,0 +1,35 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Consistency checks of loop structure graphs.
+//
+// A loop finder fills an LSG through its setters, and nothing keeps
+// it from building a forest that contradicts itself or the CFG it
+// was given. LSG.Verify checks one against the other, but needs to
+// be told which blocks dominate which: package lsg cannot import
+// package dominators, which imports it. Verify supplies the
+// dominator tree.
+//
+package loopverify
+
+import "./basicblock"
+import "./lsg"
+import "./dominators"
+
+// Verify is lsgraph.Verify with the dominator tree of 'cfgraph' as
+// the reference for reducible loops.
+//
+func Verify[K comparable](lsgraph *lsg.LSG[K], cfgraph *cfg.CFG[K]) error {
+	return lsgraph.Verify(cfgraph, dominators.Compute(cfgraph).Dominates)
+}
@@ -20,6 +20,7 @@ package lsg
 
 import "container/list"
 import "fmt"
+import "io"
 import "./basicblock"
 
 //======================================================
@@ -34,12 +35,12 @@ import "./basicblock"
 // it can be an irreducible loop, have control flow, be
 // a candidate for transformations, and what not.
 //
-type SimpleLoop struct {
+type SimpleLoop[K comparable] struct {
 	// No set, use map to bool
-	basicBlocks map[*cfg.BasicBlock]bool
-	children    map[*SimpleLoop]bool
-	parent      *SimpleLoop
-	header      *cfg.BasicBlock
+	basicBlocks map[*cfg.BasicBlock[K]]bool
+	children    map[*SimpleLoop[K]]bool
+	parent      *SimpleLoop[K]
+	header      *cfg.BasicBlock[K]
 
 	isRoot       bool
 	isReducible  bool
@@ -48,15 +49,15 @@ type SimpleLoop struct {
 	depthLevel   int
 }
 
-func (loop *SimpleLoop) AddNode(bb *cfg.BasicBlock) {
+func (loop *SimpleLoop[K]) AddNode(bb *cfg.BasicBlock[K]) {
 	loop.basicBlocks[bb] = true
 }
 
-func (loop *SimpleLoop) AddChildLoop(child *SimpleLoop) {
+func (loop *SimpleLoop[K]) AddChildLoop(child *SimpleLoop[K]) {
 	loop.children[child] = true
 }
 
-func (loop *SimpleLoop) Dump(indent int) {
+func (loop *SimpleLoop[K]) Dump(indent int) {
 	for i := 0; i < indent; i++ {
 		fmt.Printf("  ")
 	}
@@ -78,7 +79,7 @@ func (loop *SimpleLoop) Dump(indent int) {
 	if len(loop.basicBlocks) > 0 {
 		fmt.Printf("(")
 		for bb, _ := range loop.basicBlocks {
-			fmt.Printf("BB#%03d ", bb.Name())
+			fmt.Printf("%v ", bb)
 			if loop.header == bb {
 				fmt.Printf("*")
 			}
@@ -88,57 +89,123 @@ func (loop *SimpleLoop) Dump(indent int) {
 	fmt.Printf("\n")
 }
 
-func (loop *SimpleLoop) Children() map[*SimpleLoop]bool {
+// AllBlocks returns the blocks of this loop together with the
+// blocks of all loops nested in it.
+//
+func (loop *SimpleLoop[K]) AllBlocks() map[*cfg.BasicBlock[K]]bool {
+	blocks := make(map[*cfg.BasicBlock[K]]bool)
+	loop.collectBlocks(blocks)
+	return blocks
+}
+
+func (loop *SimpleLoop[K]) collectBlocks(blocks map[*cfg.BasicBlock[K]]bool) {
+	for bb, _ := range loop.basicBlocks {
+		blocks[bb] = true
+	}
+	for ll, _ := range loop.children {
+		ll.collectBlocks(blocks)
+	}
+}
+
+// BackEdgeWeight is the total profile weight of the edges from
+// inside the loop back to its header.
+//
+func (loop *SimpleLoop[K]) BackEdgeWeight() int64 {
+	if loop.header == nil {
+		return 0
+	}
+	blocks := loop.AllBlocks()
+	var weight int64
+	for ll := loop.header.InEdges().Front(); ll != nil; ll = ll.Next() {
+		if edge := ll.Value.(*cfg.BasicBlockEdge[K]); blocks[edge.Src()] {
+			weight += edge.Weight()
+		}
+	}
+	return weight
+}
+
+// ExitEdgeWeight is the total profile weight of the edges leaving
+// the loop.
+//
+func (loop *SimpleLoop[K]) ExitEdgeWeight() int64 {
+	blocks := loop.AllBlocks()
+	var weight int64
+	for bb, _ := range blocks {
+		for ll := bb.OutEdges().Front(); ll != nil; ll = ll.Next() {
+			if edge := ll.Value.(*cfg.BasicBlockEdge[K]); !blocks[edge.Dst()] {
+				weight += edge.Weight()
+			}
+		}
+	}
+	return weight
+}
+
+// BasicBlocks returns the blocks that belong directly to this loop,
+// not to a loop nested in it. The header is one of them.
+//
+func (loop *SimpleLoop[K]) BasicBlocks() map[*cfg.BasicBlock[K]]bool {
+	return loop.basicBlocks
+}
+
+func (loop *SimpleLoop[K]) Header() *cfg.BasicBlock[K] {
+	return loop.header
+}
+
+func (loop *SimpleLoop[K]) IsReducible() bool {
+	return loop.isReducible
+}
+
+func (loop *SimpleLoop[K]) Children() map[*SimpleLoop[K]]bool {
 	return loop.children
 }
 
-func (loop *SimpleLoop) Parent() *SimpleLoop {
+func (loop *SimpleLoop[K]) Parent() *SimpleLoop[K] {
 	return loop.parent
 }
 
-func (loop *SimpleLoop) NestingLevel() int {
+func (loop *SimpleLoop[K]) NestingLevel() int {
 	return loop.nestingLevel
 }
 
-func (loop *SimpleLoop) DepthLevel() int {
+func (loop *SimpleLoop[K]) DepthLevel() int {
 	return loop.depthLevel
 }
 
-func (loop *SimpleLoop) Counter() int {
+func (loop *SimpleLoop[K]) Counter() int {
 	return loop.counter
 }
 
-func (loop *SimpleLoop) IsRoot() bool {
+func (loop *SimpleLoop[K]) IsRoot() bool {
 	return loop.isRoot
 }
 
-func (loop *SimpleLoop) SetParent(parent *SimpleLoop) {
+func (loop *SimpleLoop[K]) SetParent(parent *SimpleLoop[K]) {
 	loop.parent = parent
 	loop.parent.AddChildLoop(loop)
 }
 
-func (loop *SimpleLoop) SetHeader(bb *cfg.BasicBlock) {
+func (loop *SimpleLoop[K]) SetHeader(bb *cfg.BasicBlock[K]) {
 	loop.AddNode(bb)
 	loop.header = bb
 }
 
-func (loop *SimpleLoop) SetIsRoot() {
+func (loop *SimpleLoop[K]) SetIsRoot() {
 	loop.isRoot = true
 }
 
-func (loop *SimpleLoop) SetNestingLevel(level int) {
+func (loop *SimpleLoop[K]) SetNestingLevel(level int) {
 	loop.nestingLevel = level
 }
 
-func (loop *SimpleLoop) SetDepthLevel(level int) {
+func (loop *SimpleLoop[K]) SetDepthLevel(level int) {
 	loop.depthLevel = level
 }
 
-func (loop *SimpleLoop) SetIsReducible(isReducible bool) {
+func (loop *SimpleLoop[K]) SetIsReducible(isReducible bool) {
 	loop.isReducible = isReducible
 }
 
-func (loop *SimpleLoop) SetCounter(value int) {
+func (loop *SimpleLoop[K]) SetCounter(value int) {
 	loop.counter = value
 }
 
@@ -169,23 +236,32 @@ func max(x, y int) int {
 //
 var loopCounter = 0
 
-type LSG struct {
-	root  *SimpleLoop
+type LSG[K comparable] struct {
+	root  *SimpleLoop[K]
 	loops list.List
 }
 
-func NewLSG() *LSG {
-	lsg := new(LSG)
+// NewLSG creates a loop structure graph for an int-named CFG.
+//
+func NewLSG() *LSG[int] {
+	return NewLSGOf[int]()
+}
+
+// NewLSGOf creates a loop structure graph for a CFG whose blocks are
+// named by values of type K.
+//
+func NewLSGOf[K comparable]() *LSG[K] {
+	lsg := new(LSG[K])
 	lsg.root = lsg.NewLoop()
 	lsg.root.SetNestingLevel(0)
 
 	return lsg
 }
 
-func (lsg *LSG) NewLoop() *SimpleLoop {
-	loop := new(SimpleLoop)
-	loop.basicBlocks = make(map[*cfg.BasicBlock]bool)
-	loop.children = make(map[*SimpleLoop]bool)
+func (lsg *LSG[K]) NewLoop() *SimpleLoop[K] {
+	loop := new(SimpleLoop[K])
+	loop.basicBlocks = make(map[*cfg.BasicBlock[K]]bool)
+	loop.children = make(map[*SimpleLoop[K]]bool)
 	loop.parent = nil
 	loop.header = nil
 
@@ -194,15 +270,15 @@ func (lsg *LSG) NewLoop() *SimpleLoop {
 	return loop
 }
 
-func (lsg *LSG) AddLoop(loop *SimpleLoop) {
+func (lsg *LSG[K]) AddLoop(loop *SimpleLoop[K]) {
 	lsg.loops.PushBack(loop)
 }
 
-func (lsg *LSG) Dump() {
+func (lsg *LSG[K]) Dump() {
 	lsg.dump(lsg.root, 0)
 }
 
-func (lsg *LSG) dump(loop *SimpleLoop, indent int) {
+func (lsg *LSG[K]) dump(loop *SimpleLoop[K], indent int) {
 	loop.Dump(indent)
 
 	for ll, _ := range loop.children {
@@ -210,9 +286,57 @@ func (lsg *LSG) dump(loop *SimpleLoop, indent int) {
 	}
 }
 
-func (lsg *LSG) CalculateNestingLevel() {
+// WriteNest prints the loop tree, one loop per line indented by
+// depth, children in the order the loops were found:
+//
+//    loop 2: header 4, depth 1, nesting 1, blocks 4 5 9
+//      loop 1: header 5, depth 2, nesting 0, blocks 5 6 (irreducible)
+//
+// Loops are numbered from 1 in the order they were added, so the
+// output does not depend on what else the program analyzed. Only the
+// blocks directly in a loop are listed, header first. Depth and
+// nesting are those of the last CalculateNestingLevel.
+//
+func (lsg *LSG[K]) WriteNest(w io.Writer) error {
+	number := make(map[*SimpleLoop[K]]int)
+	for i, loop := range lsg.Loops() {
+		number[loop] = i + 1
+	}
+	return lsg.writeNest(w, lsg.root, "", number)
+}
+
+func (lsg *LSG[K]) writeNest(w io.Writer, loop *SimpleLoop[K], indent string, number map[*SimpleLoop[K]]int) error {
+	for _, child := range sortedChildren(loop) {
+		blocks := make([]*cfg.BasicBlock[K], 0, len(child.basicBlocks))
+		for bb, _ := range child.basicBlocks {
+			if bb != child.header {
+				blocks = append(blocks, bb)
+			}
+		}
+		cfg.SortBlocks(blocks)
+
+		header := cfg.BlockName(child.header)
+		line := fmt.Sprintf("%sloop %d: header %s, depth %d, nesting %d, blocks %s",
+			indent, number[child], header, child.depthLevel, child.nestingLevel, header)
+		for _, bb := range blocks {
+			line += " " + cfg.BlockName(bb)
+		}
+		if !child.isReducible {
+			line += " (irreducible)"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		if err := lsg.writeNest(w, child, indent+"  ", number); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lsg *LSG[K]) CalculateNestingLevel() {
 	for ll := lsg.loops.Front(); ll != nil; ll = ll.Next() {
-		sl := ll.Value.(*SimpleLoop)
+		sl := ll.Value.(*SimpleLoop[K])
 		if sl.IsRoot() {
 			continue
 		}
@@ -223,20 +347,31 @@ func (lsg *LSG) CalculateNestingLevel() {
 	lsg.calculateNestingLevel(lsg.root, 0)
 }
 
-func (lsg *LSG) calculateNestingLevel(loop *SimpleLoop, depth int) {
+func (lsg *LSG[K]) calculateNestingLevel(loop *SimpleLoop[K], depth int) {
 	loop.SetDepthLevel(depth)
 	for ll, _ := range loop.children {
 		lsg.calculateNestingLevel(ll, depth+1)
 
-		ll.SetNestingLevel(max(loop.NestingLevel(),
+		loop.SetNestingLevel(max(loop.NestingLevel(),
 			ll.NestingLevel()+1))
 	}
 }
 
-func (lsg *LSG) NumLoops() int {
+// Loops returns the loops in the order they were added; the
+// artificial root is not among them.
+//
+func (lsg *LSG[K]) Loops() []*SimpleLoop[K] {
+	loops := make([]*SimpleLoop[K], 0, lsg.loops.Len())
+	for ll := lsg.loops.Front(); ll != nil; ll = ll.Next() {
+		loops = append(loops, ll.Value.(*SimpleLoop[K]))
+	}
+	return loops
+}
+
+func (lsg *LSG[K]) NumLoops() int {
 	return lsg.loops.Len()
 }
 
-func (lsg *LSG) Root() *SimpleLoop {
+func (lsg *LSG[K]) Root() *SimpleLoop[K] {
 	return lsg.root
 }
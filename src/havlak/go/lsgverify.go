@@ -0,0 +1,147 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//======================================================
+// Consistency Checks
+//======================================================
+
+// A loop finder fills an LSG through its setters, and nothing keeps
+// it from building a forest that contradicts itself or the CFG it
+// was given. Verify checks one against the other. Violations are
+// reported in a fixed order: children by counter, blocks in Blocks
+// order.
+
+package lsg
+
+import "errors"
+import "fmt"
+import "./basicblock"
+
+// Verify checks that the loop forest is consistent with itself and
+// with 'cfgraph', the CFG it was computed for, and reports every
+// violation:
+//
+//    - parent and child links disagree, or a loop is not in the tree
+//      under the root (CalculateNestingLevel links top-level loops),
+//    - a loop has no header, or its header is not one of its blocks,
+//    - a block belongs directly to more than one loop, so it has no
+//      unique innermost loop (blocks in no loop belong to the root),
+//    - a block of a loop is not part of the CFG, or cannot be reached,
+//    - the header of a reducible loop does not dominate every block
+//      of the loop, including the blocks of nested loops,
+//    - DepthLevel or NestingLevel differ from the depth of the loop
+//      in the tree and the height of the subtree below it.
+//
+// dominates(a, b) says whether block 'a' dominates block 'b'. This
+// package cannot compute it, as package dominators imports it;
+// loopverify.Verify passes the dominator tree of that package.
+//
+func (lsg *LSG[K]) Verify(cfgraph *cfg.CFG[K], dominates func(a, b *cfg.BasicBlock[K]) bool) error {
+	var errs []error
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	inTree := make(map[*SimpleLoop[K]]bool)
+	var walk func(loop *SimpleLoop[K])
+	walk = func(loop *SimpleLoop[K]) {
+		inTree[loop] = true
+		for _, child := range sortedChildren(loop) {
+			if child.Parent() != loop {
+				report("loop-%d lists loop-%d as a child, but it is not its parent",
+					loop.Counter(), child.Counter())
+			}
+			if inTree[child] {
+				report("loop-%d occurs twice in the tree", child.Counter())
+				continue
+			}
+			walk(child)
+		}
+	}
+	walk(lsg.Root())
+
+	loops := lsg.Loops()
+	for _, loop := range loops {
+		switch {
+		case !inTree[loop]:
+			report("loop-%d is not linked into the tree under the root", loop.Counter())
+		case loop.Parent() != nil && !loop.Parent().Children()[loop]:
+			report("loop-%d is missing from the children of its parent loop-%d",
+				loop.Counter(), loop.Parent().Counter())
+		}
+		if loop.Header() == nil {
+			report("loop-%d has no header", loop.Counter())
+		} else if !loop.BasicBlocks()[loop.Header()] {
+			report("loop-%d does not contain its header %v", loop.Counter(), loop.Header())
+		}
+	}
+
+	owner := make(map[*cfg.BasicBlock[K]]*SimpleLoop[K])
+	reached := cfgraph.Reachable()
+	for _, loop := range append([]*SimpleLoop[K]{lsg.Root()}, loops...) {
+		for _, bb := range sortedBlocks(loop.BasicBlocks()) {
+			if other := owner[bb]; other != nil {
+				report("%v is in both loop-%d and loop-%d", bb, other.Counter(), loop.Counter())
+			}
+			owner[bb] = loop
+			if cfgraph.BasicBlocks()[bb.Name()] != bb {
+				report("%v of loop-%d is not part of the CFG", bb, loop.Counter())
+			} else if !reached[bb] {
+				report("%v of loop-%d is not reachable", bb, loop.Counter())
+			}
+		}
+	}
+
+	for _, loop := range loops {
+		if !loop.IsReducible() || loop.Header() == nil || !reached[loop.Header()] {
+			continue
+		}
+		for _, bb := range sortedBlocks(loop.AllBlocks()) {
+			if reached[bb] && !dominates(loop.Header(), bb) {
+				report("header %v of reducible loop-%d does not dominate %v",
+					loop.Header(), loop.Counter(), bb)
+			}
+		}
+	}
+
+	var levels func(loop *SimpleLoop[K], depth int) int
+	levels = func(loop *SimpleLoop[K], depth int) int {
+		height := 0
+		for _, child := range sortedChildren(loop) {
+			if child.Parent() == loop {
+				height = max(height, levels(child, depth+1)+1)
+			}
+		}
+		if loop.DepthLevel() != depth {
+			report("loop-%d has depth %d, expected %d", loop.Counter(), loop.DepthLevel(), depth)
+		}
+		if loop.NestingLevel() != height {
+			report("loop-%d has nesting level %d, expected %d",
+				loop.Counter(), loop.NestingLevel(), height)
+		}
+		return height
+	}
+	levels(lsg.Root(), 0)
+
+	return errors.Join(errs...)
+}
+
+func sortedBlocks[K comparable](blocks map[*cfg.BasicBlock[K]]bool) []*cfg.BasicBlock[K] {
+	list := make([]*cfg.BasicBlock[K], 0, len(blocks))
+	for bb := range blocks {
+		list = append(list, bb)
+	}
+	cfg.SortBlocks(list)
+	return list
+}
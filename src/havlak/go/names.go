@@ -0,0 +1,250 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//======================================================
+// Block Names
+//======================================================
+
+// Blocks can be named by any comparable type. Names of the basic
+// kinds (signed and unsigned integers, floats, strings, and types
+// defined on them) can also be ordered, printed and parsed, which
+// is what deterministic output and the text formats need, and
+// SetEntries can invent the name of a virtual entry among them.
+
+package cfg
+
+import "fmt"
+import "math"
+import "reflect"
+import "strconv"
+import "strings"
+
+// FormatName renders a block name for the text formats. Signed
+// integers are written in decimal, unsigned ones in hex (they are
+// usually addresses), strings as they are. ParseName reads the
+// result back.
+//
+func FormatName[K comparable](name K) string {
+	v := reflect.ValueOf(name)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "0x" + strconv.FormatUint(v.Uint(), 16)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.String:
+		return v.String()
+	}
+	return fmt.Sprint(name)
+}
+
+// BlockName renders the name of 'bb' for the text reports: as
+// FormatName does, but quoted as in the edge-list format when it
+// would not read as a single word there, or when it contains a comma,
+// which the reports use to separate blocks.
+//
+func BlockName[K comparable](bb *BasicBlock[K]) string {
+	name := FormatName(bb.Name())
+	if strings.Contains(name, ",") {
+		return strconv.Quote(name)
+	}
+	return quoteField(name)
+}
+
+// ParseName is the inverse of FormatName. Integers may be given in
+// decimal or with a 0x, 0o or 0b prefix.
+//
+func ParseName[K comparable](s string) (K, error) {
+	var name K
+	v := reflect.ValueOf(&name).Elem()
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, numberBase(s), v.Type().Bits())
+		if err != nil {
+			return name, fmt.Errorf("bad block name %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, numberBase(s), v.Type().Bits())
+		if err != nil {
+			return name, fmt.Errorf("bad block name %q", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return name, fmt.Errorf("bad block name %q", s)
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		v.SetString(s)
+	default:
+		return name, fmt.Errorf("cannot parse block names of type %v", v.Type())
+	}
+	return name, nil
+}
+
+// numberBase picks base 0 (prefix-driven) only for prefixed
+// numbers, so that a name like "010" stays decimal.
+//
+func numberBase(s string) int {
+	s = strings.TrimPrefix(s, "-")
+	if len(s) > 2 && s[0] == '0' && strings.ContainsRune("xXoObB", rune(s[1])) {
+		return 0
+	}
+	return 10
+}
+
+// displayName is FormatName, except that signed integers keep the
+// zero-padded "%03d" look of the original dumps.
+//
+func displayName[K comparable](name K) string {
+	v := reflect.ValueOf(name)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fmt.Sprintf("%03d", v.Int())
+	}
+	return FormatName(name)
+}
+
+func isOrderedName[K comparable](name K) bool {
+	switch reflect.ValueOf(name).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	}
+	return false
+}
+
+func isUnsignedName[K comparable](name K) bool {
+	switch reflect.ValueOf(name).Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// nameLess orders names of the kinds accepted by isOrderedName.
+//
+func nameLess[K comparable](a, b K) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch va.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return va.Int() < vb.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return va.Uint() < vb.Uint()
+	case reflect.Float32, reflect.Float64:
+		return va.Float() < vb.Float()
+	case reflect.String:
+		return va.String() < vb.String()
+	}
+	return false
+}
+
+// freshName invents a name for a virtual entry that no block, and
+// none of 'pending', uses yet: for signed integers and floats one
+// below the smallest name (and never above -1), for unsigned integers
+// one above the largest, for strings "virtual-entry" with a numeric
+// suffix if needed. If the smallest or largest name is the limit of
+// its type, or too large for one less to differ, the free name
+// nearest to -1 or to 0 is taken instead. Other name types must use
+// SetEntriesNamed; for them, and for a type with no name left,
+// freshName panics.
+//
+func (cfg *CFG[K]) freshName(pending []K) K {
+	taken := func(name K) bool {
+		if cfg.bb[name] != nil {
+			return true
+		}
+		for _, p := range pending {
+			if p == name {
+				return true
+			}
+		}
+		return false
+	}
+	names := make([]K, 0, len(cfg.bb)+len(pending))
+	for n := range cfg.bb {
+		names = append(names, n)
+	}
+	names = append(names, pending...)
+
+	var name K
+	v := reflect.ValueOf(&name).Elem()
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		low := int64(0)
+		for _, n := range names {
+			low = min(low, reflect.ValueOf(n).Int())
+		}
+		if low > math.MinInt64 && !v.OverflowInt(low-1) {
+			v.SetInt(low - 1)
+			return name
+		}
+		for c := int64(-1); !v.OverflowInt(c); c-- {
+			if v.SetInt(c); !taken(name) {
+				return name
+			}
+			if c == math.MinInt64 {
+				break
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var high uint64
+		for _, n := range names {
+			high = max(high, reflect.ValueOf(n).Uint())
+		}
+		if len(names) == 0 {
+			return name
+		}
+		if high < math.MaxUint64 && !v.OverflowUint(high+1) {
+			v.SetUint(high + 1)
+			return name
+		}
+		for c := uint64(0); !v.OverflowUint(c); c++ {
+			if v.SetUint(c); !taken(name) {
+				return name
+			}
+			if c == math.MaxUint64 {
+				break
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		low := 0.0
+		for _, n := range names {
+			if f := reflect.ValueOf(n).Float(); f < low {
+				low = f
+			}
+		}
+		if v.SetFloat(math.Floor(low) - 1); !math.IsInf(v.Float(), 0) && !taken(name) {
+			return name
+		}
+		for c := -1.0; c >= -float64(len(names)+1); c-- {
+			if v.SetFloat(c); !taken(name) {
+				return name
+			}
+		}
+	case reflect.String:
+		v.SetString("virtual-entry")
+		for i := 2; taken(name); i++ {
+			v.SetString(fmt.Sprintf("virtual-entry-%d", i))
+		}
+		return name
+	default:
+		panic(fmt.Sprintf("cfg: cannot invent a %v block name, use SetEntriesNamed", v.Type()))
+	}
+	panic(fmt.Sprintf("cfg: no %v block name left for a virtual entry", v.Type()))
+}
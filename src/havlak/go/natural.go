@@ -0,0 +1,194 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//======================================================
+// Natural Loops
+//======================================================
+
+// The natural loop of a back edge s -> h, one whose target dominates
+// its source, is 'h' and the blocks that reach 's' without passing
+// through 'h', as the Dragon Book has it. Loops with the same header
+// are merged, and two natural loops are then either disjoint or one
+// is nested in the other. Every block of a natural loop is dominated
+// by its header, so the loops are all reducible, and a cycle without
+// a block dominating the others is in none.
+//
+// On a reducible graph every cycle has such a block, the back edges
+// are exactly the edges to a DFS ancestor, and the natural loops are
+// the loops the Havlak loop finder reports, which makes them an
+// oracle for it; Compare reports where two finders disagree.
+
+package loopforest
+
+import "errors"
+import "fmt"
+import "./basicblock"
+import "./lsg"
+import "./dominators"
+
+// Natural finds the natural loops of the dominator tree.
+//
+type Natural[K comparable] struct{}
+
+func (Natural[K]) Name() string {
+	return "natural"
+}
+
+// Headers are taken in reverse preorder of the dominator tree, so
+// that nested loops come first; the walk back from the back edges
+// skips from a block to the header of the largest loop found so far
+// that contains it, as Havlak's does.
+//
+func (Natural[K]) FindLoops(cfgraph *cfg.CFG[K], lsgraph *lsg.LSG[K]) {
+	tree := dominators.Compute(cfgraph)
+	if tree.Root() == nil {
+		return
+	}
+	loopOf := make(map[*cfg.BasicBlock[K]]*lsg.SimpleLoop[K])
+	rep := make(map[*cfg.BasicBlock[K]]*cfg.BasicBlock[K])
+	find := func(bb *cfg.BasicBlock[K]) *cfg.BasicBlock[K] {
+		root := bb
+		for rep[root] != nil {
+			root = rep[root]
+		}
+		for bb != root {
+			bb, rep[bb] = rep[bb], root
+		}
+		return root
+	}
+
+	blocks := tree.Blocks()
+	for i := len(blocks) - 1; i >= 0; i-- {
+		h := blocks[i]
+		self := false
+		var pool, work []*cfg.BasicBlock[K]
+		inPool := make(map[*cfg.BasicBlock[K]]bool)
+		for ll := h.InEdges().Front(); ll != nil; ll = ll.Next() {
+			s := ll.Value.(*cfg.BasicBlockEdge[K]).Src()
+			switch {
+			case s == h:
+				self = true
+			case tree.Reachable(s) && tree.Dominates(h, s):
+				if x := find(s); !inPool[x] {
+					inPool[x] = true
+					pool = append(pool, x)
+					work = append(work, x)
+				}
+			}
+		}
+		if len(pool) == 0 && !self {
+			continue
+		}
+		for len(work) > 0 {
+			x := work[len(work)-1]
+			work = work[:len(work)-1]
+			for ll := x.InEdges().Front(); ll != nil; ll = ll.Next() {
+				p := ll.Value.(*cfg.BasicBlockEdge[K]).Src()
+				if !tree.Reachable(p) {
+					continue
+				}
+				if y := find(p); y != h && !inPool[y] {
+					inPool[y] = true
+					pool = append(pool, y)
+					work = append(work, y)
+				}
+			}
+		}
+
+		loop := lsgraph.NewLoop()
+		loop.SetHeader(h)
+		loop.SetIsReducible(true)
+		for _, x := range pool {
+			if inner := loopOf[x]; inner != nil {
+				inner.SetParent(loop)
+			} else {
+				loop.AddNode(x)
+			}
+			rep[x] = h
+		}
+		loopOf[h] = loop
+		lsgraph.AddLoop(loop)
+	}
+}
+
+// Compare runs two finders on 'cfgraph' and reports every loop on
+// which they disagree: a header has a loop in one forest only, or
+// the two loops have different blocks, nested loops aside, different
+// parents or different reducibility.
+//
+func Compare[K comparable](cfgraph *cfg.CFG[K], a, b LoopFinder[K]) error {
+	var errs []error
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	byHeader := func(f LoopFinder[K]) map[*cfg.BasicBlock[K]]*lsg.SimpleLoop[K] {
+		lsgraph := lsg.NewLSGOf[K]()
+		f.FindLoops(cfgraph, lsgraph)
+		loops := make(map[*cfg.BasicBlock[K]]*lsg.SimpleLoop[K])
+		for _, loop := range lsgraph.Loops() {
+			if loops[loop.Header()] != nil {
+				report("%s: two loops with header %v", f.Name(), loop.Header())
+			}
+			loops[loop.Header()] = loop
+		}
+		return loops
+	}
+	parent := func(loop *lsg.SimpleLoop[K]) string {
+		if p := loop.Parent(); p != nil && p.Header() != nil {
+			return fmt.Sprint(p.Header())
+		}
+		return "none"
+	}
+
+	loopsA, loopsB := byHeader(a), byHeader(b)
+	for _, h := range cfgraph.Blocks() {
+		x, y := loopsA[h], loopsB[h]
+		switch {
+		case x == nil && y == nil:
+			continue
+		case y == nil:
+			report("loop %v: found by %s only", h, a.Name())
+			continue
+		case x == nil:
+			report("loop %v: found by %s only", h, b.Name())
+			continue
+		}
+		same := len(x.BasicBlocks()) == len(y.BasicBlocks())
+		for bb := range x.BasicBlocks() {
+			same = same && y.BasicBlocks()[bb]
+		}
+		if !same {
+			report("loop %v: blocks %s in %s, %s in %s", h,
+				blockList(x.BasicBlocks()), a.Name(), blockList(y.BasicBlocks()), b.Name())
+		}
+		if parent(x) != parent(y) {
+			report("loop %v: parent %s in %s, %s in %s", h, parent(x), a.Name(), parent(y), b.Name())
+		}
+		if x.IsReducible() != y.IsReducible() {
+			report("loop %v: reducible %v in %s, %v in %s", h,
+				x.IsReducible(), a.Name(), y.IsReducible(), b.Name())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func blockList[K comparable](blocks map[*cfg.BasicBlock[K]]bool) string {
+	sorted := make([]*cfg.BasicBlock[K], 0, len(blocks))
+	for bb := range blocks {
+		sorted = append(sorted, bb)
+	}
+	cfg.SortBlocks(sorted)
+	return fmt.Sprint(sorted)
+}
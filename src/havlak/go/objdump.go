@@ -0,0 +1,437 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Control flow graphs from x86-64 machine code, as disassembled by
+// GNU objdump -d.
+//
+// This is where the algorithm started: MAO (cpp/mao-loops.h) finds
+// loops in x86 assembly. Read takes the text objdump prints, in
+// AT&T or Intel syntax, with or without raw instruction bytes:
+//
+//    0000000000001139 <sum>:
+//        1139:  85 f6          test   %esi,%esi
+//        113b:  7e 41          jle    117e <sum+0x45>
+//        ...
+//
+// Every symbol line starts a function, which runs up to the next
+// symbol or section. A function is split into basic blocks at its
+// start, at the target of every jump that stays inside it, and after
+// every jump, return and call to a function that does not return.
+// Blocks are named by the address of their first instruction. The
+// edges are:
+//
+//    jcc target      target taken, next instruction fallthrough
+//    jmp target      target fallthrough
+//    ret, ud2        no successors
+//    call f          f does not return: no successors
+//                    otherwise the call is an ordinary instruction
+//
+// A jump to an address outside the function is a tail call and
+// has no edge. An indirect jump ("jmp *%rax", "jmp rax") has no
+// edge either; its address is listed in Unresolved, since the CFG
+// of such a function, typically a switch through a jump table, is
+// incomplete. A function that has no instruction at its symbol's
+// address, or that jumps into the middle of one of its instructions,
+// as overlapping code and data in text sections do, has no basic
+// blocks: it is returned without a CFG and with Err set, and the
+// other functions are read as usual.
+//
+package objdump
+
+import "fmt"
+import "io"
+import "strconv"
+import "strings"
+import "./basicblock"
+
+// Function is the CFG of one symbol.
+//
+type Function struct {
+	Name    string
+	Section string // without the leading '.', e.g. "text"
+	Addr    uint64
+	Line    int // of the symbol
+	CFG     *cfg.CFG[uint64]
+
+	// Unresolved holds the addresses of indirect jumps, whose
+	// targets are unknown. TailCalls holds the addresses of jumps
+	// that leave the function.
+	Unresolved []uint64
+	TailCalls  []uint64
+
+	// Err is why the function has no CFG, or nil.
+	Err error
+}
+
+// NoReturn names the functions after whose calls control does not
+// continue. Calls through the PLT ("abort@plt") match too.
+//
+var NoReturn = map[string]bool{
+	"abort": true, "exit": true, "_exit": true, "_Exit": true,
+	"quick_exit": true, "__stack_chk_fail": true, "__assert_fail": true,
+	"__fortify_chk_fail": true, "__chk_fail": true, "err": true,
+	"errx": true, "verr": true, "verrx": true, "longjmp": true,
+	"siglongjmp": true, "__longjmp_chk": true, "pthread_exit": true,
+	"__cxa_throw": true, "__cxa_rethrow": true, "_Unwind_Resume": true,
+	"__cxa_bad_cast": true, "__cxa_bad_typeid": true,
+	"_ZSt9terminatev": true, "__cxa_call_unexpected": true,
+}
+
+// Read parses objdump output with cfg.DefaultLimits, applying
+// MaxBlocks and MaxEdges to each function.
+//
+func Read(r io.Reader) ([]*Function, error) {
+	return ReadLimits(r, cfg.DefaultLimits)
+}
+
+// ReadLimits parses objdump output, failing as soon as the input
+// exceeds 'limits'.
+//
+func ReadLimits(r io.Reader, limits cfg.Limits) ([]*Function, error) {
+	p := &parser{limits: limits}
+	scanner := cfg.NewLineScanner(r, limits)
+	for scanner.Scan() {
+		p.lineno++
+		if err := p.line(scanner.Text()); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, &cfg.SyntaxError{Line: p.lineno + 1, Msg: err.Error()}
+	}
+	if err := p.finish(); err != nil {
+		return nil, err
+	}
+	return p.fns, nil
+}
+
+//-----------------------------------------------------------
+
+type flow int
+
+const (
+	flowNext     flow = iota // continues with the next instruction
+	flowCond                 // conditional jump
+	flowJump                 // unconditional jump
+	flowStop                 // return, trap, call that does not return
+	flowIndirect             // jump to a computed address
+)
+
+type instruction struct {
+	addr   uint64
+	line   int
+	flow   flow
+	target uint64 // of a direct jump
+}
+
+type parser struct {
+	limits  cfg.Limits
+	lineno  int
+	section string
+	fns     []*Function
+
+	fn    *Function // being parsed, nil outside a function
+	insns []instruction
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &cfg.SyntaxError{Line: p.lineno, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) line(text string) error {
+	if strings.HasPrefix(text, "Disassembly of section ") {
+		if err := p.finish(); err != nil {
+			return err
+		}
+		p.section = strings.TrimSuffix(strings.TrimPrefix(text, "Disassembly of section ."), ":")
+		return nil
+	}
+	if addr, name, ok := symbol(text); ok {
+		if err := p.finish(); err != nil {
+			return err
+		}
+		p.fn = &Function{Name: name, Section: p.section, Addr: addr, Line: p.lineno}
+		return nil
+	}
+	if p.fn == nil {
+		return nil
+	}
+	insn, ok := p.instruction(text)
+	if ok {
+		p.insns = append(p.insns, insn)
+	}
+	return nil
+}
+
+// symbol recognizes "0000000000001139 <sum>:".
+//
+func symbol(text string) (uint64, string, bool) {
+	sp := strings.IndexByte(text, ' ')
+	if sp <= 0 || !strings.HasPrefix(text[sp:], " <") || !strings.HasSuffix(text, ">:") {
+		return 0, "", false
+	}
+	addr, err := strconv.ParseUint(text[:sp], 16, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return addr, text[sp+2 : len(text)-2], true
+}
+
+// instruction parses "  113b:\t7e 41\tjle    117e <sum+0x45>". Lines
+// that hold only the rest of a long instruction's bytes, source
+// lines interleaved by -S, and anything else are skipped.
+//
+func (p *parser) instruction(text string) (instruction, bool) {
+	insn := instruction{line: p.lineno}
+	text = strings.TrimLeft(text, " ")
+	colon := strings.IndexByte(text, ':')
+	if colon <= 0 || colon+1 >= len(text) || text[colon+1] != '\t' {
+		return insn, false
+	}
+	addr, err := strconv.ParseUint(text[:colon], 16, 64)
+	if err != nil {
+		return insn, false
+	}
+	insn.addr = addr
+
+	fields := strings.Split(text[colon+2:], "\t")
+	if len(fields) > 1 || isBytes(fields[0]) {
+		fields = fields[1:]
+	}
+	asm := strings.Join(fields, " ")
+	if i := strings.IndexByte(asm, '#'); i >= 0 {
+		asm = asm[:i]
+	}
+	toks := strings.Fields(asm)
+	for len(toks) > 0 && isPrefix(toks[0]) {
+		toks = toks[1:]
+	}
+	if len(toks) == 0 {
+		return insn, false
+	}
+
+	op := toks[0]
+	if i := strings.IndexByte(op, ','); i >= 0 {
+		op = op[:i] // branch hints: "je,pt"
+	}
+	operand := strings.Join(toks[1:], " ")
+	switch {
+	case isReturn(op):
+		insn.flow = flowStop
+	case op == "jmp" || op == "jmpq" || op == "ljmp":
+		insn.flow = flowJump
+		if target, _, ok := directTarget(operand); ok {
+			insn.target = target
+		} else {
+			insn.flow = flowIndirect
+		}
+	case isConditional(op):
+		if target, _, ok := directTarget(operand); ok {
+			insn.flow, insn.target = flowCond, target
+		}
+	case op == "call" || op == "callq":
+		if _, name, ok := directTarget(operand); ok && NoReturn[strings.TrimSuffix(name, "@plt")] {
+			insn.flow = flowStop
+		}
+	}
+	return insn, true
+}
+
+// isBytes tells whether a field is raw instruction bytes, "7e 41".
+//
+func isBytes(field string) bool {
+	field = strings.TrimSpace(field)
+	if field == "" {
+		return true
+	}
+	for _, b := range strings.Split(field, " ") {
+		if len(b) != 2 {
+			return false
+		}
+		if _, err := strconv.ParseUint(b, 16, 8); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+var prefixes = map[string]bool{
+	"bnd": true, "notrack": true, "lock": true, "rep": true, "repz": true,
+	"repe": true, "repnz": true, "repne": true, "data16": true,
+	"data32": true, "addr32": true, "cs": true, "ds": true, "es": true,
+	"fs": true, "gs": true, "ss": true,
+}
+
+func isPrefix(tok string) bool {
+	return prefixes[tok] || strings.HasPrefix(tok, "rex")
+}
+
+func isReturn(op string) bool {
+	switch op {
+	case "ret", "retq", "retl", "retw", "lret", "lretq", "lretl",
+		"iret", "iretq", "iretl", "iretd", "iretw", "sysret", "sysretq",
+		"sysretl", "sysexit", "sysexitq", "ud2":
+		return true
+	}
+	return false
+}
+
+// isConditional accepts the Jcc family, jcxz and its relatives,
+// and the loop instructions.
+//
+func isConditional(op string) bool {
+	switch op {
+	case "jcxz", "jecxz", "jrcxz", "loop", "loope", "loopz", "loopne", "loopnz",
+		"loopq", "loopl", "loopeq", "loopel", "loopneq", "loopnel":
+		return true
+	}
+	cond := strings.TrimPrefix(op, "j")
+	if cond == op {
+		return false
+	}
+	switch strings.TrimPrefix(cond, "n") {
+	case "o", "b", "c", "ae", "e", "z", "be", "a", "s", "p", "pe", "po",
+		"l", "ge", "le", "g":
+		return true
+	}
+	return false
+}
+
+// directTarget parses the operand of a direct jump or call,
+// "117e <sum+0x45>", into its address and symbol.
+//
+func directTarget(operand string) (uint64, string, bool) {
+	addr, sym, _ := strings.Cut(operand, " ")
+	target, err := strconv.ParseUint(addr, 16, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	sym = strings.TrimSuffix(strings.TrimPrefix(sym, "<"), ">")
+	return target, sym, true
+}
+
+// finish splits the instructions of the current function into
+// blocks and builds its CFG.
+//
+func (p *parser) finish() error {
+	fn, insns := p.fn, p.insns
+	p.fn, p.insns = nil, nil
+	if fn == nil {
+		return nil
+	}
+	if len(insns) == 0 {
+		// A data symbol, or a label with nothing after it.
+		return nil
+	}
+
+	index := make(map[uint64]int, len(insns))
+	for i, insn := range insns {
+		index[insn.addr] = i
+	}
+	if _, ok := index[fn.Addr]; !ok {
+		return p.skip(fn, fn.Line, "no instruction at the start of <%s>", fn.Name)
+	}
+
+	// Find the leaders.
+	leader := make([]bool, len(insns))
+	leader[index[fn.Addr]] = true
+	for i, insn := range insns {
+		if insn.flow == flowNext {
+			continue
+		}
+		if i+1 < len(insns) {
+			leader[i+1] = true
+		}
+		if insn.flow != flowCond && insn.flow != flowJump {
+			continue
+		}
+		if t, ok := index[insn.target]; ok {
+			leader[t] = true
+		} else if insn.target >= insns[0].addr && insn.target <= insns[len(insns)-1].addr {
+			return p.skip(fn, insn.line, "jump into the middle of an instruction at %#x", insn.target)
+		}
+	}
+
+	g := cfg.NewCFGOf[uint64]()
+	for i, insn := range insns {
+		if !leader[i] {
+			continue
+		}
+		if p.limits.MaxBlocks > 0 && g.NumNodes() >= p.limits.MaxBlocks {
+			p.lineno = insn.line
+			return p.errorf("more than %d blocks in <%s>", p.limits.MaxBlocks, fn.Name)
+		}
+		g.CreateNode(insn.addr)
+	}
+
+	numEdges := 0
+	var block uint64
+	for i, insn := range insns {
+		if leader[i] {
+			block = insn.addr
+		}
+		last := i+1 == len(insns) || leader[i+1]
+		if !last {
+			continue
+		}
+
+		edge := func(to uint64, kind cfg.EdgeKind) error {
+			numEdges++
+			if p.limits.MaxEdges > 0 && numEdges > p.limits.MaxEdges {
+				p.lineno = insn.line
+				return p.errorf("more than %d edges in <%s>", p.limits.MaxEdges, fn.Name)
+			}
+			cfg.NewBasicBlockEdgeOfKind(g, block, to, kind)
+			return nil
+		}
+		var err error
+		switch insn.flow {
+		case flowCond, flowJump:
+			kind := cfg.EdgeFallthrough
+			if insn.flow == flowCond {
+				kind = cfg.EdgeTaken
+			}
+			if _, ok := index[insn.target]; ok {
+				err = edge(insn.target, kind)
+			} else {
+				fn.TailCalls = append(fn.TailCalls, insn.addr)
+			}
+			if err == nil && insn.flow == flowCond && i+1 < len(insns) {
+				err = edge(insns[i+1].addr, cfg.EdgeFallthrough)
+			}
+		case flowIndirect:
+			fn.Unresolved = append(fn.Unresolved, insn.addr)
+		case flowNext:
+			if i+1 < len(insns) {
+				err = edge(insns[i+1].addr, cfg.EdgeFallthrough)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	g.SetStart(fn.Addr)
+
+	fn.CFG = g
+	p.fns = append(p.fns, fn)
+	return nil
+}
+
+// skip adds 'fn' without a CFG, with the error at 'line' as its Err.
+//
+func (p *parser) skip(fn *Function, line int, format string, args ...interface{}) error {
+	fn.Err = &cfg.SyntaxError{Line: line, Msg: fmt.Sprintf(format, args...)}
+	p.fns = append(p.fns, fn)
+	return nil
+}
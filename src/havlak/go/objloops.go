@@ -0,0 +1,102 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Loop nests of machine code.
+//
+// Usage: objloops [-cfg] file ...
+//
+// Reads the output of 'objdump -d' (or standard input, for "-"),
+// builds the CFG of every function, runs the Havlak loop finder on
+// it and prints the loop tree with blocks named by address. Indirect
+// jumps and tail calls are listed, since the loops they may close
+// are missed. Functions without a CFG are listed with the reason.
+// With -cfg, the CFG is printed first, in the edge-list format.
+//
+// The fixtures in testdata/objdump are checked with
+// 'make check-objdump'.
+//
+package main
+
+import "flag"
+import "fmt"
+import "os"
+import "./lsg"
+import "./havlakloopfinder"
+import "./objdump"
+
+var printCFG = flag.Bool("cfg", false, "print the CFG of every function")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: objloops [-cfg] file ...\n")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		f := os.Stdin
+		if path != "-" {
+			var err error
+			if f, err = os.Open(path); err != nil {
+				fmt.Fprintf(os.Stderr, "objloops: %v\n", err)
+				status = 1
+				continue
+			}
+		}
+		fns, err := objdump.Read(f)
+		if f != os.Stdin {
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "objloops: %s: %v\n", path, err)
+			status = 1
+			continue
+		}
+
+		for _, fn := range fns {
+			if fn.Err != nil {
+				fmt.Printf("<%s> %#x: no CFG: %v\n", fn.Name, fn.Addr, fn.Err)
+				continue
+			}
+			lsgraph := lsg.NewLSGOf[uint64]()
+			havlakloopfinder.FindHavlakLoops(fn.CFG, lsgraph)
+			lsgraph.CalculateNestingLevel()
+
+			numEdges := 0
+			for _, bb := range fn.CFG.Blocks() {
+				numEdges += bb.NumSucc()
+			}
+			fmt.Printf("<%s> %#x: %d blocks, %d edges, %d loops\n",
+				fn.Name, fn.Addr, fn.CFG.NumNodes(), numEdges, lsgraph.NumLoops())
+			for _, addr := range fn.Unresolved {
+				fmt.Printf("unresolved jump at %#x\n", addr)
+			}
+			for _, addr := range fn.TailCalls {
+				fmt.Printf("tail call at %#x\n", addr)
+			}
+			if *printCFG {
+				if err := fn.CFG.WriteEdgeList(os.Stdout); err != nil {
+					fmt.Fprintf(os.Stderr, "objloops: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if err := lsgraph.WriteNest(os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "objloops: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+	os.Exit(status)
+}
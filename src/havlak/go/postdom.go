@@ -0,0 +1,203 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//======================================================
+// Post-Dominators
+//======================================================
+
+// Block 'a' post-dominates block 'b' if every path from 'b' to the
+// exit goes through 'a'. A CFG has no exit block of its own, so the
+// post-dominators are the dominators of the reverse graph started
+// from the blocks that end the function:
+//
+//    - the blocks without successors, and
+//    - the header of every loop the Havlak loop finder reports that
+//      none of these can be reached from, outermost loops first.
+//
+// The second rule gives the blocks of an infinite loop a place in
+// the tree, as if the loop header could also leave the function.
+// With several such blocks, the reverse graph gets a virtual entry,
+// as CFG.SetEntries makes one, which stands for a synthetic exit
+// joining them. Blocks that reach none of them, which can only be
+// infinite loops no path from the start node enters, are not in the
+// tree.
+
+package dominators
+
+import "io"
+import "./basicblock"
+import "./lsg"
+import "./havlakloopfinder"
+
+// PostTree is the post-dominator tree of a CFG. Its methods take
+// and return blocks of the CFG it was computed for.
+//
+type PostTree[K comparable] struct {
+	tree     *Tree[K]
+	reverse  *cfg.CFG[K]
+	forward  map[*cfg.BasicBlock[K]]*cfg.BasicBlock[K] // reverse to forward
+	backward map[*cfg.BasicBlock[K]]*cfg.BasicBlock[K] // forward to reverse
+	exits    []*cfg.BasicBlock[K]
+	loops    map[*cfg.BasicBlock[K]]bool // exits that head infinite loops
+}
+
+// ComputePost builds the post-dominator tree of 'cfgraph'.
+//
+func ComputePost[K comparable](cfgraph *cfg.CFG[K]) *PostTree[K] {
+	p := &PostTree[K]{
+		reverse:  cfg.NewCFGOf[K](),
+		forward:  make(map[*cfg.BasicBlock[K]]*cfg.BasicBlock[K]),
+		backward: make(map[*cfg.BasicBlock[K]]*cfg.BasicBlock[K]),
+		loops:    make(map[*cfg.BasicBlock[K]]bool),
+	}
+	blocks := cfgraph.Blocks()
+	for _, bb := range blocks {
+		rb := p.reverse.CreateNode(bb.Name())
+		p.forward[rb] = bb
+		p.backward[bb] = rb
+	}
+	for _, bb := range blocks {
+		for ll := bb.InEdges().Front(); ll != nil; ll = ll.Next() {
+			edge := ll.Value.(*cfg.BasicBlockEdge[K])
+			cfg.NewBasicBlockEdgeOfKind(p.reverse, bb.Name(), edge.Src().Name(), edge.Kind()).SetLabel(edge.Label())
+		}
+	}
+
+	// The exits, and the blocks from which one is reached.
+	//
+	reaches := make(map[*cfg.BasicBlock[K]]bool)
+	var stack []*cfg.BasicBlock[K]
+	addExit := func(bb *cfg.BasicBlock[K]) {
+		p.exits = append(p.exits, bb)
+		reaches[bb] = true
+		for stack = append(stack[:0], bb); len(stack) > 0; {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for ll := top.InEdges().Front(); ll != nil; ll = ll.Next() {
+				if src := ll.Value.(*cfg.BasicBlockEdge[K]).Src(); !reaches[src] {
+					reaches[src] = true
+					stack = append(stack, src)
+				}
+			}
+		}
+	}
+	for _, bb := range blocks {
+		if bb.NumSucc() == 0 {
+			addExit(bb)
+		}
+	}
+	if len(reaches) < len(blocks) {
+		// Havlak adds inner loops before the loops around them.
+		lsgraph := lsg.NewLSGOf[K]()
+		havlakloopfinder.FindLoops(cfgraph, lsgraph)
+		loops := lsgraph.Loops()
+		for i := len(loops) - 1; i >= 0; i-- {
+			if header := loops[i].Header(); !reaches[header] {
+				p.loops[header] = true
+				addExit(header)
+			}
+		}
+	}
+
+	if len(p.exits) > 0 {
+		names := make([]K, len(p.exits))
+		for i, bb := range p.exits {
+			names[i] = bb.Name()
+		}
+		p.reverse.SetEntries(names...)
+	}
+	p.tree = Compute(p.reverse)
+	return p
+}
+
+// Reverse returns the reverse graph the tree was computed on. Its
+// start node is the exit, or the synthetic exit joining several.
+//
+func (p *PostTree[K]) Reverse() *cfg.CFG[K] {
+	return p.reverse
+}
+
+// Tree returns the dominator tree of the reverse graph.
+//
+func (p *PostTree[K]) Tree() *Tree[K] {
+	return p.tree
+}
+
+// Exits returns the blocks joined to the exit: those without
+// successors in Blocks order, then the infinite loop headers.
+//
+func (p *PostTree[K]) Exits() []*cfg.BasicBlock[K] {
+	return p.exits
+}
+
+// IsLoopExit reports whether 'bb' was joined to the exit as the
+// header of an infinite loop.
+//
+func (p *PostTree[K]) IsLoopExit(bb *cfg.BasicBlock[K]) bool {
+	return p.loops[bb]
+}
+
+// Reachable reports whether 'bb' is in the tree, that is, whether
+// an exit can be reached from it.
+//
+func (p *PostTree[K]) Reachable(bb *cfg.BasicBlock[K]) bool {
+	return p.tree.Reachable(p.backward[bb])
+}
+
+// Ipdom returns the immediate post-dominator of 'bb', or nil if it is
+// the synthetic exit, or 'bb' is the root or not in the tree.
+//
+func (p *PostTree[K]) Ipdom(bb *cfg.BasicBlock[K]) *cfg.BasicBlock[K] {
+	return p.forward[p.tree.Idom(p.backward[bb])]
+}
+
+// Children returns the blocks 'bb' immediately post-dominates.
+//
+func (p *PostTree[K]) Children(bb *cfg.BasicBlock[K]) []*cfg.BasicBlock[K] {
+	children := p.tree.Children(p.backward[bb])
+	for i, c := range children {
+		children[i] = p.forward[c]
+	}
+	return children
+}
+
+// PostDominates reports whether 'a' post-dominates 'b'. Every block
+// in the tree post-dominates itself.
+//
+func (p *PostTree[K]) PostDominates(a, b *cfg.BasicBlock[K]) bool {
+	return p.tree.Dominates(p.backward[a], p.backward[b])
+}
+
+// WriteTree prints the tree as Tree.WriteTree does. The synthetic
+// exit is written as "exit" and infinite loop headers are marked:
+//
+//    exit
+//      7
+//        6
+//      3 (infinite loop)
+//
+// Blocks from which no exit is reached are listed last, as
+// "no exit 8 9".
+//
+func (p *PostTree[K]) WriteTree(w io.Writer) error {
+	return p.tree.writeTree(w, p.reverse, "no exit", func(rb *cfg.BasicBlock[K]) string {
+		switch {
+		case rb == p.reverse.VirtualEntry():
+			return "exit"
+		case p.loops[p.forward[rb]]:
+			return cfg.BlockName(rb) + " (infinite loop)"
+		}
+		return cfg.BlockName(rb)
+	})
+}
@@ -0,0 +1,174 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//======================================================
+// Execution Profiles
+//======================================================
+
+// Block counts and edge weights for a CFG are read from a plain
+// text profile, one record per line:
+//
+//    # comment
+//    block <name> <count>
+//    edge  <from> <to> <weight>
+//
+// Blank lines and everything after a '#' are ignored. If there are
+// parallel edges between two blocks, successive 'edge' records for
+// that pair are applied to them in successor order. Block names are
+// written as FormatName prints them.
+
+package cfg
+
+import "bufio"
+import "errors"
+import "fmt"
+import "io"
+import "strconv"
+import "strings"
+
+// LoadProfile reads a profile and stores its counts and weights in
+// the blocks and edges of 'cfg'. Every block and edge mentioned must
+// already exist. Nothing is changed unless the whole profile is valid.
+//
+func LoadProfile[K comparable](cfg *CFG[K], r io.Reader) error {
+	type pair struct{ from, to *BasicBlock[K] }
+	seen := make(map[pair]int)
+	counts := make(map[*BasicBlock[K]]int64)
+	weights := make(map[*BasicBlockEdge[K]]int64)
+
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		block := func(field string) (*BasicBlock[K], error) {
+			name, err := ParseName[K](field)
+			if err != nil {
+				return nil, fmt.Errorf("profile:%d: %v", lineno, err)
+			}
+			bb := cfg.bb[name]
+			if bb == nil {
+				return nil, fmt.Errorf("profile:%d: no block %s", lineno, field)
+			}
+			return bb, nil
+		}
+		number := func(field string) (int64, error) {
+			n, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("profile:%d: bad number %q", lineno, field)
+			}
+			return n, nil
+		}
+
+		switch {
+		case fields[0] == "block" && len(fields) == 3:
+			bb, err := block(fields[1])
+			if err != nil {
+				return err
+			}
+			if counts[bb], err = number(fields[2]); err != nil {
+				return err
+			}
+
+		case fields[0] == "edge" && len(fields) == 4:
+			from, err := block(fields[1])
+			if err != nil {
+				return err
+			}
+			to, err := block(fields[2])
+			if err != nil {
+				return err
+			}
+			key := pair{from, to}
+			edge := nthOutEdge(from, to, seen[key])
+			if edge == nil {
+				return fmt.Errorf("profile:%d: no edge %s -> %s", lineno, fields[1], fields[2])
+			}
+			seen[key]++
+			if weights[edge], err = number(fields[3]); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("profile:%d: malformed record %q", lineno, strings.TrimSpace(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for bb, count := range counts {
+		bb.SetCount(count)
+	}
+	for edge, weight := range weights {
+		edge.SetWeight(weight)
+	}
+	return nil
+}
+
+func nthOutEdge[K comparable](from, to *BasicBlock[K], n int) *BasicBlockEdge[K] {
+	for iter := from.OutEdges().Front(); iter != nil; iter = iter.Next() {
+		if edge := iter.Value.(*BasicBlockEdge[K]); edge.Dst() == to {
+			if n == 0 {
+				return edge
+			}
+			n--
+		}
+	}
+	return nil
+}
+
+// CheckFlowConservation verifies that, at every block, the weights
+// of the incoming edges and of the outgoing edges each add up to the
+// block's count.
+//
+// Flow enters a function at its entries and leaves it at blocks
+// without successors, so the incoming side is not checked for entry
+// blocks and blocks without predecessors, and the outgoing side is
+// not checked for blocks without successors. All violations are
+// reported, in block name order.
+//
+func (cfg *CFG[K]) CheckFlowConservation() error {
+	entries := make(map[*BasicBlock[K]]bool)
+	for _, bb := range cfg.Entries() {
+		entries[bb] = true
+	}
+
+	var errs []error
+	for _, bb := range cfg.Blocks() {
+		var in, out int64
+		for iter := bb.InEdges().Front(); iter != nil; iter = iter.Next() {
+			in += iter.Value.(*BasicBlockEdge[K]).Weight()
+		}
+		for iter := bb.OutEdges().Front(); iter != nil; iter = iter.Next() {
+			out += iter.Value.(*BasicBlockEdge[K]).Weight()
+		}
+
+		if bb.NumPred() > 0 && !entries[bb] && in != bb.Count() {
+			errs = append(errs, fmt.Errorf("%v: count %d, incoming weight %d",
+				bb, bb.Count(), in))
+		}
+		if bb.NumSucc() > 0 && out != bb.Count() {
+			errs = append(errs, fmt.Errorf("%v: count %d, outgoing weight %d",
+				bb, bb.Count(), out))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,117 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Loop nests of functions exported from radare2.
+//
+// Usage: r2loops [-cfg | -irreducible] file.json ...
+//
+// Reads the JSON of 'agfj' or 'afbj' (or standard input, for "-"),
+// builds the CFG of every function, runs the Havlak loop finder on
+// it and prints the loop tree with blocks named by address. Jumps
+// out of a function are listed, since the loops they may close are
+// missed. With -cfg, the CFG is printed first, in the edge-list
+// format.
+//
+// With -irreducible, only the functions with irreducible loops are
+// listed, one line each; run on the graphs of a whole binary,
+//
+//    r2 -qc 'aaa; agfj @@F' prog > prog.json
+//    r2loops -irreducible prog.json
+//
+// it points at obfuscated or hand-written code.
+//
+// The fixtures in testdata/r2 are checked with 'make check-r2'.
+//
+package main
+
+import "flag"
+import "fmt"
+import "os"
+import "./lsg"
+import "./havlakloopfinder"
+import "./radare"
+
+var printCFG = flag.Bool("cfg", false, "print the CFG of every function")
+var irreducible = flag.Bool("irreducible", false, "list only the functions with irreducible loops")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 || *printCFG && *irreducible {
+		fmt.Fprintf(os.Stderr, "usage: r2loops [-cfg | -irreducible] file.json ...\n")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		f := os.Stdin
+		if path != "-" {
+			var err error
+			if f, err = os.Open(path); err != nil {
+				fmt.Fprintf(os.Stderr, "r2loops: %v\n", err)
+				status = 1
+				continue
+			}
+		}
+		fns, err := radare.Read(f)
+		if f != os.Stdin {
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "r2loops: %s: %v\n", path, err)
+			status = 1
+			continue
+		}
+
+		for _, fn := range fns {
+			lsgraph := lsg.NewLSGOf[uint64]()
+			havlakloopfinder.FindHavlakLoops(fn.CFG, lsgraph)
+			lsgraph.CalculateNestingLevel()
+
+			if *irreducible {
+				n := 0
+				for _, loop := range lsgraph.Loops() {
+					if !loop.IsReducible() {
+						n++
+					}
+				}
+				if n > 0 {
+					fmt.Printf("%s %#x: %d of %d loops irreducible\n",
+						fn.Name, fn.Addr, n, lsgraph.NumLoops())
+				}
+				continue
+			}
+
+			numEdges := 0
+			for _, bb := range fn.CFG.Blocks() {
+				numEdges += bb.NumSucc()
+			}
+			fmt.Printf("%s %#x: %d blocks, %d edges, %d loops\n",
+				fn.Name, fn.Addr, fn.CFG.NumNodes(), numEdges, lsgraph.NumLoops())
+			for _, addr := range fn.External {
+				fmt.Printf("jump out to %#x\n", addr)
+			}
+			if *printCFG {
+				if err := fn.CFG.WriteEdgeList(os.Stdout); err != nil {
+					fmt.Fprintf(os.Stderr, "r2loops: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if err := lsgraph.WriteNest(os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "r2loops: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+	os.Exit(status)
+}
@@ -0,0 +1,283 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Control flow graphs from radare2's JSON function graphs.
+//
+// Read takes what 'agfj' or 'afbj' print, and any number of them
+// one after the other, as 'agfj @@F' prints the graphs of all the
+// functions of a binary. agfj gives an array of functions, each with
+// its name, address and "blocks"; afbj gives the bare array of
+// blocks of one function, which is named fcn.<address> after its
+// lowest block, as radare2 names functions it knows nothing about.
+// Blocks and addresses are read under either key radare2 has used
+// for them, "addr" or "offset", and switches under "switch_op" or
+// "switchop".
+//
+// Blocks are named by address. The edges of a block are:
+//
+//    "jump" with "fail"               jump taken, fail fallthrough
+//    "jump" alone                     fallthrough
+//    "switch_op" cases                case, labeled by case value
+//
+// radare2 gives a block that runs into the next one a "jump" to it,
+// the same as one ending in an unconditional jump. The default of a
+// switch is the "jump" or "fail" of its bounds check. A target that
+// is not a block of the function, such as a tail call, has no edge
+// and is listed in Function.External.
+//
+package radare
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "io"
+import "sort"
+import "strconv"
+import "./basicblock"
+
+// Function is the CFG of one function of the export.
+//
+type Function struct {
+	Name     string
+	Addr     uint64 // of the entry block
+	CFG      *cfg.CFG[uint64]
+	External []uint64 // targets outside the function, in block order
+}
+
+// Read parses an export with cfg.DefaultLimits.
+//
+func Read(r io.Reader) ([]*Function, error) {
+	return ReadLimits(r, cfg.DefaultLimits)
+}
+
+// ReadLimits parses an export, failing if it is longer than
+// limits.MaxBytes or a function exceeds the other limits.
+//
+func ReadLimits(r io.Reader, limits cfg.Limits) ([]*Function, error) {
+	if limits.MaxBytes > 0 {
+		r = io.LimitReader(r, limits.MaxBytes+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxBytes > 0 && int64(len(data)) > limits.MaxBytes {
+		return nil, fmt.Errorf("input larger than %d bytes", limits.MaxBytes)
+	}
+
+	var fns []*Function
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	for {
+		var items []item
+		if err := dec.Decode(&items); err == io.EOF {
+			break
+		} else if _, ok := err.(*json.UnmarshalTypeError); ok {
+			return nil, fmt.Errorf("not an array of functions or blocks at byte %d", dec.InputOffset())
+		} else if err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
+			continue
+		}
+		if items[0].Blocks == nil {
+			// afbj
+			fn, err := build("", "", items, limits)
+			if err != nil {
+				return nil, err
+			}
+			fns = append(fns, fn)
+			continue
+		}
+		// agfj
+		for _, it := range items {
+			if it.Blocks == nil {
+				return nil, fmt.Errorf("function %s has no blocks", it.Name)
+			}
+			fn, err := build(it.Name, it.address(), *it.Blocks, limits)
+			if err != nil {
+				return nil, err
+			}
+			fns = append(fns, fn)
+		}
+	}
+	return fns, nil
+}
+
+//-----------------------------------------------------------
+
+// item is a function of agfj or a block of agfj or afbj. Addresses
+// are kept as numbers, since radare2 may print an absent one as -1.
+//
+type item struct {
+	Name   string      `json:"name"`
+	Addr   json.Number `json:"addr"`
+	Offset json.Number `json:"offset"`
+	Blocks *[]item     `json:"blocks"`
+	Jump   json.Number `json:"jump"`
+	Fail   json.Number `json:"fail"`
+	Switch *switchOp   `json:"switch_op"`
+	Old    *switchOp   `json:"switchop"`
+}
+
+type switchOp struct {
+	Cases []struct {
+		Jump  json.Number `json:"jump"`
+		Value json.Number `json:"value"`
+	} `json:"cases"`
+}
+
+func (it *item) address() json.Number {
+	if it.Addr != "" {
+		return it.Addr
+	}
+	return it.Offset
+}
+
+// parseAddr returns the address in n, or false if n is absent or
+// radare2's UT64_MAX for none.
+//
+func parseAddr(n json.Number) (uint64, bool, error) {
+	if n == "" || n == "-1" {
+		return 0, false, nil
+	}
+	a, err := strconv.ParseUint(string(n), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("bad address %s", n)
+	}
+	return a, a != ^uint64(0), nil
+}
+
+type edge struct {
+	to    uint64
+	kind  cfg.EdgeKind
+	label string
+}
+
+// build makes the CFG of a function from its blocks. 'addr' is its
+// entry, or "" for the lowest block.
+//
+func build(name string, addr json.Number, blocks []item, limits cfg.Limits) (*Function, error) {
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("function %s has no blocks", name)
+	}
+	what := "function " + name
+	if name == "" {
+		what = "afbj function"
+	}
+	if limits.MaxBlocks > 0 && len(blocks) > limits.MaxBlocks {
+		return nil, fmt.Errorf("more than %d blocks in %s", limits.MaxBlocks, what)
+	}
+
+	starts := make([]uint64, len(blocks))
+	isBlock := make(map[uint64]bool)
+	for i := range blocks {
+		a, ok, err := parseAddr(blocks[i].address())
+		if err == nil && !ok {
+			err = fmt.Errorf("block without an address")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", what, err)
+		}
+		if isBlock[a] {
+			return nil, fmt.Errorf("%s: block %#x listed twice", what, a)
+		}
+		starts[i] = a
+		isBlock[a] = true
+	}
+	order := make([]int, len(blocks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return starts[order[i]] < starts[order[j]] })
+
+	fn := &Function{Name: name, Addr: starts[order[0]]}
+	if entry, ok, err := parseAddr(addr); err != nil {
+		return nil, fmt.Errorf("function %s: %v", name, err)
+	} else if ok {
+		if !isBlock[entry] {
+			return nil, fmt.Errorf("function %s: no block at its address %#x", name, entry)
+		}
+		fn.Addr = entry
+	}
+	if fn.Name == "" {
+		fn.Name = fmt.Sprintf("fcn.%08x", fn.Addr)
+	}
+
+	g := cfg.NewCFGOf[uint64]()
+	for _, i := range order {
+		g.CreateNode(starts[i])
+	}
+	numEdges := 0
+	for _, i := range order {
+		edges, err := successors(&blocks[i])
+		if err != nil {
+			return nil, fmt.Errorf("function %s, block %#x: %v", fn.Name, starts[i], err)
+		}
+		for _, e := range edges {
+			if !isBlock[e.to] {
+				fn.External = append(fn.External, e.to)
+				continue
+			}
+			numEdges++
+			if limits.MaxEdges > 0 && numEdges > limits.MaxEdges {
+				return nil, fmt.Errorf("more than %d edges in function %s", limits.MaxEdges, fn.Name)
+			}
+			cfg.NewBasicBlockEdgeOfKind(g, starts[i], e.to, e.kind).SetLabel(e.label)
+		}
+	}
+	g.SetStart(fn.Addr)
+	fn.CFG = g
+	return fn, nil
+}
+
+// successors lists the edges out of a block, in the order of the
+// table above.
+//
+func successors(b *item) ([]edge, error) {
+	var edges []edge
+	jump, hasJump, err := parseAddr(b.Jump)
+	if err != nil {
+		return nil, err
+	}
+	fail, hasFail, err := parseAddr(b.Fail)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case hasJump && hasFail:
+		edges = append(edges, edge{jump, cfg.EdgeTaken, ""}, edge{fail, cfg.EdgeFallthrough, ""})
+	case hasJump:
+		edges = append(edges, edge{jump, cfg.EdgeFallthrough, ""})
+	case hasFail:
+		edges = append(edges, edge{fail, cfg.EdgeFallthrough, ""})
+	}
+
+	sw := b.Switch
+	if sw == nil {
+		sw = b.Old
+	}
+	if sw != nil {
+		for _, c := range sw.Cases {
+			to, ok, err := parseAddr(c.Jump)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				edges = append(edges, edge{to, cfg.EdgeSwitchCase, string(c.Value)})
+			}
+		}
+	}
+	return edges, nil
+}
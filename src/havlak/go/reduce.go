@@ -0,0 +1,122 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Reducibility of CFGs stored as edge lists.
+//
+// Usage: reduce [-names int|uint|string] [-split] [-max n] file.edges ...
+//
+// Reads each CFG in the edge-list format of package cfg (or standard
+// input, for "-") and prints "reducible", or "irreducible:" followed
+// by the blocks of a cycle with several entries and the entries:
+//
+//    irreducible: 1 2 (entries 1 2)
+//
+// With -split, it prints a reducible copy of the graph instead, in
+// the edge-list format, preceded by a comment for every block copied:
+//
+//    # copy -1 of 2
+//
+// The copying fails if it needs more than -max blocks.
+//
+// The fixtures in testdata/reducible are checked with
+// 'make check-reducible'.
+//
+package main
+
+import "flag"
+import "fmt"
+import "io"
+import "os"
+import "strings"
+import "./basicblock"
+import "./reducible"
+
+var names = flag.String("names", "int", "type of the block names: int, uint or string")
+var split = flag.Bool("split", false, "print a reducible copy of the graph")
+var maxCopies = flag.Int("max", 1000, "most blocks -split may copy, or 0 for no limit")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: reduce [-names int|uint|string] [-split] [-max n] file.edges ...\n")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		f := os.Stdin
+		if path != "-" {
+			var err error
+			if f, err = os.Open(path); err != nil {
+				fmt.Fprintf(os.Stderr, "reduce: %v\n", err)
+				status = 1
+				continue
+			}
+		}
+		var err error
+		switch *names {
+		case "int":
+			err = report[int](f)
+		case "uint":
+			err = report[uint64](f)
+		case "string":
+			err = report[string](f)
+		default:
+			err = fmt.Errorf("unknown name type %q", *names)
+		}
+		if f != os.Stdin {
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "reduce: %s: %v\n", path, err)
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+func report[K comparable](r io.Reader) error {
+	g, err := cfg.ReadEdgeList[K](r)
+	if err != nil {
+		return err
+	}
+	if !*split {
+		w := reducible.Check(g)
+		if w == nil {
+			fmt.Println("reducible")
+		} else {
+			fmt.Printf("irreducible: %s (entries %s)\n", blockList(w.Blocks), blockList(w.Entries))
+		}
+		return nil
+	}
+
+	reduced, original, err := reducible.Split(g, *maxCopies)
+	if err != nil {
+		return err
+	}
+	for _, bb := range reduced.Blocks() {
+		if o, ok := original[bb.Name()]; ok {
+			fmt.Printf("# copy %s of %s\n", cfg.BlockName(bb), cfg.BlockName(g.BasicBlocks()[o]))
+		}
+	}
+	return reduced.WriteEdgeList(os.Stdout)
+}
+
+func blockList[K comparable](blocks []*cfg.BasicBlock[K]) string {
+	names := make([]string, len(blocks))
+	for i, bb := range blocks {
+		names[i] = cfg.BlockName(bb)
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,445 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Reducibility of control flow graphs, and node splitting to make
+// irreducible ones reducible.
+//
+// Check applies the T1 and T2 transformations of Ullman until
+// neither applies:
+//
+//    T1    remove an edge from a block to itself
+//    T2    merge a block other than the start node into its only
+//          predecessor
+//
+// The graph is reducible if this leaves a single block. If not, the
+// blocks left, the limit graph, each stand for a single-entry region
+// of the graph, and somewhere among them is a cycle that can be
+// entered at two places: peeling off the single-entry cycles of the
+// limit graph, header by header, finds one, which Check returns as
+// the witness.
+//
+// Split copies blocks until the graph is reducible, driven by the
+// Havlak loop finder. It takes an innermost irreducible loop, picks
+// one of the blocks entered from outside it to remain the entry, and
+// copies the part of the loop that the other entries reach without
+// passing through it; the edges from outside the loop into that part
+// go to the copies instead. Of the possible entries it keeps the one
+// that needs the fewest copies (the loop header, on a tie), which is
+// the "controlled" node splitting of Janssen and Corporaal with every
+// block counting the same. Afterwards the loop has a single entry and
+// the copies are a smaller region than it was, so this ends; a limit
+// on the number of copies guards against the exponential growth some
+// graphs need.
+//
+// Only the blocks reachable from the start node are looked at.
+//
+package reducible
+
+import "container/list"
+import "fmt"
+import "reflect"
+import "./basicblock"
+import "./lsg"
+import "./havlakloopfinder"
+import "./scc"
+
+// Witness is a strongly connected region of a graph that can be
+// entered at more than one block, so that it is not a loop with a
+// single header.
+//
+type Witness[K comparable] struct {
+	Blocks  []*cfg.BasicBlock[K] // in Blocks order
+	Entries []*cfg.BasicBlock[K] // the blocks entered from outside, or the start node
+}
+
+// Check returns nil if 'cfgraph' is reducible, and otherwise a
+// witness that it is not.
+//
+func Check[K comparable](cfgraph *cfg.CFG[K]) *Witness[K] {
+	start := cfgraph.StartBasicBlock()
+	if start == nil {
+		return nil
+	}
+	reached := cfgraph.Reachable()
+
+	// rep[bb] is the block whose region 'bb' was merged into; preds
+	// and succs link the regions, self edges left out (T1).
+	rep := make(map[*cfg.BasicBlock[K]]*cfg.BasicBlock[K])
+	preds := make(map[*cfg.BasicBlock[K]]map[*cfg.BasicBlock[K]]bool)
+	succs := make(map[*cfg.BasicBlock[K]]map[*cfg.BasicBlock[K]]bool)
+	var work []*cfg.BasicBlock[K]
+	for _, bb := range cfgraph.Blocks() {
+		if !reached[bb] {
+			continue
+		}
+		rep[bb] = bb
+		preds[bb] = make(map[*cfg.BasicBlock[K]]bool)
+		succs[bb] = make(map[*cfg.BasicBlock[K]]bool)
+		work = append(work, bb)
+	}
+	for bb := range rep {
+		for ll := bb.OutEdges().Front(); ll != nil; ll = ll.Next() {
+			if dst := ll.Value.(*cfg.BasicBlockEdge[K]).Dst(); dst != bb {
+				succs[bb][dst] = true
+				preds[dst][bb] = true
+			}
+		}
+	}
+
+	// T2, until no region other than the start has a single
+	// predecessor. Merging 'n' into 'p' can only take predecessors
+	// away from the successors of 'n'.
+	for len(work) > 0 {
+		n := work[len(work)-1]
+		work = work[:len(work)-1]
+		if rep[n] != n || n == start || len(preds[n]) != 1 {
+			continue
+		}
+		var p *cfg.BasicBlock[K]
+		for p = range preds[n] {
+		}
+		delete(succs[p], n)
+		for s := range succs[n] {
+			delete(preds[s], n)
+			if s != p {
+				succs[p][s] = true
+				preds[s][p] = true
+			}
+			if len(preds[s]) == 1 {
+				work = append(work, s)
+			}
+		}
+		delete(preds, n)
+		delete(succs, n)
+		rep[n] = p
+	}
+	if len(preds) == 1 {
+		return nil
+	}
+
+	// The limit graph, as a CFG with a block for every region.
+	find := func(bb *cfg.BasicBlock[K]) *cfg.BasicBlock[K] {
+		for rep[bb] != bb {
+			bb = rep[bb]
+		}
+		return bb
+	}
+	members := make(map[*cfg.BasicBlock[K]][]*cfg.BasicBlock[K])
+	for _, bb := range cfgraph.Blocks() {
+		if reached[bb] {
+			r := find(bb)
+			members[r] = append(members[r], bb)
+		}
+	}
+	// Split every cyclic component of the limit graph that has a
+	// single entry into the rest of it, and so on down, until one has
+	// two entries. Some has, or T1 and T2 would have reduced the graph.
+	all := make(map[*cfg.BasicBlock[K]]bool)
+	for r := range preds {
+		all[r] = true
+	}
+	regions := []map[*cfg.BasicBlock[K]]bool{all}
+	for len(regions) > 0 {
+		region := regions[len(regions)-1]
+		regions = regions[:len(regions)-1]
+		limit := cfg.NewCFGOf[K]()
+		for _, bb := range cfgraph.Blocks() {
+			if region[bb] {
+				limit.CreateNode(bb.Name())
+			}
+		}
+		for r := range region {
+			for s := range succs[r] {
+				if region[s] {
+					cfg.NewBasicBlockEdge(limit, r.Name(), s.Name())
+				}
+			}
+		}
+		c := scc.Find(limit)
+		for _, i := range c.Topological() {
+			if !c.IsCyclic(i) {
+				continue
+			}
+			cycle := make(map[*cfg.BasicBlock[K]]bool)
+			for _, lb := range c.Members(i) {
+				cycle[cfgraph.BasicBlocks()[lb.Name()]] = true
+			}
+			var entries []*cfg.BasicBlock[K]
+			for _, lb := range c.Members(i) {
+				r := cfgraph.BasicBlocks()[lb.Name()]
+				outside := r == start
+				for p := range preds[r] {
+					outside = outside || !cycle[p]
+				}
+				if outside {
+					entries = append(entries, r)
+				}
+			}
+			if len(entries) == 1 {
+				delete(cycle, entries[0])
+				regions = append(regions, cycle)
+				continue
+			}
+			// The regions of the cycle may also hold blocks that
+			// leave it; the witness is the component of the entries.
+			inside := make(map[*cfg.BasicBlock[K]]bool)
+			for r := range cycle {
+				for _, bb := range members[r] {
+					inside[bb] = true
+				}
+			}
+			forward := reach(entries[0], inside, (*cfg.BasicBlockEdge[K]).Dst, (*cfg.BasicBlock[K]).OutEdges)
+			backward := reach(entries[0], inside, (*cfg.BasicBlockEdge[K]).Src, (*cfg.BasicBlock[K]).InEdges)
+			w := &Witness[K]{Entries: entries}
+			for bb := range forward {
+				if backward[bb] {
+					w.Blocks = append(w.Blocks, bb)
+				}
+			}
+			cfg.SortBlocks(w.Blocks)
+			return w
+		}
+	}
+	panic("reducible: irreducible limit graph without a witness")
+}
+
+// reach returns the blocks of 'inside' reached from 'bb' along
+// 'edges', following them to 'next'.
+//
+func reach[K comparable](bb *cfg.BasicBlock[K], inside map[*cfg.BasicBlock[K]]bool, next func(*cfg.BasicBlockEdge[K]) *cfg.BasicBlock[K], edges func(*cfg.BasicBlock[K]) *list.List) map[*cfg.BasicBlock[K]]bool {
+	seen := map[*cfg.BasicBlock[K]]bool{bb: true}
+	stack := []*cfg.BasicBlock[K]{bb}
+	for len(stack) > 0 {
+		bb := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for ll := edges(bb).Front(); ll != nil; ll = ll.Next() {
+			if n := next(ll.Value.(*cfg.BasicBlockEdge[K])); inside[n] && !seen[n] {
+				seen[n] = true
+				stack = append(stack, n)
+			}
+		}
+	}
+	return seen
+}
+
+// Split returns a reducible copy of 'cfgraph' and, for every block
+// of the copy that was added, the name of the block of 'cfgraph' it
+// copies. The graph itself is not changed. Copies are named as
+// SetEntries names a virtual entry, below the smallest name for
+// signed integers and above the largest for unsigned ones; for
+// strings they are the original name with "'" added. Split fails if the graph has another name
+// type, or needs more than 'maxCopies' copies (with 0 for no limit).
+//
+// Profile counts and weights are copied as they are, so they no
+// longer balance where blocks were split.
+//
+func Split[K comparable](cfgraph *cfg.CFG[K], maxCopies int) (*cfg.CFG[K], map[K]K, error) {
+	g := clone(cfgraph)
+	original := make(map[K]K)
+	for {
+		lsgraph := lsg.NewLSGOf[K]()
+		havlakloopfinder.FindLoops(g, lsgraph)
+		loop := innermostIrreducible(lsgraph)
+		if loop == nil {
+			return g, original, nil
+		}
+
+		region := loop.AllBlocks()
+		var entries []*cfg.BasicBlock[K]
+		for _, bb := range g.Blocks() {
+			if region[bb] && (bb == g.StartBasicBlock() || enteredFromOutside(bb, region)) {
+				entries = append(entries, bb)
+			}
+		}
+
+		// Keep the entry that leaves the least to copy; the start
+		// node has to stay.
+		var keep *cfg.BasicBlock[K]
+		var copies []*cfg.BasicBlock[K]
+		for _, k := range append([]*cfg.BasicBlock[K]{loop.Header()}, entries...) {
+			if keep == g.StartBasicBlock() {
+				break
+			}
+			part := reachedAvoiding(entries, k, region)
+			if keep == nil || k == g.StartBasicBlock() || len(part) < len(copies) {
+				keep, copies = k, part
+			}
+		}
+		if maxCopies > 0 && len(original)+len(copies) > maxCopies {
+			return nil, nil, fmt.Errorf("more than %d copies needed", maxCopies)
+		}
+
+		copyOf := make(map[*cfg.BasicBlock[K]]*cfg.BasicBlock[K])
+		for _, bb := range copies {
+			name, err := copyName(g, bb.Name())
+			if err != nil {
+				return nil, nil, err
+			}
+			c := g.CreateNode(name)
+			c.SetCount(bb.Count())
+			copyOf[bb] = c
+			if o, ok := original[bb.Name()]; ok {
+				original[name] = o
+			} else {
+				original[name] = bb.Name()
+			}
+		}
+		for _, bb := range copies {
+			for ll := bb.OutEdges().Front(); ll != nil; ll = ll.Next() {
+				edge := ll.Value.(*cfg.BasicBlockEdge[K])
+				dst := edge.Dst()
+				if c := copyOf[dst]; c != nil {
+					dst = c
+				}
+				e := cfg.NewBasicBlockEdgeOfKind(g, copyOf[bb].Name(), dst.Name(), edge.Kind())
+				e.SetLabel(edge.Label())
+				e.SetWeight(edge.Weight())
+			}
+		}
+		for _, bb := range copies {
+			var outside []*cfg.BasicBlockEdge[K]
+			for ll := bb.InEdges().Front(); ll != nil; ll = ll.Next() {
+				if edge := ll.Value.(*cfg.BasicBlockEdge[K]); !region[edge.Src()] {
+					outside = append(outside, edge)
+				}
+			}
+			for _, edge := range outside {
+				g.ReplaceSuccessor(edge.Src().Name(), bb.Name(), copyOf[bb].Name())
+			}
+		}
+	}
+}
+
+// innermostIrreducible returns an irreducible loop none of whose
+// descendants is irreducible, or nil.
+//
+func innermostIrreducible[K comparable](lsgraph *lsg.LSG[K]) *lsg.SimpleLoop[K] {
+	hasIrreducible := make(map[*lsg.SimpleLoop[K]]bool)
+	for _, loop := range lsgraph.Loops() {
+		if loop.IsReducible() {
+			continue
+		}
+		for p := loop.Parent(); p != nil; p = p.Parent() {
+			hasIrreducible[p] = true
+		}
+	}
+	for _, loop := range lsgraph.Loops() {
+		if !loop.IsReducible() && !hasIrreducible[loop] {
+			return loop
+		}
+	}
+	return nil
+}
+
+func enteredFromOutside[K comparable](bb *cfg.BasicBlock[K], region map[*cfg.BasicBlock[K]]bool) bool {
+	for ll := bb.InEdges().Front(); ll != nil; ll = ll.Next() {
+		if !region[ll.Value.(*cfg.BasicBlockEdge[K]).Src()] {
+			return true
+		}
+	}
+	return false
+}
+
+// reachedAvoiding returns, in Blocks order, the blocks of 'region'
+// that the entries other than 'keep' reach inside it without going
+// through 'keep'.
+//
+func reachedAvoiding[K comparable](entries []*cfg.BasicBlock[K], keep *cfg.BasicBlock[K], region map[*cfg.BasicBlock[K]]bool) []*cfg.BasicBlock[K] {
+	seen := make(map[*cfg.BasicBlock[K]]bool)
+	var part, stack []*cfg.BasicBlock[K]
+	for _, e := range entries {
+		if e != keep && !seen[e] {
+			seen[e] = true
+			stack = append(stack, e)
+		}
+	}
+	for len(stack) > 0 {
+		bb := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		part = append(part, bb)
+		for ll := bb.OutEdges().Front(); ll != nil; ll = ll.Next() {
+			dst := ll.Value.(*cfg.BasicBlockEdge[K]).Dst()
+			if region[dst] && dst != keep && !seen[dst] {
+				seen[dst] = true
+				stack = append(stack, dst)
+			}
+		}
+	}
+	cfg.SortBlocks(part)
+	return part
+}
+
+// clone copies the blocks, edges and entries of a graph.
+//
+func clone[K comparable](cfgraph *cfg.CFG[K]) *cfg.CFG[K] {
+	g := cfg.NewCFGOf[K]()
+	virtual := cfgraph.VirtualEntry()
+	for _, bb := range cfgraph.Blocks() {
+		if bb != virtual {
+			g.CreateNode(bb.Name()).SetCount(bb.Count())
+		}
+	}
+	for _, bb := range cfgraph.Blocks() {
+		if bb == virtual {
+			continue
+		}
+		for ll := bb.OutEdges().Front(); ll != nil; ll = ll.Next() {
+			edge := ll.Value.(*cfg.BasicBlockEdge[K])
+			e := cfg.NewBasicBlockEdgeOfKind(g, bb.Name(), edge.Dst().Name(), edge.Kind())
+			e.SetLabel(edge.Label())
+			e.SetWeight(edge.Weight())
+		}
+	}
+	var entries []K
+	for _, bb := range cfgraph.Entries() {
+		entries = append(entries, bb.Name())
+	}
+	switch {
+	case virtual != nil:
+		g.SetEntriesNamed(virtual.Name(), entries...)
+		g.VirtualEntry().SetCount(virtual.Count())
+	case len(entries) > 0:
+		g.SetStart(entries[0])
+	}
+	return g
+}
+
+// copyName invents the name of a copy of block 'name'.
+//
+func copyName[K comparable](g *cfg.CFG[K], name K) (K, error) {
+	var fresh K
+	v := reflect.ValueOf(&fresh).Elem()
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		low := int64(-1)
+		for n := range g.BasicBlocks() {
+			low = min(low, reflect.ValueOf(n).Int()-1)
+		}
+		v.SetInt(low)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var high uint64
+		for n := range g.BasicBlocks() {
+			high = max(high, reflect.ValueOf(n).Uint()+1)
+		}
+		v.SetUint(high)
+	case reflect.String:
+		v.SetString(reflect.ValueOf(name).String() + "'")
+		for g.BasicBlocks()[fresh] != nil {
+			v.SetString(v.String() + "'")
+		}
+	default:
+		return fresh, fmt.Errorf("cannot name copies of %v blocks", v.Type())
+	}
+	return fresh, nil
+}
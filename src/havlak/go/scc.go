@@ -0,0 +1,280 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Strongly connected components of control flow graphs.
+//
+// Find uses Tarjan's algorithm with an explicit stack, so that long
+// chains of blocks cannot overflow the goroutine stack. The search
+// starts at the start node and then takes the remaining blocks in
+// Blocks order; components come out in reverse topological order,
+// every component after all the components it has edges to.
+//
+// The search from the start node follows out-edges in the same order
+// as the DFS of the Havlak loop finder, so the first block of a
+// reachable component it reaches, its root, is the block Havlak
+// picks as the header. Since Havlak loops are nested components,
+// the outermost loops are exactly the reachable cyclic components,
+// with the same headers; CheckLoops tests that.
+//
+package scc
+
+import "container/list"
+import "errors"
+import "fmt"
+import "io"
+import "./basicblock"
+import "./lsg"
+
+// Components is the decomposition of a CFG into strongly connected
+// components, numbered in reverse topological order.
+//
+type Components[K comparable] struct {
+	cfgraph *cfg.CFG[K]
+	members [][]*cfg.BasicBlock[K] // in Blocks order
+	roots   []*cfg.BasicBlock[K]
+	cyclic  []bool
+	of      map[*cfg.BasicBlock[K]]int
+}
+
+// Find computes the strongly connected components of all the blocks
+// of 'cfgraph', reachable or not.
+//
+func Find[K comparable](cfgraph *cfg.CFG[K]) *Components[K] {
+	c := &Components[K]{cfgraph: cfgraph, of: make(map[*cfg.BasicBlock[K]]int)}
+
+	index := make(map[*cfg.BasicBlock[K]]int)
+	var low []int
+	var onStack []bool
+	var blocks []*cfg.BasicBlock[K] // by index
+	var component []int             // Tarjan's stack of indices
+
+	type frame struct {
+		v    int
+		next *list.Element // the next out-edge to follow
+	}
+	var stack []frame
+	visit := func(bb *cfg.BasicBlock[K]) {
+		v := len(blocks)
+		index[bb] = v
+		blocks = append(blocks, bb)
+		low = append(low, v)
+		onStack = append(onStack, true)
+		component = append(component, v)
+		stack = append(stack, frame{v, bb.OutEdges().Front()})
+	}
+
+	search := func(root *cfg.BasicBlock[K]) {
+		if _, seen := index[root]; seen {
+			return
+		}
+		visit(root)
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			v := top.v
+			if top.next != nil {
+				w := top.next.Value.(*cfg.BasicBlockEdge[K]).Dst()
+				top.next = top.next.Next()
+				if i, seen := index[w]; !seen {
+					visit(w)
+				} else if onStack[i] && i < low[v] {
+					low[v] = i
+				}
+				continue
+			}
+
+			// All successors done: v is the root of a component,
+			// or passes its low link to its parent.
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 {
+				if p := stack[len(stack)-1].v; low[v] < low[p] {
+					low[p] = low[v]
+				}
+			}
+			if low[v] != v {
+				continue
+			}
+			n := len(c.members)
+			var members []*cfg.BasicBlock[K]
+			for {
+				w := component[len(component)-1]
+				component = component[:len(component)-1]
+				onStack[w] = false
+				c.of[blocks[w]] = n
+				members = append(members, blocks[w])
+				if w == v {
+					break
+				}
+			}
+			cfg.SortBlocks(members)
+			c.members = append(c.members, members)
+			c.roots = append(c.roots, blocks[v])
+			c.cyclic = append(c.cyclic, len(members) > 1 || blocks[v].FindOutEdge(blocks[v]) != nil)
+		}
+	}
+
+	if start := cfgraph.StartBasicBlock(); start != nil {
+		search(start)
+	}
+	for _, bb := range cfgraph.Blocks() {
+		search(bb)
+	}
+	return c
+}
+
+// Len returns the number of components.
+//
+func (c *Components[K]) Len() int {
+	return len(c.members)
+}
+
+// Members returns the blocks of component 'i' in Blocks order.
+//
+func (c *Components[K]) Members(i int) []*cfg.BasicBlock[K] {
+	return c.members[i]
+}
+
+// Root returns the first block of component 'i' the search reached.
+//
+func (c *Components[K]) Root(i int) *cfg.BasicBlock[K] {
+	return c.roots[i]
+}
+
+// IsCyclic reports whether component 'i' contains a cycle: it has
+// more than one block, or a block with an edge to itself.
+//
+func (c *Components[K]) IsCyclic(i int) bool {
+	return c.cyclic[i]
+}
+
+// Of returns the component of 'bb', or -1 if it is not in the graph.
+//
+func (c *Components[K]) Of(bb *cfg.BasicBlock[K]) int {
+	if i, ok := c.of[bb]; ok {
+		return i
+	}
+	return -1
+}
+
+// Topological returns the component numbers in topological order:
+// every component before those it has edges to, and the component
+// of the start node first among those reachable from it.
+//
+func (c *Components[K]) Topological() []int {
+	order := make([]int, len(c.members))
+	for i := range order {
+		order[i] = len(order) - 1 - i
+	}
+	return order
+}
+
+// Condense builds the condensation of the graph: a DAG with a block
+// for every component, named after its root, and an edge between
+// two components wherever the graph has one or more edges between
+// their blocks. Edges are in the order of the blocks and successors
+// they stand for. The start node is the component of the start node,
+// which for a graph with several entries is its virtual entry, kept
+// as an ordinary block.
+//
+func (c *Components[K]) Condense() *cfg.CFG[K] {
+	dag := cfg.NewCFGOf[K]()
+	for _, i := range c.Topological() {
+		dag.CreateNode(c.roots[i].Name())
+	}
+	for _, i := range c.Topological() {
+		seen := make(map[int]bool)
+		for _, bb := range c.members[i] {
+			for ll := bb.OutEdges().Front(); ll != nil; ll = ll.Next() {
+				j := c.of[ll.Value.(*cfg.BasicBlockEdge[K]).Dst()]
+				if j != i && !seen[j] {
+					seen[j] = true
+					cfg.NewBasicBlockEdgeOfKind(dag, c.roots[i].Name(), c.roots[j].Name(), cfg.EdgeFallthrough)
+				}
+			}
+		}
+	}
+	if start := c.cfgraph.StartBasicBlock(); start != nil {
+		dag.SetStart(c.roots[c.of[start]].Name())
+	}
+	return dag
+}
+
+// CheckLoops compares the outermost loops of 'lsgraph', as found by
+// the Havlak loop finder on the same graph, with the components,
+// and reports every difference:
+//
+//    - an outermost loop is not exactly one component,
+//    - its header is not the root of that component,
+//    - a cyclic component reachable from the start node is not an
+//      outermost loop.
+//
+func (c *Components[K]) CheckLoops(lsgraph *lsg.LSG[K]) error {
+	var errs []error
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	found := make(map[int]bool)
+	for _, loop := range lsgraph.Loops() {
+		if loop.Parent() != nil && loop.Parent() != lsgraph.Root() {
+			continue
+		}
+		blocks := loop.AllBlocks()
+		i := c.Of(loop.Header())
+		same := i >= 0 && len(blocks) == len(c.members[i])
+		for bb := range blocks {
+			same = same && c.Of(bb) == i
+		}
+		if !same {
+			report("loop %v is not a strongly connected component", loop.Header())
+			continue
+		}
+		found[i] = true
+		if loop.Header() != c.roots[i] {
+			report("loop %v: the root of its component is %v", loop.Header(), c.roots[i])
+		}
+	}
+
+	reached := c.cfgraph.Reachable()
+	for _, i := range c.Topological() {
+		if c.cyclic[i] && reached[c.roots[i]] && !found[i] {
+			report("component %v is not an outermost loop", c.roots[i])
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WriteComponents prints the components in topological order, one
+// per line, root first:
+//
+//    0
+//    1 2 3 (cyclic)
+//    4
+//
+func (c *Components[K]) WriteComponents(w io.Writer) error {
+	for _, i := range c.Topological() {
+		line := cfg.BlockName(c.roots[i])
+		for _, bb := range c.members[i] {
+			if bb != c.roots[i] {
+				line += " " + cfg.BlockName(bb)
+			}
+		}
+		if c.cyclic[i] {
+			line += " (cyclic)"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Strongly connected components of CFGs stored as edge lists.
+//
+// Usage: sccs [-names int|uint|string] [-dag] file.edges ...
+//
+// Reads each CFG in the edge-list format of package cfg (or standard
+// input, for "-") and prints its strongly connected components in
+// topological order, one per line, root first. With -dag, it prints
+// the condensation instead, in the edge-list format, which lists the
+// blocks of the loop-collapsed graph in topological order.
+//
+// Either way, the outermost loops found by the Havlak loop finder
+// are checked against the components, and any difference is
+// reported on standard error.
+//
+// The fixtures in testdata/scc are checked with 'make check-scc'.
+//
+package main
+
+import "flag"
+import "fmt"
+import "io"
+import "os"
+import "./basicblock"
+import "./lsg"
+import "./havlakloopfinder"
+import "./scc"
+
+var names = flag.String("names", "int", "type of the block names: int, uint or string")
+var dag = flag.Bool("dag", false, "print the condensation DAG")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: sccs [-names int|uint|string] [-dag] file.edges ...\n")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		f := os.Stdin
+		if path != "-" {
+			var err error
+			if f, err = os.Open(path); err != nil {
+				fmt.Fprintf(os.Stderr, "sccs: %v\n", err)
+				status = 1
+				continue
+			}
+		}
+		var err error
+		switch *names {
+		case "int":
+			err = report[int](f)
+		case "uint":
+			err = report[uint64](f)
+		case "string":
+			err = report[string](f)
+		default:
+			err = fmt.Errorf("unknown name type %q", *names)
+		}
+		if f != os.Stdin {
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sccs: %s: %v\n", path, err)
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+func report[K comparable](r io.Reader) error {
+	g, err := cfg.ReadEdgeList[K](r)
+	if err != nil {
+		return err
+	}
+	c := scc.Find(g)
+	if *dag {
+		// The edge list declares blocks in name order, so the
+		// topological order is given as a comment.
+		fmt.Printf("# order")
+		for _, i := range c.Topological() {
+			fmt.Printf(" %s", cfg.BlockName(c.Root(i)))
+		}
+		fmt.Printf("\n")
+		err = c.Condense().WriteEdgeList(os.Stdout)
+	} else {
+		err = c.WriteComponents(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+
+	lsgraph := lsg.NewLSGOf[K]()
+	havlakloopfinder.FindLoops(g, lsgraph)
+	return c.CheckLoops(lsgraph)
+}
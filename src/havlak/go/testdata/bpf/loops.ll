@@ -0,0 +1,96 @@
+; Two XDP programs and a socket filter, with a BPF-to-BPF call into
+; .text. Compile with: llc -march=bpfel -filetype=obj -O2 loops.ll
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpfel"
+
+; Sums the first n bytes of a buffer, n < 64.
+define internal i32 @checksum(i8* %p, i32 %n) noinline section ".text" {
+entry:
+  %empty = icmp eq i32 %n, 0
+  br i1 %empty, label %done, label %loop
+
+loop:
+  %i = phi i32 [ 0, %entry ], [ %i.next, %loop ]
+  %s = phi i32 [ 0, %entry ], [ %s.next, %loop ]
+  %q = getelementptr i8, i8* %p, i32 %i
+  %b = load volatile i8, i8* %q
+  %w = zext i8 %b to i32
+  %s.next = add i32 %s, %w
+  %i.next = add i32 %i, 1
+  %more = icmp ult i32 %i.next, %n
+  br i1 %more, label %loop, label %done
+
+done:
+  %r = phi i32 [ 0, %entry ], [ %s.next, %loop ]
+  ret i32 %r
+}
+
+; A nested loop over a 4x4 table, and the call.
+define i32 @xdp_table(i8* %ctx) section "xdp" {
+entry:
+  br label %outer
+
+outer:
+  %i = phi i32 [ 0, %entry ], [ %i.next, %outer.latch ]
+  %acc = phi i32 [ 0, %entry ], [ %acc.inner, %outer.latch ]
+  br label %inner
+
+inner:
+  %j = phi i32 [ 0, %outer ], [ %j.next, %inner ]
+  %a = phi i32 [ %acc, %outer ], [ %a.next, %inner ]
+  %k = mul i32 %i, 4
+  %idx = add i32 %k, %j
+  %q = getelementptr i8, i8* %ctx, i32 %idx
+  %b = load volatile i8, i8* %q
+  %w = zext i8 %b to i32
+  %a.next = xor i32 %a, %w
+  %j.next = add i32 %j, 1
+  %jm = icmp ult i32 %j.next, 4
+  br i1 %jm, label %inner, label %outer.latch
+
+outer.latch:
+  %acc.inner = phi i32 [ %a.next, %inner ]
+  %i.next = add i32 %i, 1
+  %im = icmp ult i32 %i.next, 4
+  br i1 %im, label %outer, label %exit
+
+exit:
+  %c = call i32 @checksum(i8* %ctx, i32 %acc.inner)
+  %pass = and i32 %c, 1
+  %r = add i32 %pass, 1
+  ret i32 %r
+}
+
+; A loop with two entries, which no structured source can write.
+define i32 @socket_irreducible(i8* %ctx, i32 %x) section "socket" {
+entry:
+  %odd = and i32 %x, 1
+  %c = icmp eq i32 %odd, 0
+  br i1 %c, label %left, label %right
+
+left:
+  %l = phi i32 [ %x, %entry ], [ %r.next, %right ]
+  %l.next = add i32 %l, 3
+  %l.done = icmp ugt i32 %l.next, 100
+  br i1 %l.done, label %exit, label %right
+
+right:
+  %r = phi i32 [ %x, %entry ], [ %l.next, %left ]
+  %r.next = mul i32 %r, 2
+  %r.done = icmp ugt i32 %r.next, 200
+  br i1 %r.done, label %exit, label %left
+
+exit:
+  %v = phi i32 [ %l.next, %left ], [ %r.next, %right ]
+  %s = call i32 @checksum(i8* %ctx, i32 4)
+  %t = add i32 %v, %s
+  ret i32 %t
+}
+
+; No loops at all, but a 16-byte lddw.
+define i32 @xdp_pass(i8* %ctx) section "xdp" {
+  %p = bitcast i8* %ctx to i64*
+  store volatile i64 81985529216486895, i64* %p
+  ret i32 2
+}
@@ -0,0 +1,10 @@
+// eh.cfg is the dump of g++ -O0 -fdump-tree-cfg-blocks-details eh.cc.
+
+void may_throw(int);
+int f(int n)
+{
+  int s = 0;
+  for (int i = 0; i < n; i++)
+    try { may_throw(i); s++; } catch (int e) { s += e; }
+  return s;
+}
@@ -0,0 +1,46 @@
+/* loops.cfg is the dump of gcc -O0 -fdump-tree-cfg loops.c. */
+
+int sum(int *a, int n, int m)
+{
+  int s = 0;
+  for (int i = 0; i < n; i++)
+    for (int j = 0; j < m; j++)
+      s += a[i * m + j];
+  return s;
+}
+
+int find(int *a, int n, int x)
+{
+  int i = 0;
+  while (i < n)
+    {
+      if (a[i] == x)
+        return i;
+      i++;
+    }
+  return -1;
+}
+
+int classify(int c)
+{
+  switch (c)
+    {
+    case 0: return 1;
+    case 1: case 2: return 2;
+    case 7: return 3;
+    default: return 0;
+    }
+}
+
+int irreducible(int x, int n)
+{
+  if (x)
+    goto b;
+a:
+  n--;
+b:
+  n -= 2;
+  if (n > 0)
+    goto a;
+  return n;
+}
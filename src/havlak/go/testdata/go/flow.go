@@ -0,0 +1,97 @@
+// Control flow that goloops must follow: labeled break and continue,
+// goto, fallthrough, select, defer and panic, and function literals,
+// nested and at package level, which must be named as gc names them.
+
+package flow
+
+func search(grid [][]int, want int) (int, int) {
+	row := 0
+outer:
+	for i, line := range grid {
+		for j, v := range line {
+			if v < 0 {
+				continue outer
+			}
+			if v == want {
+				row = i
+				break outer
+			}
+			_ = j
+		}
+	}
+	return row, 0
+}
+
+func retry(f func() bool) int {
+	n := 0
+again:
+	n++
+	if !f() && n < 3 {
+		goto again
+	}
+	return n
+}
+
+func grade(score int) string {
+	s := ""
+	switch {
+	case score > 90:
+		s += "A"
+		fallthrough
+	case score > 80:
+		s += "B"
+	default:
+		s = "C"
+	}
+	return s
+}
+
+func pump(in <-chan int, out chan<- int, quit <-chan bool) {
+	for {
+		select {
+		case v := <-in:
+			out <- v
+		case <-quit:
+			return
+		}
+	}
+}
+
+func guarded(xs []int) (sum int) {
+	defer func() {
+		if recover() != nil {
+			sum = -1
+		}
+	}()
+	for _, x := range xs {
+		if x < 0 {
+			panic("negative")
+		}
+		sum += x
+	}
+	return sum
+}
+
+func nested() func() int {
+	count := func() int { return 0 }
+	return func() int {
+		inner := func() int {
+			for i := 0; ; i++ {
+				if i > count() {
+					return i
+				}
+			}
+		}
+		return inner() + func() int { return 1 }()
+	}
+}
+
+var table = []func(int) int{
+	func(x int) int { return x },
+}
+
+var second = func() int { return 2 }
+
+func init() {
+	table = append(table, func(x int) int { return -x })
+}
@@ -0,0 +1,54 @@
+// Loops.class holds the bytecode of this class, laid out the way
+// javac 8 compiles it.
+
+class Loops {
+    static int sum(int[][] a) {
+        int s = 0;
+        for (int i = 0; i < a.length; i++)
+            for (int j = 0; j < a[i].length; j++)
+                s += a[i][j];
+        return s;
+    }
+
+    static int classify(int x) {
+        switch (x) {
+        case 0: return 10;
+        case 1: return 20;
+        case 2: return 30;
+        default: return -1;
+        }
+    }
+
+    static int sparse(int x) {
+        switch (x) {
+        case 1: return 1;
+        case 100: return 2;
+        case 1000: return 3;
+        }
+        return 0;
+    }
+
+    static int parse(String s) {
+        int n = 0;
+        while (true) {
+            try {
+                return Integer.parseInt(s);
+            } catch (NumberFormatException e) {
+                s = s.substring(1);
+                if (++n > 3)
+                    throw e;
+            }
+        }
+    }
+
+    static int guarded(int[] a) {
+        int n = 0;
+        try {
+            for (int i = 0; i < a.length; i++)
+                n += a[i];
+        } finally {
+            n++;
+        }
+        return n;
+    }
+}
@@ -0,0 +1,38 @@
+; Itanium and Windows exception handling.
+
+declare void @may_throw()
+declare i32 @__gxx_personality_v0(...)
+declare i32 @__CxxFrameHandler3(...)
+
+define void @retry_on_throw() personality ptr @__gxx_personality_v0 {
+entry:
+  br label %try
+
+try:
+  invoke void @may_throw()
+          to label %ok unwind label %lpad
+
+ok:
+  ret void
+
+lpad:
+  %lp = landingpad { ptr, i32 }
+          catch ptr null
+  br label %try
+}
+
+define void @seh() personality ptr @__CxxFrameHandler3 {
+entry:
+  invoke void @may_throw()
+          to label %done unwind label %dispatch
+
+dispatch:
+  %cs = catchswitch within none [label %handler] unwind to caller
+
+handler:
+  %cp = catchpad within %cs [ptr null, i32 64, ptr null]
+  catchret from %cp to label %done
+
+done:
+  ret void
+}
@@ -0,0 +1,15 @@
+; A loop with two entries, which no structured source produces.
+
+define void @two_entries(i1 %c, i1 %d) {
+entry:
+  br i1 %c, label %left, label %right
+
+left:
+  br label %right
+
+right:
+  br i1 %d, label %left, label %exit
+
+exit:
+  ret void
+}
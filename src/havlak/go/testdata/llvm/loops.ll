@@ -0,0 +1,69 @@
+; Nested counted loops as clang -O0 emits them, with numbered
+; arguments and blocks, and one named loop from hand-written IR.
+
+target triple = "x86_64-unknown-linux-gnu"
+
+@.str = private unnamed_addr constant [4 x i8] c"%d\0A\00", align 1
+
+; Function Attrs: noinline nounwind optnone uwtable
+define dso_local i32 @sum(ptr noundef %0, i32 noundef %1) #0 {
+  %3 = alloca ptr, align 8
+  %4 = alloca i32, align 4
+  %5 = alloca i32, align 4
+  %6 = alloca i32, align 4
+  store ptr %0, ptr %3, align 8
+  store i32 %1, ptr %4, align 4
+  store i32 0, ptr %5, align 4
+  store i32 0, ptr %6, align 4
+  br label %7
+
+7:                                                ; preds = %16, %2
+  %8 = load i32, ptr %6, align 4
+  %9 = load i32, ptr %4, align 4
+  %10 = icmp slt i32 %8, %9
+  br i1 %10, label %11, label %19
+
+11:                                               ; preds = %7
+  %12 = load i32, ptr %5, align 4
+  %13 = add nsw i32 %12, 1
+  store i32 %13, ptr %5, align 4
+  br label %14
+
+14:                                               ; preds = %14, %11
+  %15 = icmp slt i32 %13, 100
+  br i1 %15, label %14, label %16
+
+16:                                               ; preds = %14
+  %17 = load i32, ptr %6, align 4
+  %18 = add nsw i32 %17, 1
+  store i32 %18, ptr %6, align 4
+  br label %7, !llvm.loop !6
+
+19:                                               ; preds = %7
+  %20 = load i32, ptr %5, align 4
+  ret i32 %20
+}
+
+declare i32 @printf(ptr noundef, ...) #1
+
+define void @"count down"(i32 %n) {
+entry:
+  br label %"loop head"
+
+"loop head":
+  %i = phi i32 [ %n, %entry ], [ %i.next, %"loop body" ]
+  %done = icmp eq i32 %i, 0
+  br i1 %done, label %exit, label %"loop body"
+
+"loop body":
+  %i.next = sub i32 %i, 1
+  br label %"loop head"
+
+exit:
+  ret void
+}
+
+attributes #0 = { noinline nounwind optnone uwtable }
+
+!6 = distinct !{!6, !7}
+!7 = !{!"llvm.loop.mustprogress"}
@@ -0,0 +1,42 @@
+; A switch spread over several lines, an indirectbr and callbr.
+
+define i32 @classify(i32 %x) {
+entry:
+  switch i32 %x, label %other [
+    i32 0, label %zero
+    i32 1, label %small
+    i32 2, label %small
+    i32 -1, label %negative
+  ]
+
+zero:
+  ret i32 0
+
+small:
+  br label %other
+
+negative:
+  br label %retry
+
+retry:
+  %again = icmp slt i32 %x, 0
+  br i1 %again, label %retry, label %other
+
+other:
+  %r = phi i32 [ 1, %entry ], [ 2, %small ], [ 3, %retry ]
+  ret i32 %r
+}
+
+define void @dispatch(ptr %target) {
+entry:
+  indirectbr ptr %target, [label %a, label %b]
+
+a:
+  indirectbr ptr %target, [label %a, label %b]
+
+b:
+  callbr void asm "jmp ${0:l}", "!i"() to label %done [label %a]
+
+done:
+  ret void
+}
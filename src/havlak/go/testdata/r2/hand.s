@@ -0,0 +1,18 @@
+# Hand-written: a loop entered in its middle from the top of the
+# function, so that it has two entries.
+	.text
+	.globl	irreducible
+	.type	irreducible, @function
+irreducible:
+	movl	%esi, %eax
+	testl	%edi, %edi
+	jne	.Lsecond
+.Lfirst:
+	subl	$1, %eax
+.Lsecond:
+	subl	$2, %eax
+	cmpl	$0, %eax
+	jg	.Lfirst
+	ret
+	.size	irreducible, .-irreducible
+	.section	.note.GNU-stack,"",@progbits
@@ -0,0 +1,44 @@
+/* prog.json holds the graphs of the .text functions, as
+   radare2's 'agfj @@F' prints them, of
+
+     gcc -O2 -no-pie -fno-pie -o prog prog.c hand.s
+
+   and classify.json the blocks of classify as 'afbj' prints them. */
+
+#include <stdio.h>
+#include <stdlib.h>
+
+int irreducible(int x, int n);
+
+int sum(const int *a, int n, int m)
+{
+  int s = 0;
+  for (int i = 0; i < n; i++)
+    for (int j = 0; j < m; j++)
+      s += a[i * m + j];
+  return s;
+}
+
+int classify(int c)
+{
+  switch (c)
+    {
+    case 0: return puts("zero");
+    case 1: return puts("one");
+    case 2: case 3: return puts("few");
+    case 5: return puts("five");
+    case 6: return puts("six");
+    case 8: return puts("eight");
+    default: return 0;
+    }
+}
+
+int main(int argc, char **argv)
+{
+  int a[6] = { 1, 2, 3, 4, 5, 6 };
+  int n = argc > 1 ? atoi(argv[1]) : 2;
+  printf("%d\n", sum(a, n, 3));
+  for (int i = 0; i < n; i++)
+    classify(i);
+  return irreducible(argc, n) & 0;
+}
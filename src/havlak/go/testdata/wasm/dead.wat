@@ -0,0 +1,25 @@
+(module
+  (func $once (export "once") (param i32) (result i32)
+    loop
+      local.get 0
+      i32.eqz
+      if
+        i32.const 0
+        return
+      end
+    end
+    local.get 0
+    i32.const 0
+    i32.lt_s
+    if
+      unreachable
+    end
+    block
+      local.get 0
+      br 0
+      loop
+        br 0
+      end
+      drop
+    end
+    local.get 0))
@@ -0,0 +1,83 @@
+(module
+  (func $sum (export "sum") (param i32) (param i32) (result i32)
+    (local i32 i32 i32)
+    i32.const 0
+    local.set 2
+    block
+      loop
+        local.get 2
+        local.get 0
+        i32.lt_s
+        i32.eqz
+        br_if 1
+        i32.const 0
+        local.set 3
+        block
+          loop
+            local.get 3
+            local.get 1
+            i32.lt_s
+            i32.eqz
+            br_if 1
+            local.get 4
+            local.get 2
+            local.get 3
+            i32.mul
+            i32.add
+            local.set 4
+            local.get 3
+            i32.const 1
+            i32.add
+            local.set 3
+            br 0
+          end
+        end
+        local.get 2
+        i32.const 1
+        i32.add
+        local.set 2
+        br 0
+      end
+    end
+    local.get 4)
+  (func $collatz (export "collatz") (param i32) (result i32)
+    (local i32)
+    block
+      loop
+        local.get 0
+        i32.const 1
+        i32.le_s
+        br_if 1
+        local.get 0
+        i32.const 2
+        i32.rem_u
+        if
+          local.get 0
+          i32.const 3
+          i32.mul
+          i32.const 1
+          i32.add
+          local.set 0
+        else
+          local.get 0
+          i32.const 1
+          i32.sub
+          local.set 0
+        end
+        local.get 1
+        i32.const 1
+        i32.add
+        local.set 1
+        br 0
+      end
+    end
+    local.get 1)
+  (func $countdown (export "countdown") (param i32) (result i32)
+    loop
+      local.get 0
+      i32.const 1
+      i32.sub
+      local.tee 0
+      br_if 0
+    end
+    local.get 0))
@@ -0,0 +1,46 @@
+(module
+  (func $classify (export "classify") (param i32) (result i32)
+    block
+      block
+        block
+          block
+            local.get 0
+            br_table 0 1 2 1 3
+          end
+          i32.const 10
+          return
+        end
+        i32.const 20
+        return
+      end
+      i32.const 30
+      return
+    end
+    i32.const -1)
+  (func $step (export "step") (param i32) (result i32)
+    (local i32)
+    block
+      loop
+        block
+          block
+            local.get 0
+            br_table 0 1 3
+          end
+          local.get 1
+          i32.const 1
+          i32.add
+          local.set 1
+          i32.const 1
+          local.set 0
+          br 1
+        end
+        local.get 1
+        i32.const 2
+        i32.add
+        local.set 1
+        i32.const 2
+        local.set 0
+        br 0
+      end
+    end
+    local.get 1))
@@ -0,0 +1,157 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//======================================================
+// Structural Validation
+//======================================================
+
+package cfg
+
+import "container/list"
+import "errors"
+import "fmt"
+
+// Validate checks the structural invariants of the graph and
+// reports every violation it finds:
+//
+//    - the start block is nil or not part of the graph,
+//    - an edge is listed at one endpoint but not at the other, or
+//      refers to a block that is not part of the graph,
+//    - two edges have the same endpoints, kind and label,
+//    - a block cannot be reached from StartBasicBlock.
+//
+// Edges with the same endpoints but a different kind or label are
+// legal: a conditional jump to the next instruction is both taken
+// and fallthrough, and switch cases may share a target; the loop
+// finders handle them. An empty graph is valid.
+//
+func (cfg *CFG[K]) Validate() error {
+	return cfg.validate(true)
+}
+
+// ValidateStructure checks the invariants of Validate other than
+// reachability. The readers of the edge-list, DOT, GraphML and JSON
+// formats run it on every graph they build; dead code is common in
+// real programs, and the loop finders leave it out.
+//
+func (cfg *CFG[K]) ValidateStructure() error {
+	return cfg.validate(false)
+}
+
+func (cfg *CFG[K]) validate(reachable bool) error {
+	if len(cfg.bb) == 0 {
+		return nil
+	}
+
+	var errs []error
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if cfg.startNode == nil {
+		report("start block is nil")
+	} else if cfg.bb[cfg.startNode.Name()] != cfg.startNode {
+		report("start block %v is not part of the graph", cfg.startNode)
+	}
+
+	blocks := cfg.Blocks()
+	for _, bb := range blocks {
+		if cfg.bb[bb.Name()] != bb {
+			report("%v is stored under a different name", bb)
+		}
+
+		type key struct {
+			to    *BasicBlock[K]
+			kind  EdgeKind
+			label string
+		}
+		seen := make(map[key]bool)
+
+		for iter := bb.OutEdges().Front(); iter != nil; iter = iter.Next() {
+			edge := iter.Value.(*BasicBlockEdge[K])
+			switch {
+			case edge.Src() != bb:
+				report("%v lists outgoing edge %v -> %v", bb, edge.Src(), edge.Dst())
+			case cfg.bb[edge.Dst().Name()] != edge.Dst():
+				report("edge %v -> %v leaves the graph", bb, edge.Dst())
+			case !listContains(edge.Dst().InEdges(), edge):
+				report("edge %v -> %v is missing from the in-edges of %v",
+					bb, edge.Dst(), edge.Dst())
+			}
+
+			k := key{edge.Dst(), edge.Kind(), edge.Label()}
+			if seen[k] {
+				report("duplicate edge %v -> %v%s", bb, edge.Dst(), edge.annotation())
+			}
+			seen[k] = true
+		}
+
+		for iter := bb.InEdges().Front(); iter != nil; iter = iter.Next() {
+			edge := iter.Value.(*BasicBlockEdge[K])
+			switch {
+			case edge.Dst() != bb:
+				report("%v lists incoming edge %v -> %v", bb, edge.Src(), edge.Dst())
+			case cfg.bb[edge.Src().Name()] != edge.Src():
+				report("edge %v -> %v comes from outside the graph", edge.Src(), bb)
+			case !listContains(edge.Src().OutEdges(), edge):
+				report("edge %v -> %v is missing from the out-edges of %v",
+					edge.Src(), bb, edge.Src())
+			}
+		}
+	}
+
+	if reachable && cfg.startNode != nil {
+		reached := cfg.Reachable()
+		for _, bb := range blocks {
+			if !reached[bb] {
+				report("%v is not reachable from the start block", bb)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Reachable returns the set of blocks reachable from the start
+// block, following edges forward.
+//
+func (cfg *CFG[K]) Reachable() map[*BasicBlock[K]]bool {
+	reached := make(map[*BasicBlock[K]]bool)
+	if cfg.startNode == nil {
+		return reached
+	}
+
+	stack := []*BasicBlock[K]{cfg.startNode}
+	reached[cfg.startNode] = true
+	for len(stack) > 0 {
+		bb := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for iter := bb.OutEdges().Front(); iter != nil; iter = iter.Next() {
+			if succ := iter.Value.(*BasicBlockEdge[K]).Dst(); !reached[succ] {
+				reached[succ] = true
+				stack = append(stack, succ)
+			}
+		}
+	}
+	return reached
+}
+
+func listContains[K comparable](l *list.List, edge *BasicBlockEdge[K]) bool {
+	for iter := l.Front(); iter != nil; iter = iter.Next() {
+		if iter.Value.(*BasicBlockEdge[K]) == edge {
+			return true
+		}
+	}
+	return false
+}
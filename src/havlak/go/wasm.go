@@ -0,0 +1,816 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Control flow graphs from WebAssembly binary modules.
+//
+// Read decodes a .wasm module and lowers the structured control
+// flow of every function body into a CFG. Blocks are named by the
+// module offset of their first instruction, the way wasm-objdump
+// shows them. Structured instructions become edges as follows:
+//
+//    block ... end            no edge of its own; 'end' starts a new
+//                             block if anything branches to it
+//    loop ... end             starts a new block, the loop header
+//    if ... else ... end      then-branch fallthrough, else (or end)
+//                             taken
+//    br l                     to the target of l, fallthrough
+//    br_if l                  target taken, next instruction
+//                             fallthrough
+//    br_table l* l            case, labeled by index or "default"
+//    br_on_null l, br_on_non_null l
+//                             like br_if
+//    return, unreachable, throw, return_call ...
+//                             no successors
+//
+// A branch to a 'block' or 'if' goes to the instruction after its
+// 'end', a branch to a 'loop' to its header, and a branch to the
+// function body is a return. Code after an unconditional transfer
+// is unreachable and left out of the CFG. Loops records the headers
+// of the 'loop' constructs that some branch targets, which are
+// exactly the loops the Havlak loop finder must report.
+//
+// Besides the MVP instruction set, the decoder knows sign extension,
+// saturating truncation, bulk memory, reference types, multiple
+// memories, SIMD, threads and tail calls. The exception handling
+// instructions other than throw and throw_ref are rejected.
+//
+package wasm
+
+import "fmt"
+import "io"
+import "strconv"
+import "./basicblock"
+
+// Function is the CFG of one function defined by the module.
+//
+type Function struct {
+	Index  int    // in the function index space, after the imports
+	Name   string // from the name section or an export, or ""
+	Offset int    // of the body in the module
+	CFG    *cfg.CFG[uint32]
+	Loops  []uint32 // headers of 'loop's that are branched to
+}
+
+// FormatError is a decoding error at a particular offset of the
+// module.
+//
+type FormatError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("offset %#x: %s", e.Offset, e.Msg)
+}
+
+// Read decodes a module with cfg.DefaultLimits, applying MaxBlocks
+// and MaxEdges to each function.
+//
+func Read(r io.Reader) ([]*Function, error) {
+	return ReadLimits(r, cfg.DefaultLimits)
+}
+
+// ReadLimits decodes a module, failing if it is larger than
+// limits.MaxBytes or a function exceeds the other limits.
+//
+func ReadLimits(r io.Reader, limits cfg.Limits) ([]*Function, error) {
+	if limits.MaxBytes > 0 {
+		r = io.LimitReader(r, limits.MaxBytes+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxBytes > 0 && int64(len(data)) > limits.MaxBytes {
+		return nil, fmt.Errorf("input larger than %d bytes", limits.MaxBytes)
+	}
+	return Decode(data, limits)
+}
+
+// Decode is ReadLimits for a module already in memory.
+//
+func Decode(data []byte, limits cfg.Limits) ([]*Function, error) {
+	d := &decoder{reader: reader{data: data}, limits: limits}
+	fns := d.module()
+	if d.err != nil {
+		return nil, d.err
+	}
+	return fns, nil
+}
+
+//-----------------------------------------------------------
+
+// reader reads the primitive encodings. The first error sticks:
+// later reads return zero values, so callers check err only where
+// it matters for control flow.
+//
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = &FormatError{Offset: r.pos, Msg: fmt.Sprintf(format, args...)}
+	}
+	r.pos = len(r.data)
+}
+
+func (r *reader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.fail("unexpected end")
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *reader) bytes(n int) []byte {
+	if n < 0 || n > len(r.data)-r.pos {
+		r.fail("unexpected end")
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// leb reads an unsigned LEB128 number of at most 'bits' bits.
+//
+func (r *reader) leb(bits uint) uint64 {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		b := r.byte()
+		if r.err != nil {
+			return 0
+		}
+		if shift >= bits || (shift+7 > bits && b&0x7f>>(bits-shift) != 0) {
+			r.fail("integer too large")
+			return 0
+		}
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+}
+
+func (r *reader) u32() uint32 {
+	return uint32(r.leb(32))
+}
+
+// sleb skips a signed LEB128 number of at most 'bits' bits.
+//
+func (r *reader) sleb(bits uint) {
+	for n := uint(0); ; n += 7 {
+		b := r.byte()
+		if r.err != nil {
+			return
+		}
+		if n >= bits {
+			r.fail("integer too large")
+			return
+		}
+		if b&0x80 == 0 {
+			return
+		}
+	}
+}
+
+func (r *reader) name() string {
+	return string(r.bytes(int(r.u32())))
+}
+
+// valType skips a value type, including the (ref null? ht) forms.
+//
+func (r *reader) valType() {
+	switch b := r.byte(); b {
+	case 0x63, 0x64:
+		r.sleb(33)
+	}
+}
+
+// blockType skips the type of a block, loop or if: empty, a value
+// type, or a type index.
+//
+func (r *reader) blockType() {
+	if r.pos >= len(r.data) {
+		r.fail("unexpected end")
+		return
+	}
+	switch b := r.data[r.pos]; {
+	case b == 0x40:
+		r.pos++
+	case b == 0x63 || b == 0x64:
+		r.valType()
+	case b >= 0x6a && b <= 0x7f:
+		r.pos++
+	default:
+		r.sleb(33)
+	}
+}
+
+// memArg skips an alignment and offset; bit 6 of the alignment
+// announces a memory index.
+//
+func (r *reader) memArg() {
+	if align := r.u32(); align&0x40 != 0 {
+		r.u32()
+	}
+	r.leb(64)
+}
+
+// memLimits skips the limits of a table or memory.
+//
+func (r *reader) memLimits() {
+	flags := r.byte()
+	r.leb(64)
+	if flags&1 != 0 {
+		r.leb(64)
+	}
+}
+
+//-----------------------------------------------------------
+
+type decoder struct {
+	reader
+	limits cfg.Limits
+
+	imports int            // imported functions
+	names   map[int]string // by function index
+	bodies  []*Function    // in code section order
+}
+
+const (
+	secCustom   = 0
+	secImport   = 2
+	secFunction = 3
+	secExport   = 7
+	secCode     = 10
+)
+
+func (d *decoder) module() []*Function {
+	magic := d.bytes(8)
+	if d.err != nil || string(magic[:4]) != "\x00asm" {
+		d.err = &FormatError{Offset: 0, Msg: "not a WebAssembly module"}
+		return nil
+	}
+	if magic[4] != 1 || magic[5] != 0 || magic[6] != 0 || magic[7] != 0 {
+		d.err = &FormatError{Offset: 4, Msg: "unsupported version"}
+		return nil
+	}
+
+	d.names = make(map[int]string)
+	exports := make(map[int]string)
+	declared := -1
+	for d.err == nil && d.pos < len(d.data) {
+		id := d.byte()
+		size := int(d.u32())
+		start := d.pos
+		content := d.bytes(size)
+		if d.err != nil {
+			break
+		}
+		sec := d.section(start, start+len(content))
+		switch id {
+		case secCustom:
+			sec.customSection()
+		case secImport:
+			sec.importSection()
+			d.imports = sec.imports
+		case secFunction:
+			declared = int(sec.u32())
+		case secExport:
+			sec.exportSection(exports)
+		case secCode:
+			sec.codeSection()
+			d.bodies = sec.bodies
+		}
+		if sec.err != nil {
+			d.err = sec.err
+			return nil
+		}
+	}
+	if d.err != nil {
+		return nil
+	}
+	if declared >= 0 && declared != len(d.bodies) || declared < 0 && len(d.bodies) > 0 {
+		d.fail("function and code sections disagree")
+		return nil
+	}
+
+	for _, fn := range d.bodies {
+		if name, ok := d.names[fn.Index]; ok {
+			fn.Name = name
+		} else {
+			fn.Name = exports[fn.Index]
+		}
+	}
+	return d.bodies
+}
+
+// section returns a decoder for the section at data[start:end],
+// which reports errors at module offsets.
+//
+func (d *decoder) section(start, end int) *decoder {
+	sec := *d
+	sec.reader = reader{data: d.data[:end], pos: start}
+	return &sec
+}
+
+// customSection picks the function names out of the "name" section.
+// Anything malformed there is ignored, as custom sections may be.
+//
+func (d *decoder) customSection() {
+	if d.name() != "name" || d.err != nil {
+		d.err = nil
+		return
+	}
+	names := make(map[int]string)
+	for d.err == nil && d.pos < len(d.data) {
+		id := d.byte()
+		size := int(d.u32())
+		end := d.pos + size
+		if id != 1 {
+			d.bytes(size)
+			continue
+		}
+		for n := d.u32(); n > 0 && d.err == nil && d.pos < end; n-- {
+			index := int(d.u32())
+			names[index] = d.name()
+		}
+		if d.pos < end {
+			d.pos = end
+		}
+	}
+	if d.err == nil {
+		for index, name := range names {
+			d.names[index] = name
+		}
+	}
+	d.err = nil
+}
+
+func (d *decoder) importSection() {
+	for n := d.u32(); n > 0 && d.err == nil; n-- {
+		d.name()
+		d.name()
+		switch kind := d.byte(); kind {
+		case 0: // function
+			d.u32()
+			d.imports++
+		case 1: // table
+			d.valType()
+			d.memLimits()
+		case 2: // memory
+			d.memLimits()
+		case 3: // global
+			d.valType()
+			d.byte()
+		case 4: // tag
+			d.byte()
+			d.u32()
+		default:
+			d.fail("unknown import kind %d", kind)
+		}
+	}
+}
+
+func (d *decoder) exportSection(exports map[int]string) {
+	for n := d.u32(); n > 0 && d.err == nil; n-- {
+		name := d.name()
+		kind := d.byte()
+		index := int(d.u32())
+		if _, ok := exports[index]; kind == 0 && !ok {
+			exports[index] = name
+		}
+	}
+}
+
+func (d *decoder) codeSection() {
+	for i, n := 0, d.u32(); uint32(i) < n && d.err == nil; i++ {
+		size := int(d.u32())
+		start := d.pos
+		if d.bytes(size); d.err != nil {
+			return
+		}
+		fn := &Function{Index: d.imports + i, Offset: start}
+		body := &lowering{
+			reader: reader{data: d.data[:start+size], pos: start},
+			limits: d.limits,
+			fn:     fn,
+		}
+		if body.function(); body.err != nil {
+			d.err = body.err
+			return
+		}
+		d.bodies = append(d.bodies, fn)
+	}
+}
+
+//-----------------------------------------------------------
+
+// block is a basic block being built. Its name is the offset of
+// its first instruction, which is not known when it is created.
+//
+type block struct {
+	name  uint32
+	named bool
+	succs []successor
+}
+
+type successor struct {
+	to    int // index into lowering.blocks
+	kind  cfg.EdgeKind
+	label string
+}
+
+// frame is an entry of the control stack.
+//
+type frame struct {
+	op       byte // opBlock, opLoop, opIf, or 0 for the function body
+	reached  bool // whether the construct is reachable
+	header   int  // of a loop
+	branched bool // whether a loop is branched to
+	cond     int  // block that ends with an if, for the else edge
+	hasElse  bool
+	pending  []pending // branches to the end
+}
+
+type pending struct {
+	from  int
+	kind  cfg.EdgeKind
+	label string
+}
+
+type lowering struct {
+	reader
+	limits cfg.Limits
+	fn     *Function
+
+	blocks   []*block
+	current  int // -1 in unreachable code
+	stack    []frame
+	loops    []int
+	numEdges int
+}
+
+const (
+	opUnreachable        = 0x00
+	opBlock              = 0x02
+	opLoop               = 0x03
+	opIf                 = 0x04
+	opElse               = 0x05
+	opTry                = 0x06
+	opCatch              = 0x07
+	opThrow              = 0x08
+	opRethrow            = 0x09
+	opThrowRef           = 0x0a
+	opEnd                = 0x0b
+	opBr                 = 0x0c
+	opBrIf               = 0x0d
+	opBrTable            = 0x0e
+	opReturn             = 0x0f
+	opReturnCall         = 0x12
+	opReturnCallIndirect = 0x13
+	opReturnCallRef      = 0x15
+	opDelegate           = 0x18
+	opCatchAll           = 0x19
+	opTryTable           = 0x1f
+	opBrOnNull           = 0xd5
+	opBrOnNonNull        = 0xd6
+)
+
+func (l *lowering) newBlock() int {
+	l.blocks = append(l.blocks, &block{})
+	if l.limits.MaxBlocks > 0 && len(l.blocks) > l.limits.MaxBlocks {
+		l.fail("more than %d blocks in function %d", l.limits.MaxBlocks, l.fn.Index)
+	}
+	return len(l.blocks) - 1
+}
+
+func (l *lowering) edge(from, to int, kind cfg.EdgeKind, label string) {
+	l.blocks[from].succs = append(l.blocks[from].succs, successor{to, kind, label})
+	l.numEdges++
+	if l.limits.MaxEdges > 0 && l.numEdges > l.limits.MaxEdges {
+		l.fail("more than %d edges in function %d", l.limits.MaxEdges, l.fn.Index)
+	}
+}
+
+// branch adds an edge from the current block to the target of
+// label 'depth'.
+//
+func (l *lowering) branch(depth uint32, kind cfg.EdgeKind, label string) {
+	if int(depth) >= len(l.stack) {
+		l.fail("branch depth %d out of range", depth)
+		return
+	}
+	f := &l.stack[len(l.stack)-1-int(depth)]
+	switch f.op {
+	case 0:
+		// A return.
+	case opLoop:
+		l.edge(l.current, f.header, kind, label)
+		if !f.branched {
+			f.branched = true
+			l.loops = append(l.loops, f.header)
+		}
+	default:
+		f.pending = append(f.pending, pending{l.current, kind, label})
+	}
+}
+
+// function lowers one body: its locals, then its instructions up to
+// the 'end' of the body.
+//
+func (l *lowering) function() {
+	for n := l.u32(); n > 0 && l.err == nil; n-- {
+		l.u32()
+		l.valType()
+	}
+	l.current = l.newBlock()
+	l.stack = []frame{{reached: true}}
+
+	for len(l.stack) > 0 && l.err == nil {
+		l.instruction()
+	}
+	if l.err != nil {
+		return
+	}
+	if l.pos != len(l.data) {
+		l.fail("code after the end of the function")
+		return
+	}
+
+	g := cfg.NewCFGOf[uint32]()
+	for _, b := range l.blocks {
+		g.CreateNode(b.name)
+	}
+	for _, b := range l.blocks {
+		for _, s := range b.succs {
+			cfg.NewBasicBlockEdgeOfKind(g, b.name, l.blocks[s.to].name, s.kind).SetLabel(s.label)
+		}
+	}
+	g.SetStart(l.blocks[0].name)
+	l.fn.CFG = g
+	for _, header := range l.loops {
+		l.fn.Loops = append(l.fn.Loops, l.blocks[header].name)
+	}
+}
+
+// place puts the instruction at 'offset' into the current block,
+// naming the block if it is the first.
+//
+func (l *lowering) place(offset int) {
+	if l.current < 0 {
+		return
+	}
+	if b := l.blocks[l.current]; !b.named {
+		b.name, b.named = uint32(offset), true
+	}
+}
+
+func (l *lowering) instruction() {
+	offset := l.pos
+	op := l.byte()
+	live := l.current >= 0
+
+	switch op {
+	case opBlock:
+		l.blockType()
+		l.place(offset)
+		l.stack = append(l.stack, frame{op: op, reached: live})
+
+	case opLoop:
+		l.blockType()
+		f := frame{op: op, reached: live, header: -1}
+		if live {
+			// An empty current block is the header itself.
+			if l.blocks[l.current].named {
+				header := l.newBlock()
+				l.edge(l.current, header, cfg.EdgeFallthrough, "")
+				l.current = header
+			}
+			l.place(offset)
+			f.header = l.current
+		}
+		l.stack = append(l.stack, f)
+
+	case opIf:
+		l.blockType()
+		f := frame{op: op, reached: live, cond: l.current}
+		if live {
+			l.place(offset)
+			then := l.newBlock()
+			l.edge(l.current, then, cfg.EdgeFallthrough, "")
+			l.current = then
+		}
+		l.stack = append(l.stack, f)
+
+	case opElse:
+		f := &l.stack[len(l.stack)-1]
+		if f.op != opIf || f.hasElse {
+			l.pos = offset
+			l.fail("else without if")
+			return
+		}
+		f.hasElse = true
+		if live {
+			l.place(offset)
+			f.pending = append(f.pending, pending{l.current, cfg.EdgeFallthrough, ""})
+		}
+		l.current = -1
+		if f.reached {
+			l.current = l.newBlock()
+			l.edge(f.cond, l.current, cfg.EdgeTaken, "")
+		}
+
+	case opEnd:
+		l.place(offset)
+		f := l.stack[len(l.stack)-1]
+		l.stack = l.stack[:len(l.stack)-1]
+		if f.op == 0 {
+			return
+		}
+		if f.op == opIf && !f.hasElse && f.reached {
+			f.pending = append(f.pending, pending{f.cond, cfg.EdgeTaken, ""})
+		}
+		if len(f.pending) > 0 {
+			next := l.newBlock()
+			if live {
+				l.edge(l.current, next, cfg.EdgeFallthrough, "")
+			}
+			for _, p := range f.pending {
+				l.edge(p.from, next, p.kind, p.label)
+			}
+			l.current = next
+		}
+
+	case opBr:
+		depth := l.u32()
+		if live {
+			l.place(offset)
+			l.branch(depth, cfg.EdgeFallthrough, "")
+		}
+		l.current = -1
+
+	case opBrIf, opBrOnNull, opBrOnNonNull:
+		depth := l.u32()
+		if live {
+			l.place(offset)
+			l.branch(depth, cfg.EdgeTaken, "")
+			next := l.newBlock()
+			l.edge(l.current, next, cfg.EdgeFallthrough, "")
+			l.current = next
+		}
+
+	case opBrTable:
+		n := l.u32()
+		if l.err != nil || int(n) > len(l.data)-l.pos {
+			l.fail("br_table too large")
+			return
+		}
+		depths := make([]uint32, n+1)
+		for i := range depths {
+			depths[i] = l.u32()
+		}
+		if live {
+			l.place(offset)
+			for i, depth := range depths {
+				label := "default"
+				if i < int(n) {
+					label = strconv.Itoa(i)
+				}
+				l.branch(depth, cfg.EdgeSwitchCase, label)
+			}
+		}
+		l.current = -1
+
+	case opUnreachable, opReturn, opThrowRef:
+		l.place(offset)
+		l.current = -1
+
+	case opThrow, opReturnCall, opReturnCallRef:
+		l.u32()
+		l.place(offset)
+		l.current = -1
+
+	case opReturnCallIndirect:
+		l.u32()
+		l.u32()
+		l.place(offset)
+		l.current = -1
+
+	case opTry, opCatch, opRethrow, opDelegate, opCatchAll, opTryTable:
+		l.pos = offset
+		l.fail("exception handling is not supported")
+
+	default:
+		l.place(offset)
+		l.immediates(offset, op)
+	}
+}
+
+// immediates skips the immediates of an instruction that does not
+// affect control flow.
+//
+func (l *lowering) immediates(offset int, op byte) {
+	switch {
+	case op == 0x01 || op == 0x1a || op == 0x1b: // nop, drop, select
+	case op == 0x1c: // select t*
+		for n := l.u32(); n > 0 && l.err == nil; n-- {
+			l.valType()
+		}
+	case op == 0x10 || op == 0x14: // call, call_ref
+		l.u32()
+	case op == 0x11: // call_indirect
+		l.u32()
+		l.u32()
+	case op >= 0x20 && op <= 0x26: // locals, globals, table.get/set
+		l.u32()
+	case op >= 0x28 && op <= 0x3e: // loads and stores
+		l.memArg()
+	case op == 0x3f || op == 0x40: // memory.size, memory.grow
+		l.u32()
+	case op == 0x41:
+		l.sleb(32)
+	case op == 0x42:
+		l.sleb(64)
+	case op == 0x43:
+		l.bytes(4)
+	case op == 0x44:
+		l.bytes(8)
+	case op >= 0x45 && op <= 0xc4: // numeric
+	case op == 0xd0: // ref.null
+		l.sleb(33)
+	case op == 0xd1 || op == 0xd3 || op == 0xd4: // ref.is_null, ref.eq, ref.as_non_null
+	case op == 0xd2: // ref.func
+		l.u32()
+	case op == 0xfc:
+		l.miscImmediates(offset)
+	case op == 0xfd:
+		l.simdImmediates(offset)
+	case op == 0xfe:
+		l.atomicImmediates(offset)
+	default:
+		l.pos = offset
+		l.fail("unknown opcode %#02x", op)
+	}
+}
+
+func (l *lowering) miscImmediates(offset int) {
+	switch sub := l.u32(); {
+	case sub <= 7: // saturating truncation
+	case sub == 8 || sub == 10 || sub == 12 || sub == 14:
+		l.u32()
+		l.u32()
+	case sub <= 17:
+		l.u32()
+	default:
+		l.pos = offset
+		l.fail("unknown opcode 0xfc %d", sub)
+	}
+}
+
+func (l *lowering) simdImmediates(offset int) {
+	switch sub := l.u32(); {
+	case sub <= 11 || sub == 92 || sub == 93: // loads and stores
+		l.memArg()
+	case sub == 12 || sub == 13: // v128.const, i8x16.shuffle
+		l.bytes(16)
+	case sub >= 21 && sub <= 34: // lane access
+		l.byte()
+	case sub >= 84 && sub <= 91: // lane loads and stores
+		l.memArg()
+		l.byte()
+	case sub <= 0x113: // arithmetic, including relaxed SIMD
+	default:
+		l.pos = offset
+		l.fail("unknown opcode 0xfd %d", sub)
+	}
+}
+
+func (l *lowering) atomicImmediates(offset int) {
+	switch sub := l.u32(); {
+	case sub == 3: // atomic.fence
+		l.byte()
+	case sub <= 2 || sub >= 0x10 && sub <= 0x4e:
+		l.memArg()
+	default:
+		l.pos = offset
+		l.fail("unknown opcode 0xfe %d", sub)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Loop nests of WebAssembly functions.
+//
+// Usage: wasmloops [-cfg] file.wasm ...
+//
+// Builds the CFG of every function defined in the given modules,
+// runs the Havlak loop finder on it and prints the loop tree with
+// blocks named by module offset. The loop headers found must be
+// exactly the 'loop' constructs that the function branches back to;
+// any difference is reported and makes the exit status 1.
+// With -cfg, the CFG is printed first, in the edge-list format.
+//
+// The fixtures in testdata/wasm are checked with 'make check-wasm'.
+//
+package main
+
+import "flag"
+import "fmt"
+import "os"
+import "./lsg"
+import "./havlakloopfinder"
+import "./wasm"
+
+var printCFG = flag.Bool("cfg", false, "print the CFG of every function")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: wasmloops [-cfg] file.wasm ...\n")
+		os.Exit(2)
+	}
+
+	status := 0
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wasmloops: %v\n", err)
+			status = 1
+			continue
+		}
+		fns, err := wasm.Read(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "wasmloops: %s: %v\n", path, err)
+			status = 1
+			continue
+		}
+
+		for _, fn := range fns {
+			lsgraph := lsg.NewLSGOf[uint32]()
+			havlakloopfinder.FindHavlakLoops(fn.CFG, lsgraph)
+			lsgraph.CalculateNestingLevel()
+
+			numEdges := 0
+			for _, bb := range fn.CFG.Blocks() {
+				numEdges += bb.NumSucc()
+			}
+			name := fn.Name
+			if name == "" {
+				name = fmt.Sprintf("func[%d]", fn.Index)
+			}
+			fmt.Printf("%s: %d blocks, %d edges, %d loops\n",
+				name, fn.CFG.NumNodes(), numEdges, lsgraph.NumLoops())
+			if *printCFG {
+				if err := fn.CFG.WriteEdgeList(os.Stdout); err != nil {
+					fmt.Fprintf(os.Stderr, "wasmloops: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if err := lsgraph.WriteNest(os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "wasmloops: %v\n", err)
+				os.Exit(1)
+			}
+			if !sameHeaders(lsgraph, fn.Loops) {
+				fmt.Fprintf(os.Stderr, "wasmloops: %s: %s: loop headers differ from the module's loops %#x\n",
+					path, name, fn.Loops)
+				status = 1
+			}
+		}
+	}
+	os.Exit(status)
+}
+
+// sameHeaders tells whether the loops found have exactly the given
+// headers, one loop each.
+//
+func sameHeaders(lsgraph *lsg.LSG[uint32], headers []uint32) bool {
+	want := make(map[uint32]bool)
+	for _, h := range headers {
+		want[h] = true
+	}
+	loops := lsgraph.Loops()
+	if len(loops) != len(want) {
+		return false
+	}
+	for _, loop := range loops {
+		if !want[loop.Header().Name()] {
+			return false
+		}
+		delete(want, loop.Header().Name())
+	}
+	return true
+}
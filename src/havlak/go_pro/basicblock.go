@@ -65,6 +65,34 @@ func (bb *BasicBlock) AddOutEdge(to *BasicBlock) {
 	bb.OutEdges = append(bb.OutEdges, to)
 }
 
+// RemoveInEdge removes one incoming edge from 'from', if there is one.
+//
+func (bb *BasicBlock) RemoveInEdge(from *BasicBlock) bool {
+	var ok bool
+	bb.InEdges, ok = removeFromSlice(bb.InEdges, from)
+	return ok
+}
+
+// RemoveOutEdge removes one outgoing edge to 'to', if there is one.
+//
+func (bb *BasicBlock) RemoveOutEdge(to *BasicBlock) bool {
+	var ok bool
+	bb.OutEdges, ok = removeFromSlice(bb.OutEdges, to)
+	return ok
+}
+
+// removeFromSlice drops the first occurrence of 'bb' from an edge slice.
+// Parallel edges show up as repeated entries, so only one is removed.
+//
+func removeFromSlice(edges []*BasicBlock, bb *BasicBlock) ([]*BasicBlock, bool) {
+	for i, e := range edges {
+		if e == bb {
+			return append(edges[:i], edges[i+1:]...), true
+		}
+	}
+	return edges, false
+}
+
 //-----------------------------------------------------------
 
 type CFG struct {
@@ -94,6 +122,88 @@ func (cfg *CFG) CreateNode(node int) *BasicBlock {
 	return bblock
 }
 
+// RemoveEdge removes one edge from -> to and updates both endpoints.
+// It returns false if there is no such edge.
+//
+func (cfg *CFG) RemoveEdge(from int, to int) bool {
+	src, dst := cfg.Blocks[from], cfg.Blocks[to]
+	if src == nil || dst == nil {
+		return false
+	}
+	if !src.RemoveOutEdge(dst) {
+		return false
+	}
+	dst.RemoveInEdge(src)
+	return true
+}
+
+// RemoveBlock removes a block and every edge into or out of it.
+//
+// If the block was the start node, the start moves to its first
+// remaining successor, or else to the block with the smallest name,
+// so that Start never refers to a block outside the graph.
+//
+func (cfg *CFG) RemoveBlock(node int) bool {
+	bblock := cfg.Blocks[node]
+	if bblock == nil {
+		return false
+	}
+
+	for _, pred := range bblock.InEdges {
+		if pred != bblock {
+			pred.RemoveOutEdge(bblock)
+		}
+	}
+	for _, succ := range bblock.OutEdges {
+		if succ != bblock {
+			succ.RemoveInEdge(bblock)
+		}
+	}
+	delete(cfg.Blocks, node)
+
+	if cfg.Start == bblock {
+		cfg.Start = nil
+		for _, succ := range bblock.OutEdges {
+			if succ != bblock {
+				cfg.Start = succ
+				break
+			}
+		}
+		if cfg.Start == nil {
+			for name, bb := range cfg.Blocks {
+				if cfg.Start == nil || name < cfg.Start.Name {
+					cfg.Start = bb
+				}
+			}
+		}
+	}
+	bblock.InEdges = nil
+	bblock.OutEdges = nil
+
+	return true
+}
+
+// ReplaceSuccessor redirects one edge node -> oldSucc to node -> newSucc,
+// keeping its position in the successor list. The new successor is
+// created if necessary. It returns false if there is no such edge.
+//
+func (cfg *CFG) ReplaceSuccessor(node int, oldSucc int, newSucc int) bool {
+	src, oldDst := cfg.Blocks[node], cfg.Blocks[oldSucc]
+	if src == nil || oldDst == nil {
+		return false
+	}
+	for i, succ := range src.OutEdges {
+		if succ == oldDst {
+			newDst := cfg.CreateNode(newSucc)
+			src.OutEdges[i] = newDst
+			oldDst.RemoveInEdge(src)
+			newDst.AddInEdge(src)
+			return true
+		}
+	}
+	return false
+}
+
 func (cfg *CFG) Dump() {
 	for _, n := range cfg.Blocks {
 		n.Dump()
@@ -0,0 +1,116 @@
+// Copyright 2011 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Check of the CFG editing operations.
+//
+// Builds a small graph with a self-loop and parallel edges, removes
+// the self-loop edge, one of the parallel edges, then the start
+// block, which has edges in and out, and its successor. After each
+// step it prints the graph and checks two things: that each edge
+// appears the same number of times in the out-list of its source as
+// in the in-list of its destination, and that Start is still in the
+// graph. The exit status is 1 if a check failed; 'make check-remove'
+// runs it.
+//
+package main
+
+import "fmt"
+import "os"
+import "sort"
+import "./basicblock"
+
+func main() {
+	cfgraph := cfg.NewCFG()
+	cfg.NewBasicBlockEdge(cfgraph, 0, 1)
+	cfg.NewBasicBlockEdge(cfgraph, 1, 1)
+	cfg.NewBasicBlockEdge(cfgraph, 1, 2)
+	cfg.NewBasicBlockEdge(cfgraph, 1, 2)
+	cfg.NewBasicBlockEdge(cfgraph, 2, 1)
+	cfg.NewBasicBlockEdge(cfgraph, 2, 3)
+	cfg.NewBasicBlockEdge(cfgraph, 0, 3)
+
+	ok := check(cfgraph, "initial", true)
+	ok = check(cfgraph, "remove edge 1 -> 1", cfgraph.RemoveEdge(1, 1)) && ok
+	ok = check(cfgraph, "remove edge 1 -> 2", cfgraph.RemoveEdge(1, 2)) && ok
+	ok = check(cfgraph, "remove edge 1 -> 1 again", !cfgraph.RemoveEdge(1, 1)) && ok
+	ok = check(cfgraph, "remove block 1", cfgraph.RemoveBlock(1)) && ok
+	ok = check(cfgraph, "remove block 2", cfgraph.RemoveBlock(2)) && ok
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// check prints the graph after a step whose result was 'done', and
+// reports whether the step did what it should and left the graph
+// consistent.
+//
+func check(cfgraph *cfg.CFG, step string, done bool) bool {
+	fmt.Printf("%s:\n", step)
+	ok := done
+	if !done {
+		fmt.Printf("  FAIL: nothing removed\n")
+	}
+
+	var names []int
+	for name, _ := range cfgraph.Blocks {
+		names = append(names, name)
+	}
+	sort.Ints(names)
+	for _, name := range names {
+		bb := cfgraph.Blocks[name]
+		fmt.Printf("  %d ->", name)
+		for _, succ := range bb.OutEdges {
+			fmt.Printf(" %d", succ.Name)
+		}
+		fmt.Printf("\n")
+		for _, succ := range bb.OutEdges {
+			if cfgraph.Blocks[succ.Name] != succ {
+				fmt.Printf("  FAIL: edge %d -> %d leaves the graph\n", name, succ.Name)
+				ok = false
+			} else if count(bb.OutEdges, succ) != count(succ.InEdges, bb) {
+				fmt.Printf("  FAIL: edge %d -> %d listed %d times at %d, %d times at %d\n",
+					name, succ.Name, count(bb.OutEdges, succ), name,
+					count(succ.InEdges, bb), succ.Name)
+				ok = false
+			}
+		}
+		for _, pred := range bb.InEdges {
+			if cfgraph.Blocks[pred.Name] != pred {
+				fmt.Printf("  FAIL: edge %d -> %d comes from outside the graph\n", pred.Name, name)
+				ok = false
+			}
+		}
+	}
+	switch {
+	case cfgraph.Start == nil && len(names) > 0:
+		fmt.Printf("  FAIL: no start block\n")
+		ok = false
+	case cfgraph.Start != nil && cfgraph.Blocks[cfgraph.Start.Name] != cfgraph.Start:
+		fmt.Printf("  FAIL: start block %d is not in the graph\n", cfgraph.Start.Name)
+		ok = false
+	case cfgraph.Start != nil:
+		fmt.Printf("  start %d\n", cfgraph.Start.Name)
+	}
+	return ok
+}
+
+func count(edges []*cfg.BasicBlock, bb *cfg.BasicBlock) int {
+	n := 0
+	for _, e := range edges {
+		if e == bb {
+			n++
+		}
+	}
+	return n
+}